@@ -0,0 +1,233 @@
+package cdc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/danthegoodman1/SQLGateway/gologger"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+var logger = gologger.NewLogger()
+
+type (
+	ChangesRequest struct {
+		// Tables as `schema.table` or `table` (in the public schema on Postgres)
+		Table []string `query:"table" validate:"required,max=32,dive,min=1,max=127"`
+		// Postgres only, the name of a consumer that can resume with a cursor, which has its own replication slot
+		Consumer string `query:"consumer" validate:"omitempty,max=48"`
+		// Resume after the checkpoint with this cursor
+		Cursor string `query:"cursor" validate:"omitempty,max=64"`
+		// sse (the default) or ndjson
+		Format string `query:"format" validate:"omitempty,oneof=sse ndjson"`
+	}
+
+	Event struct {
+		// change or checkpoint
+		Type string
+		// For checkpoint, changes after it can be streamed by resuming with this cursor
+		Cursor string `json:",omitempty"`
+		// For change
+		Table string `json:",omitempty"`
+		// For change, insert, update, delete, or truncate
+		Op string `json:",omitempty"`
+		// For change on CockroachDB, the primary key
+		Key any `json:",omitempty"`
+		// For insert and update, the new row
+		New map[string]any `json:",omitempty"`
+		// For update and delete, the old row if available
+		Old map[string]any `json:",omitempty"`
+		// For change, the commit time on Postgres, or the MVCC timestamp on CockroachDB
+		Timestamp string `json:",omitempty"`
+	}
+
+	// Feed is a started change stream
+	Feed interface {
+		// Run sends events to emit until the context is done or the stream fails, then closes the feed
+		Run(ctx context.Context, emit func(*Event) error) error
+		// Close closes a feed that won't be run, it does nothing once the feed is closed
+		Close(ctx context.Context) error
+	}
+
+	// trackedFeed is a feed that is ended by Shutdown
+	trackedFeed struct {
+		Feed
+		// Closed by Shutdown
+		shutdown chan struct{}
+	}
+)
+
+const (
+	EventTypeChange     = "change"
+	EventTypeCheckpoint = "checkpoint"
+
+	OpInsert   = "insert"
+	OpUpdate   = "update"
+	OpDelete   = "delete"
+	OpTruncate = "truncate"
+)
+
+var (
+	ErrInvalidRequest     = errors.New("invalid changes request")
+	ErrConsumerInUse      = errors.New("consumer is already streaming changes")
+	ErrChangesUnavailable = errors.New("changes unavailable")
+	ErrUnknownConsumer    = errors.New("unknown consumer")
+	ErrFeedsClosed        = errors.New("changes streams closed")
+
+	feedsMu     = &sync.Mutex{}
+	feeds       = map[*trackedFeed]struct{}{}
+	feedsClosed bool
+)
+
+// Start starts streaming changes with pgoutput logical replication on Postgres, or a changefeed on CockroachDB. Errors
+// from the database while starting are wrapped with ErrChangesUnavailable, since they are usually a configuration issue.
+func Start(ctx context.Context, pool *pgxpool.Pool, req *ChangesRequest) (Feed, error) {
+	tables := make([]string, len(req.Table))
+	for i, table := range req.Table {
+		tables[i] = normalizeTable(table)
+	}
+
+	crdb, err := isCockroachDB(ctx, pool)
+	if err != nil {
+		return nil, err
+	}
+	var feed Feed
+	if crdb {
+		feed, err = startCockroach(ctx, pool.Config().ConnConfig, tables, req)
+	} else {
+		feed, err = startPostgres(ctx, &pool.Config().ConnConfig.Config, tables, req)
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return nil, fmt.Errorf("%w: %s", ErrChangesUnavailable, pgErr.Message)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return track(feed)
+}
+
+// DropConsumer drops the replication slot of a Postgres consumer, so the database can free the WAL it was keeping
+func DropConsumer(ctx context.Context, pool *pgxpool.Pool, consumer string) error {
+	if !validSlotName(consumer) {
+		return invalidRequest("consumer can only have lower case letters, numbers, and underscores")
+	}
+	crdb, err := isCockroachDB(ctx, pool)
+	if err != nil {
+		return err
+	}
+	if crdb {
+		return invalidRequest("consumers only have replication slots on Postgres")
+	}
+
+	conn, err := utils.AcquireConn(ctx, pool)
+	if err != nil {
+		return fmt.Errorf("error in utils.AcquireConn: %w", err)
+	}
+	defer conn.Release()
+	_, err = conn.Exec(ctx, "SELECT pg_drop_replication_slot($1)", utils.CDC_SLOT_PREFIX+consumer)
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case codeUndefinedObject:
+			return fmt.Errorf("%w: %s", ErrUnknownConsumer, consumer)
+		case codeObjectInUse:
+			return ErrConsumerInUse
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("error dropping replication slot: %w", err)
+	}
+	return nil
+}
+
+// Shutdown ends the running streams with ErrFeedsClosed, and stops new ones from starting
+func Shutdown() {
+	feedsMu.Lock()
+	defer feedsMu.Unlock()
+	feedsClosed = true
+	for feed := range feeds {
+		close(feed.shutdown)
+		delete(feeds, feed)
+	}
+}
+
+func track(feed Feed) (Feed, error) {
+	feedsMu.Lock()
+	defer feedsMu.Unlock()
+	if feedsClosed {
+		feed.Close(context.Background())
+		return nil, ErrFeedsClosed
+	}
+	tracked := &trackedFeed{Feed: feed, shutdown: make(chan struct{})}
+	feeds[tracked] = struct{}{}
+	return tracked, nil
+}
+
+func (f *trackedFeed) untrack() {
+	feedsMu.Lock()
+	defer feedsMu.Unlock()
+	delete(feeds, f)
+}
+
+func (f *trackedFeed) Run(ctx context.Context, emit func(*Event) error) error {
+	defer f.untrack()
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	go func() {
+		select {
+		case <-f.shutdown:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	err := f.Feed.Run(ctx, emit)
+	select {
+	case <-f.shutdown:
+		return ErrFeedsClosed
+	default:
+		return err
+	}
+}
+
+func (f *trackedFeed) Close(ctx context.Context) error {
+	f.untrack()
+	return f.Feed.Close(ctx)
+}
+
+func isCockroachDB(ctx context.Context, pool *pgxpool.Pool) (bool, error) {
+	conn, err := utils.AcquireConn(ctx, pool)
+	if err != nil {
+		return false, fmt.Errorf("error in utils.AcquireConn: %w", err)
+	}
+	defer conn.Release()
+	return conn.Conn().PgConn().ParameterStatus("crdb_version") != "", nil
+}
+
+// normalizeTable qualifies the table with the public schema if it has none
+func normalizeTable(table string) string {
+	if strings.Contains(table, ".") {
+		return table
+	}
+	return "public." + table
+}
+
+// allowedConsumer checks that the consumer is in CDC_CONSUMERS
+func allowedConsumer(consumer string) bool {
+	for _, allowed := range strings.Split(utils.CDC_CONSUMERS, ",") {
+		if strings.TrimSpace(allowed) == consumer {
+			return true
+		}
+	}
+	return false
+}
+
+func invalidRequest(msg string) error {
+	return fmt.Errorf("%w: %s", ErrInvalidRequest, msg)
+}
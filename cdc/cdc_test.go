@@ -0,0 +1,91 @@
+package cdc
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgconn"
+)
+
+// blockingFeed runs until its context is done
+type blockingFeed struct {
+	closed bool
+}
+
+func (f *blockingFeed) Run(ctx context.Context, emit func(*Event) error) error {
+	<-ctx.Done()
+	return nil
+}
+
+func (f *blockingFeed) Close(ctx context.Context) error {
+	f.closed = true
+	return nil
+}
+
+func TestStartPostgresUnknownConsumer(t *testing.T) {
+	defer func(consumers string) {
+		utils.CDC_CONSUMERS = consumers
+	}(utils.CDC_CONSUMERS)
+	utils.CDC_CONSUMERS = "edge_cache, search"
+
+	// Rejected before connecting, so no slot is created
+	_, err := startPostgres(context.Background(), &pgconn.Config{}, []string{"public.users"}, &ChangesRequest{Consumer: "other"})
+	if !errors.Is(err, ErrUnknownConsumer) {
+		t.Fatalf("expected unknown consumer error, got %v", err)
+	}
+	if !allowedConsumer("search") || allowedConsumer("") {
+		t.Fatal("expected only the configured consumers to be allowed")
+	}
+}
+
+func TestCheckpointAcks(t *testing.T) {
+	f := &postgresFeed{ackedLSN: 0x100, cursorLSN: 0x1A0}
+	var cursor string
+	err := f.checkpoint(func(e *Event) error {
+		cursor = e.Cursor
+		return nil
+	}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cursor != "0/1A0" || f.ackedLSN != 0x1A0 {
+		t.Fatalf("expected the checkpoint to be acked, got %s %X", cursor, f.ackedLSN)
+	}
+
+	// A checkpoint that wasn't sent is not acked
+	f.cursorLSN = 0x200
+	err = f.checkpoint(func(e *Event) error {
+		return errors.New("client gone")
+	}, true)
+	if err == nil || f.ackedLSN != 0x1A0 {
+		t.Fatalf("expected the checkpoint to not be acked, got %v %X", err, f.ackedLSN)
+	}
+}
+
+func TestShutdownEndsFeeds(t *testing.T) {
+	defer func() {
+		feedsMu.Lock()
+		feedsClosed = false
+		feedsMu.Unlock()
+	}()
+
+	feed, err := track(&blockingFeed{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error)
+	go func() {
+		done <- feed.Run(context.Background(), func(*Event) error { return nil })
+	}()
+
+	Shutdown()
+	if err := <-done; !errors.Is(err, ErrFeedsClosed) {
+		t.Fatalf("expected feeds closed error, got %v", err)
+	}
+	next := &blockingFeed{}
+	if _, err := track(next); !errors.Is(err, ErrFeedsClosed) || !next.closed {
+		t.Fatalf("expected new feeds to be closed, got %v", err)
+	}
+}
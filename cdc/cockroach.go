@@ -0,0 +1,152 @@
+package cdc
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgx/v4"
+)
+
+type (
+	// cockroachFeed streams from a core changefeed on a dedicated connection
+	cockroachFeed struct {
+		conn *pgx.Conn
+		rows pgx.Rows
+		// Maps the table names in changefeed rows back to the requested tables
+		tables map[string]string
+	}
+
+	changefeedValue struct {
+		After   map[string]any
+		Before  map[string]any
+		Updated string
+	}
+)
+
+// Changefeed cursors are HLC timestamps like 1668462323456789000.0000000001
+var cursorRegex = regexp.MustCompile(`^\d+(\.\d+)?$`)
+
+func startCockroach(ctx context.Context, connConfig *pgx.ConnConfig, tables []string, req *ChangesRequest) (Feed, error) {
+	if req.Cursor != "" && !cursorRegex.MatchString(req.Cursor) {
+		return nil, invalidRequest("invalid cursor, expected a timestamp like 1668462323456789000.0000000001")
+	}
+
+	identifiers := make([]string, len(tables))
+	names := map[string]string{}
+	for i, table := range tables {
+		identifiers[i] = pgx.Identifier(strings.Split(table, ".")).Sanitize()
+		parts := strings.Split(table, ".")
+		names[parts[len(parts)-1]] = table
+	}
+	options := []string{"updated", "diff", fmt.Sprintf("resolved='%ds'", utils.CDC_CHECKPOINT_SEC)}
+	if req.Cursor != "" {
+		options = append(options, fmt.Sprintf("cursor='%s'", req.Cursor))
+	}
+	sql := fmt.Sprintf("EXPERIMENTAL CHANGEFEED FOR %s WITH %s", strings.Join(identifiers, ", "), strings.Join(options, ", "))
+
+	conn, err := pgx.ConnectConfig(ctx, connConfig.Copy())
+	if err != nil {
+		return nil, fmt.Errorf("error connecting for changefeed: %w", err)
+	}
+	// The changefeed outlives the request timeout, so it's started with the connection's own context in Run
+	rows, err := conn.Query(context.Background(), sql)
+	if err != nil {
+		conn.Close(context.Background())
+		return nil, err
+	}
+	return &cockroachFeed{conn: conn, rows: rows, tables: names}, nil
+}
+
+func (f *cockroachFeed) Run(ctx context.Context, emit func(*Event) error) error {
+	defer f.Close(context.Background())
+	// Closing the connection is the only way to interrupt a changefeed row that is being waited for
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			f.conn.PgConn().Conn().Close()
+		case <-done:
+		}
+	}()
+
+	for f.rows.Next() {
+		var table *string
+		var key, value []byte
+		if err := f.rows.Scan(&table, &key, &value); err != nil {
+			return fmt.Errorf("error scanning changefeed row: %w", err)
+		}
+		event, err := f.event(table, key, value)
+		if err != nil {
+			return err
+		}
+		if err := emit(event); err != nil {
+			return err
+		}
+	}
+	if ctx.Err() != nil {
+		return nil
+	}
+	return f.rows.Err()
+}
+
+// event converts a changefeed row to an event. Rows without a table are resolved timestamps, meaning every change
+// before it was sent.
+func (f *cockroachFeed) event(table *string, key, value []byte) (*Event, error) {
+	if table == nil {
+		var resolved struct {
+			Resolved string
+		}
+		if err := json.Unmarshal(value, &resolved); err != nil {
+			return nil, fmt.Errorf("error decoding resolved timestamp: %w", err)
+		}
+		return &Event{Type: EventTypeCheckpoint, Cursor: resolved.Resolved}, nil
+	}
+
+	var v changefeedValue
+	decoder := json.NewDecoder(bytes.NewReader(value))
+	decoder.UseNumber()
+	if err := decoder.Decode(&v); err != nil {
+		return nil, fmt.Errorf("error decoding changefeed value: %w", err)
+	}
+	var k any
+	decoder = json.NewDecoder(bytes.NewReader(key))
+	decoder.UseNumber()
+	if err := decoder.Decode(&k); err != nil {
+		return nil, fmt.Errorf("error decoding changefeed key: %w", err)
+	}
+
+	event := &Event{
+		Type:      EventTypeChange,
+		Table:     *table,
+		Key:       k,
+		New:       v.After,
+		Old:       v.Before,
+		Timestamp: v.Updated,
+	}
+	if name, ok := f.tables[*table]; ok {
+		event.Table = name
+	}
+	switch {
+	case v.After == nil:
+		event.Op = OpDelete
+	case v.Before == nil:
+		event.Op = OpInsert
+	default:
+		event.Op = OpUpdate
+	}
+	return event, nil
+}
+
+func (f *cockroachFeed) Close(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	f.rows.Close()
+	return f.conn.Close(ctx)
+}
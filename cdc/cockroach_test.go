@@ -0,0 +1,41 @@
+package cdc
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+)
+
+func TestCockroachEvent(t *testing.T) {
+	f := &cockroachFeed{tables: map[string]string{"users": "public.users"}}
+
+	event, err := f.event(nil, nil, []byte(`{"resolved":"1668462323456789000.0000000000"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if event.Type != EventTypeCheckpoint || event.Cursor != "1668462323456789000.0000000000" {
+		t.Fatalf("unexpected checkpoint %+v", event)
+	}
+
+	cases := []struct {
+		value string
+		op    string
+	}{
+		{`{"after":{"id":1},"before":null,"updated":"1.0"}`, OpInsert},
+		{`{"after":{"id":1},"before":{"id":1},"updated":"1.0"}`, OpUpdate},
+		{`{"after":null,"before":{"id":1},"updated":"1.0"}`, OpDelete},
+	}
+	for _, c := range cases {
+		event, err := f.event(utils.Ptr("users"), []byte(`[1]`), []byte(c.value))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if event.Type != EventTypeChange || event.Op != c.op || event.Table != "public.users" || event.Timestamp != "1.0" {
+			t.Fatalf("unexpected %s event %+v", c.op, event)
+		}
+		if key, ok := event.Key.([]any); !ok || key[0] != json.Number("1") {
+			t.Fatalf("unexpected key %#v", event.Key)
+		}
+	}
+}
@@ -0,0 +1,288 @@
+package cdc
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/jackc/pgtype"
+)
+
+type (
+	// pgoutputDecoder decodes the messages of the pgoutput plugin (protocol version 1) into events
+	pgoutputDecoder struct {
+		connInfo  *pgtype.ConnInfo
+		relations map[uint32]*relation
+		// Only changes to these tables are decoded
+		tables map[string]bool
+
+		// The commit time of the current transaction
+		commitTime time.Time
+		inTx       bool
+	}
+
+	relation struct {
+		table   string
+		columns []relationColumn
+	}
+
+	relationColumn struct {
+		name string
+		oid  uint32
+	}
+
+	// messageReader reads the fields of a message, recording the first error
+	messageReader struct {
+		buf []byte
+		err error
+	}
+)
+
+var (
+	errShortMessage = errors.New("pgoutput message too short")
+
+	// Postgres timestamps in replication messages are microseconds since 2000-01-01
+	postgresEpoch = time.Date(2000, 1, 1, 0, 0, 0, 0, time.UTC)
+)
+
+func newPgoutputDecoder(tables []string) *pgoutputDecoder {
+	d := &pgoutputDecoder{
+		connInfo:  pgtype.NewConnInfo(),
+		relations: map[uint32]*relation{},
+		tables:    map[string]bool{},
+	}
+	for _, table := range tables {
+		d.tables[table] = true
+	}
+	return d
+}
+
+// decode decodes a pgoutput message, returning the change events it contains. commitLSN is set if it was a commit, to
+// the end of the commit so that it can be used as a cursor.
+func (d *pgoutputDecoder) decode(msg []byte) (events []*Event, commitLSN uint64, err error) {
+	if len(msg) == 0 {
+		return nil, 0, errShortMessage
+	}
+	r := &messageReader{buf: msg[1:]}
+	switch msg[0] {
+	case 'B':
+		r.uint64() // final LSN
+		d.commitTime = pgTime(r.int64())
+		d.inTx = true
+	case 'C':
+		r.byte()   // flags
+		r.uint64() // commit LSN
+		commitLSN = r.uint64()
+		d.inTx = false
+	case 'R':
+		relID := r.uint32()
+		namespace := r.string()
+		name := r.string()
+		r.byte() // replica identity
+		rel := &relation{table: namespace + "." + name, columns: make([]relationColumn, r.uint16())}
+		for i := range rel.columns {
+			r.byte() // flags
+			rel.columns[i].name = r.string()
+			rel.columns[i].oid = r.uint32()
+			r.uint32() // type modifier
+		}
+		if r.err == nil {
+			d.relations[relID] = rel
+		}
+	case 'I':
+		rel, ok := d.relation(r)
+		if r.byte() != 'N' && r.err == nil {
+			return nil, 0, fmt.Errorf("unexpected tuple type in insert")
+		}
+		row := d.tuple(r, rel)
+		if ok {
+			events = append(events, d.change(rel, OpInsert, row, nil))
+		}
+	case 'U':
+		rel, ok := d.relation(r)
+		var old map[string]any
+		kind := r.byte()
+		if kind == 'K' || kind == 'O' {
+			old = d.tuple(r, rel)
+			kind = r.byte()
+		}
+		if kind != 'N' && r.err == nil {
+			return nil, 0, fmt.Errorf("unexpected tuple type in update")
+		}
+		row := d.tuple(r, rel)
+		if ok {
+			events = append(events, d.change(rel, OpUpdate, row, old))
+		}
+	case 'D':
+		rel, ok := d.relation(r)
+		r.byte() // K or O
+		old := d.tuple(r, rel)
+		if ok {
+			events = append(events, d.change(rel, OpDelete, nil, old))
+		}
+	case 'T':
+		relIDs := make([]uint32, r.uint32())
+		r.byte() // options
+		for i := range relIDs {
+			relIDs[i] = r.uint32()
+		}
+		for _, relID := range relIDs {
+			if rel := d.relations[relID]; rel != nil && d.tables[rel.table] && r.err == nil {
+				events = append(events, d.change(rel, OpTruncate, nil, nil))
+			}
+		}
+	}
+	// Other messages (origin, type) aren't needed
+	if r.err != nil {
+		return nil, 0, r.err
+	}
+	return events, commitLSN, nil
+}
+
+// relation reads the relation ID of a change, returning the relation and whether its changes are wanted
+func (d *pgoutputDecoder) relation(r *messageReader) (*relation, bool) {
+	relID := r.uint32()
+	rel := d.relations[relID]
+	if rel == nil {
+		if r.err == nil {
+			r.err = fmt.Errorf("change for unknown relation %d", relID)
+		}
+		return &relation{}, false
+	}
+	return rel, d.tables[rel.table]
+}
+
+// tuple reads the columns of a row. Unchanged TOASTed values are left out, since they aren't sent.
+func (d *pgoutputDecoder) tuple(r *messageReader, rel *relation) map[string]any {
+	n := int(r.uint16())
+	row := make(map[string]any, n)
+	for i := 0; i < n && r.err == nil; i++ {
+		kind := r.byte()
+		var name string
+		var oid uint32
+		if i < len(rel.columns) {
+			name, oid = rel.columns[i].name, rel.columns[i].oid
+		}
+		switch kind {
+		case 'n':
+			row[name] = nil
+		case 't':
+			row[name] = d.decodeText(oid, r.bytes(int(r.uint32())))
+		case 'u':
+		default:
+			if r.err == nil {
+				r.err = fmt.Errorf("unexpected column kind %q", kind)
+			}
+		}
+	}
+	return row
+}
+
+// decodeText decodes the value like a query result would be, falling back to the text for unknown types
+func (d *pgoutputDecoder) decodeText(oid uint32, src []byte) any {
+	dt, ok := d.connInfo.DataTypeForOID(oid)
+	if !ok {
+		return string(src)
+	}
+	value := pgtype.NewValue(dt.Value)
+	decoder, ok := value.(pgtype.TextDecoder)
+	if !ok || decoder.DecodeText(d.connInfo, src) != nil {
+		return string(src)
+	}
+	return value.Get()
+}
+
+func (d *pgoutputDecoder) change(rel *relation, op string, row, old map[string]any) *Event {
+	return &Event{
+		Type:      EventTypeChange,
+		Table:     rel.table,
+		Op:        op,
+		New:       row,
+		Old:       old,
+		Timestamp: d.commitTime.Format(time.RFC3339Nano),
+	}
+}
+
+func (r *messageReader) next(n int) []byte {
+	if r.err != nil {
+		return nil
+	}
+	if n < 0 || len(r.buf) < n {
+		r.err = errShortMessage
+		return nil
+	}
+	b := r.buf[:n]
+	r.buf = r.buf[n:]
+	return b
+}
+
+func (r *messageReader) byte() byte {
+	if b := r.next(1); b != nil {
+		return b[0]
+	}
+	return 0
+}
+
+func (r *messageReader) uint16() uint16 {
+	if b := r.next(2); b != nil {
+		return binary.BigEndian.Uint16(b)
+	}
+	return 0
+}
+
+func (r *messageReader) uint32() uint32 {
+	if b := r.next(4); b != nil {
+		return binary.BigEndian.Uint32(b)
+	}
+	return 0
+}
+
+func (r *messageReader) uint64() uint64 {
+	if b := r.next(8); b != nil {
+		return binary.BigEndian.Uint64(b)
+	}
+	return 0
+}
+
+func (r *messageReader) int64() int64 {
+	return int64(r.uint64())
+}
+
+func (r *messageReader) bytes(n int) []byte {
+	return r.next(n)
+}
+
+// string reads a null terminated string
+func (r *messageReader) string() string {
+	if r.err != nil {
+		return ""
+	}
+	for i, c := range r.buf {
+		if c == 0 {
+			s := string(r.buf[:i])
+			r.buf = r.buf[i+1:]
+			return s
+		}
+	}
+	r.err = errShortMessage
+	return ""
+}
+
+func pgTime(micros int64) time.Time {
+	return postgresEpoch.Add(time.Duration(micros) * time.Microsecond)
+}
+
+// formatLSN formats an LSN like Postgres, e.g. 16/B374D848
+func formatLSN(lsn uint64) string {
+	return fmt.Sprintf("%X/%X", uint32(lsn>>32), uint32(lsn))
+}
+
+func parseLSN(s string) (uint64, error) {
+	var hi, lo uint32
+	var rest string
+	if n, _ := fmt.Sscanf(s, "%X/%X%s", &hi, &lo, &rest); n != 2 {
+		return 0, invalidRequest("invalid cursor, expected an LSN like 16/B374D848")
+	}
+	return uint64(hi)<<32 | uint64(lo), nil
+}
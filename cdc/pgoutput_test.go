@@ -0,0 +1,134 @@
+package cdc
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+// message builds a pgoutput message from bytes, strings (null terminated), and big endian integers
+func message(parts ...any) []byte {
+	var buf []byte
+	for _, part := range parts {
+		switch p := part.(type) {
+		case byte:
+			buf = append(buf, p)
+		case string:
+			buf = append(append(buf, p...), 0)
+		case uint16:
+			b := make([]byte, 2)
+			binary.BigEndian.PutUint16(b, p)
+			buf = append(buf, b...)
+		case uint32:
+			b := make([]byte, 4)
+			binary.BigEndian.PutUint32(b, p)
+			buf = append(buf, b...)
+		case uint64:
+			b := make([]byte, 8)
+			binary.BigEndian.PutUint64(b, p)
+			buf = append(buf, b...)
+		case []byte:
+			b := make([]byte, 4)
+			binary.BigEndian.PutUint32(b, uint32(len(p)))
+			buf = append(append(buf, b...), p...)
+		}
+	}
+	return buf
+}
+
+func TestPgoutputDecode(t *testing.T) {
+	d := newPgoutputDecoder([]string{"public.users"})
+
+	messages := [][]byte{
+		message(byte('R'), uint32(1), "public", "users", byte('d'), uint16(2),
+			byte(1), "id", uint32(20), uint32(0xffffffff),
+			byte(0), "name", uint32(25), uint32(0xffffffff)),
+		message(byte('R'), uint32(2), "public", "other", byte('d'), uint16(1),
+			byte(1), "id", uint32(20), uint32(0xffffffff)),
+		message(byte('B'), uint64(0x100), uint64(0), uint32(7)),
+		message(byte('I'), uint32(1), byte('N'), uint16(2), byte('t'), []byte("1"), byte('t'), []byte("dan")),
+		message(byte('I'), uint32(2), byte('N'), uint16(1), byte('t'), []byte("1")),
+		message(byte('U'), uint32(1), byte('K'), uint16(2), byte('t'), []byte("1"), byte('n'),
+			byte('N'), uint16(2), byte('t'), []byte("2"), byte('u')),
+		message(byte('D'), uint32(1), byte('K'), uint16(2), byte('t'), []byte("2"), byte('n')),
+		message(byte('T'), uint32(2), byte(0), uint32(1), uint32(2)),
+	}
+	var events []*Event
+	for _, msg := range messages {
+		e, commitLSN, err := d.decode(msg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if commitLSN != 0 {
+			t.Fatalf("unexpected commit LSN %d", commitLSN)
+		}
+		events = append(events, e...)
+	}
+	if !d.inTx {
+		t.Fatal("expected to be in a transaction")
+	}
+
+	if len(events) != 4 {
+		t.Fatalf("expected 4 events, got %d", len(events))
+	}
+	insert := events[0]
+	if insert.Op != OpInsert || insert.Table != "public.users" || insert.New["id"] != int64(1) || insert.New["name"] != "dan" || insert.Old != nil {
+		t.Fatalf("unexpected insert %+v", insert)
+	}
+	if insert.Timestamp != "2000-01-01T00:00:00Z" {
+		t.Fatalf("unexpected timestamp %s", insert.Timestamp)
+	}
+	update := events[1]
+	if update.Op != OpUpdate || update.New["id"] != int64(2) || update.Old["id"] != int64(1) {
+		t.Fatalf("unexpected update %+v", update)
+	}
+	if _, ok := update.New["name"]; ok {
+		t.Fatal("unchanged TOASTed value should be left out")
+	}
+	if v, ok := update.Old["name"]; !ok || v != nil {
+		t.Fatal("expected null name in old row")
+	}
+	if del := events[2]; del.Op != OpDelete || del.New != nil || del.Old["id"] != int64(2) {
+		t.Fatalf("unexpected delete %+v", del)
+	}
+	if truncate := events[3]; truncate.Op != OpTruncate || truncate.Table != "public.users" {
+		t.Fatalf("unexpected truncate %+v", truncate)
+	}
+
+	events, commitLSN, err := d.decode(message(byte('C'), byte(0), uint64(0x100), uint64(0x1A0), uint64(0)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 0 || commitLSN != 0x1A0 || d.inTx {
+		t.Fatalf("unexpected commit %d %v", commitLSN, d.inTx)
+	}
+}
+
+func TestPgoutputDecodeErrors(t *testing.T) {
+	d := newPgoutputDecoder([]string{"public.users"})
+	if _, _, err := d.decode(message(byte('I'), uint32(1), byte('N'), uint16(0))); err == nil {
+		t.Fatal("expected error for unknown relation")
+	}
+	if _, _, err := d.decode([]byte{'B', 0, 0}); !errors.Is(err, errShortMessage) {
+		t.Fatalf("expected short message error, got %v", err)
+	}
+}
+
+func TestLSN(t *testing.T) {
+	lsn, err := parseLSN("16/B374D848")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lsn != 0x16B374D848 {
+		t.Fatalf("unexpected LSN %X", lsn)
+	}
+	if s := formatLSN(lsn); s != "16/B374D848" {
+		t.Fatalf("unexpected formatted LSN %s", s)
+	}
+
+	for _, cursor := range []string{"", "16", "16/B374D848x", "x/1"} {
+		if _, err := parseLSN(cursor); !errors.Is(err, ErrInvalidRequest) {
+			t.Fatalf("expected invalid request for %q, got %v", cursor, err)
+		}
+	}
+}
@@ -0,0 +1,286 @@
+package cdc
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/rs/zerolog"
+)
+
+type (
+	// postgresFeed streams from a replication slot on a dedicated replication connection
+	postgresFeed struct {
+		conn    *pgconn.PgConn
+		decoder *pgoutputDecoder
+		// The last checkpoint sent to the consumer, reported as flushed so the slot can free the WAL before it
+		ackedLSN uint64
+		// The last position that was received, and the last position that is safe to resume from
+		receivedLSN uint64
+		cursorLSN   uint64
+		temporary   bool
+		// Whether the current transaction had changes to the tables, so a checkpoint is sent after it commits
+		hadChanges bool
+
+		lastCheckpoint time.Time
+	}
+)
+
+const (
+	standbyStatusInterval = time.Second * 10
+
+	codeDuplicateObject = "42710"
+	codeUndefinedObject = "42704"
+	codeObjectInUse     = "55006"
+)
+
+func startPostgres(ctx context.Context, connConfig *pgconn.Config, tables []string, req *ChangesRequest) (Feed, error) {
+	var cursor uint64
+	if req.Cursor != "" {
+		if req.Consumer == "" {
+			return nil, invalidRequest("resuming with a cursor requires a consumer on Postgres")
+		}
+		var err error
+		if cursor, err = parseLSN(req.Cursor); err != nil {
+			return nil, err
+		}
+	}
+	if req.Consumer != "" && !validSlotName(req.Consumer) {
+		return nil, invalidRequest("consumer can only have lower case letters, numbers, and underscores")
+	}
+	// Slots keep WAL until they are dropped, so callers can't create them for any name
+	if req.Consumer != "" && !allowedConsumer(req.Consumer) {
+		return nil, fmt.Errorf("%w: %s is not in CDC_CONSUMERS", ErrUnknownConsumer, req.Consumer)
+	}
+
+	config := connConfig.Copy()
+	config.RuntimeParams["replication"] = "database"
+	conn, err := pgconn.ConnectConfig(ctx, config)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting for replication: %w", err)
+	}
+
+	feed := &postgresFeed{
+		conn:           conn,
+		decoder:        newPgoutputDecoder(tables),
+		ackedLSN:       cursor,
+		cursorLSN:      cursor,
+		temporary:      req.Consumer == "",
+		lastCheckpoint: time.Now(),
+	}
+	if err := feed.start(ctx, req.Consumer, cursor); err != nil {
+		conn.Close(context.Background())
+		return nil, err
+	}
+	return feed, nil
+}
+
+// start creates the slot if needed, and starts replication from it
+func (f *postgresFeed) start(ctx context.Context, consumer string, cursor uint64) error {
+	var slot string
+	if f.temporary {
+		var suffix [8]byte
+		if _, err := rand.Read(suffix[:]); err != nil {
+			return fmt.Errorf("error in rand.Read: %w", err)
+		}
+		slot = utils.CDC_SLOT_PREFIX + "tmp_" + hex.EncodeToString(suffix[:])
+		_, err := f.conn.Exec(ctx, fmt.Sprintf("CREATE_REPLICATION_SLOT %s TEMPORARY LOGICAL pgoutput NOEXPORT_SNAPSHOT", slot)).ReadAll()
+		if err != nil {
+			return fmt.Errorf("error creating temporary replication slot: %w", err)
+		}
+	} else {
+		slot = utils.CDC_SLOT_PREFIX + consumer
+		_, err := f.conn.Exec(ctx, fmt.Sprintf("CREATE_REPLICATION_SLOT %s LOGICAL pgoutput NOEXPORT_SNAPSHOT", slot)).ReadAll()
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == codeDuplicateObject {
+			err = nil
+		}
+		if err != nil {
+			return fmt.Errorf("error creating replication slot: %w", err)
+		}
+	}
+
+	publication := "'" + strings.ReplaceAll(utils.CDC_PUBLICATION, "'", "''") + "'"
+	sql := fmt.Sprintf("START_REPLICATION SLOT %s LOGICAL %s (proto_version '1', publication_names %s)", slot, formatLSN(cursor), publication)
+	if err := f.conn.SendBytes(ctx, (&pgproto3.Query{String: sql}).Encode(nil)); err != nil {
+		return fmt.Errorf("error sending START_REPLICATION: %w", err)
+	}
+	for {
+		msg, err := f.conn.ReceiveMessage(ctx)
+		if err != nil {
+			return fmt.Errorf("error receiving START_REPLICATION response: %w", err)
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.CopyBothResponse:
+			// Ask for a keepalive, so there is a position to checkpoint at right away
+			return f.sendStandbyStatus(ctx, true)
+		case *pgproto3.ErrorResponse:
+			pgErr := pgconn.ErrorResponseToPgError(msg)
+			if pgErr.Code == codeObjectInUse {
+				return ErrConsumerInUse
+			}
+			return pgErr
+		}
+	}
+}
+
+func (f *postgresFeed) Run(ctx context.Context, emit func(*Event) error) error {
+	defer f.Close(context.Background())
+	logger := zerolog.Ctx(ctx)
+
+	nextStatus := time.Now().Add(standbyStatusInterval)
+	for {
+		if time.Now().After(nextStatus) {
+			if err := f.sendStandbyStatus(ctx, false); err != nil {
+				return err
+			}
+			nextStatus = time.Now().Add(standbyStatusInterval)
+		}
+		if err := f.checkpoint(emit, false); err != nil {
+			return err
+		}
+
+		receiveCtx, cancel := context.WithDeadline(ctx, nextStatus)
+		msg, err := f.conn.ReceiveMessage(receiveCtx)
+		cancel()
+		if ctx.Err() != nil {
+			return nil
+		}
+		if pgconn.Timeout(err) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("error receiving replication message: %w", err)
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.CopyData:
+			if err := f.handleCopyData(ctx, msg.Data, emit); err != nil {
+				return err
+			}
+		case *pgproto3.ErrorResponse:
+			return pgconn.ErrorResponseToPgError(msg)
+		case *pgproto3.CopyDone:
+			logger.Debug().Msg("replication ended by the server")
+			return nil
+		}
+	}
+}
+
+func (f *postgresFeed) handleCopyData(ctx context.Context, data []byte, emit func(*Event) error) error {
+	if len(data) == 0 {
+		return errShortMessage
+	}
+	r := &messageReader{buf: data[1:]}
+	switch data[0] {
+	case 'k':
+		// Primary keepalive
+		walEnd := r.uint64()
+		r.int64() // server time
+		replyRequested := r.byte() == 1
+		if r.err != nil {
+			return r.err
+		}
+		f.receive(walEnd)
+		// Everything before the position the server got to was sent, so it's safe to resume from between transactions
+		if !f.decoder.inTx && walEnd > f.cursorLSN {
+			f.cursorLSN = walEnd
+		}
+		if replyRequested {
+			return f.sendStandbyStatus(ctx, false)
+		}
+	case 'w':
+		// XLogData
+		r.uint64() // WAL start
+		walEnd := r.uint64()
+		r.int64() // server time
+		if r.err != nil {
+			return r.err
+		}
+		f.receive(walEnd)
+		events, commitLSN, err := f.decoder.decode(r.buf)
+		if err != nil {
+			return fmt.Errorf("error decoding pgoutput message: %w", err)
+		}
+		for _, event := range events {
+			if err := emit(event); err != nil {
+				return err
+			}
+		}
+		if commitLSN != 0 {
+			f.cursorLSN = commitLSN
+			hadChanges := len(events) > 0 || f.hadChanges
+			f.hadChanges = false
+			return f.checkpoint(emit, hadChanges)
+		}
+		if len(events) > 0 {
+			f.hadChanges = true
+		}
+	}
+	return nil
+}
+
+func (f *postgresFeed) receive(lsn uint64) {
+	if lsn > f.receivedLSN {
+		f.receivedLSN = lsn
+	}
+}
+
+// checkpoint emits the cursor if forced (after a transaction with changes), or if CDC_CHECKPOINT_SEC has passed
+func (f *postgresFeed) checkpoint(emit func(*Event) error, force bool) error {
+	if f.cursorLSN == 0 || !force && time.Since(f.lastCheckpoint) < time.Second*time.Duration(utils.CDC_CHECKPOINT_SEC) {
+		return nil
+	}
+	f.lastCheckpoint = time.Now()
+	if err := emit(&Event{Type: EventTypeCheckpoint, Cursor: formatLSN(f.cursorLSN)}); err != nil {
+		return err
+	}
+	f.ackedLSN = f.cursorLSN
+	return nil
+}
+
+// sendStandbyStatus reports the received position. Consumer slots are only flushed up to the last checkpoint sent, so
+// that they can resume from it, while temporary slots don't need to keep anything.
+func (f *postgresFeed) sendStandbyStatus(ctx context.Context, replyRequested bool) error {
+	flushed := f.ackedLSN
+	if f.temporary {
+		flushed = f.receivedLSN
+	}
+	buf := make([]byte, 34)
+	buf[0] = 'r'
+	binary.BigEndian.PutUint64(buf[1:], f.receivedLSN)
+	binary.BigEndian.PutUint64(buf[9:], flushed)
+	binary.BigEndian.PutUint64(buf[17:], flushed)
+	binary.BigEndian.PutUint64(buf[25:], uint64(time.Since(postgresEpoch).Microseconds()))
+	if replyRequested {
+		buf[33] = 1
+	}
+	if err := f.conn.SendBytes(ctx, (&pgproto3.CopyData{Data: buf}).Encode(nil)); err != nil {
+		return fmt.Errorf("error sending standby status: %w", err)
+	}
+	return nil
+}
+
+func (f *postgresFeed) Close(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
+	defer cancel()
+	return f.conn.Close(ctx)
+}
+
+// validSlotName checks that the consumer can be used in a replication slot name without quoting
+func validSlotName(consumer string) bool {
+	for _, c := range consumer {
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
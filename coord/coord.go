@@ -0,0 +1,85 @@
+package coord
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+)
+
+type (
+	// Coordinator is the shared state between pods in a cluster, implemented by the red (Redis) and etcd packages
+	Coordinator interface {
+		// Name is the name of the backend, used in health checks and admin responses
+		Name() string
+		Ping(ctx context.Context) error
+		// Shutdown removes this pod from the cluster and closes the client
+		Shutdown(ctx context.Context) error
+
+		// SetTransaction registers a transaction until its expiry, returning ErrTxAlreadyExists if it exists
+		SetTransaction(ctx context.Context, txMeta *TransactionMeta) error
+		// GetTransaction returns ErrNotFound if the transaction does not exist
+		GetTransaction(ctx context.Context, txID string) (*TransactionMeta, error)
+		// ExtendTransaction updates the expiry of the transaction, returning ErrNotFound if it does not exist
+		ExtendTransaction(ctx context.Context, txID string, expiry time.Time) error
+		DeleteTransaction(ctx context.Context, txID string) error
+		ListTransactions(ctx context.Context) ([]*TransactionMeta, error)
+		// DeleteTransactionsForPod removes the transactions owned by a pod, returning how many were removed
+		DeleteTransactionsForPod(ctx context.Context, podName string) (int, error)
+
+		// GetPeers returns the current members of the cluster by pod name
+		GetPeers(ctx context.Context) (map[string]*Peer, error)
+		// CachedPeers returns the healthy peers that were last seen, including this pod, sorted by name
+		CachedPeers() []*Peer
+		// CachedPeersUpdated returns when the cached peers were last refreshed
+		CachedPeersUpdated() time.Time
+		RemovePeer(ctx context.Context, podName string) error
+
+		SetRunningQuery(ctx context.Context, queryMeta *RunningQueryMeta, ttl time.Duration) error
+		// GetRunningQuery returns ErrNotFound if the query is not running
+		GetRunningQuery(ctx context.Context, queryID string) (*RunningQueryMeta, error)
+		DeleteRunningQuery(ctx context.Context, queryID string) error
+
+		// ReserveIdempotencyKey sets the key only if it does not exist, returning whether it was set
+		ReserveIdempotencyKey(ctx context.Context, key string, val []byte, ttl time.Duration) (bool, error)
+		SetIdempotencyKey(ctx context.Context, key string, val []byte, ttl time.Duration) error
+		// GetIdempotencyKey returns ErrNotFound if the key does not exist
+		GetIdempotencyKey(ctx context.Context, key string) ([]byte, error)
+		DeleteIdempotencyKey(ctx context.Context, key string) error
+	}
+
+	Peer struct {
+		PodName string
+		PodURL  string
+		// LastUpdate is the last heartbeat for redis, or when the peer was last seen alive for etcd
+		LastUpdate time.Time
+	}
+
+	RunningQueryMeta struct {
+		QueryID string
+		PodID   string
+		PodURL  string
+	}
+
+	TransactionMeta struct {
+		TxID    string
+		PodID   string
+		PodURL  string
+		Expiry  time.Time
+		Created time.Time
+	}
+)
+
+var (
+	// Client is the coordinator of the cluster, nil when not clustered
+	Client Coordinator
+
+	ErrNotFound        = errors.New("not found")
+	ErrTxAlreadyExists = errors.New("transaction already exists")
+)
+
+// Healthy returns whether the peer has been seen within PEER_TTL_SEC
+func (peer *Peer) Healthy() bool {
+	return time.Since(peer.LastUpdate) <= time.Second*time.Duration(utils.PEER_TTL_SEC)
+}
@@ -0,0 +1,20 @@
+package coord
+
+import (
+	"testing"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+)
+
+func TestPeerHealthy(t *testing.T) {
+	peer := &Peer{LastUpdate: time.Now()}
+	if !peer.Healthy() {
+		t.Fatal("expected a fresh peer to be healthy")
+	}
+
+	peer.LastUpdate = time.Now().Add(-time.Second * time.Duration(utils.PEER_TTL_SEC+1))
+	if peer.Healthy() {
+		t.Fatal("expected a stale peer to be unhealthy")
+	}
+}
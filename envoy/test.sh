@@ -0,0 +1,66 @@
+#!/usr/bin/env bash
+# Checks that envoy routes transaction requests to the pod in the routing hint, that a stale hint is still
+# forwarded to the owning pod, and that a hint that is not a pod is load balanced rather than connected to. Run with `task envoy-test`, or against a running `docker compose up` in this directory.
+set -euo pipefail
+
+URL=${URL:-http://localhost:8080}
+PODS=("172.28.0.10:8080" "172.28.0.11:8080")
+JAR=$(mktemp)
+trap 'rm -f "$JAR"' EXIT
+
+fail() {
+  echo "FAIL: $*" >&2
+  exit 1
+}
+
+echo "waiting for envoy and the pods"
+for _ in $(seq 1 60); do
+  if curl -sf "$URL/readyz" >/dev/null; then
+    break
+  fi
+  sleep 1
+done
+curl -sf "$URL/readyz" >/dev/null || fail "pods did not become ready"
+
+query() {
+  curl -sf -b "$JAR" -H 'content-type: application/json' "$@" "$URL/psql/query" \
+    -d "{\"TxID\": \"$TX_ID\", \"Queries\": [{\"Statement\": \"SELECT 1\"}]}"
+}
+
+echo "beginning transaction"
+BEGIN=$(curl -sf -i -c "$JAR" -H 'content-type: application/json' "$URL/psql/begin" -d '{}')
+TX_ID=$(echo "$BEGIN" | sed -n 's/.*"TxID":"\([^"]*\)".*/\1/p')
+HINT=$(echo "$BEGIN" | tr -d '\r' | sed -n 's/^[Xx]-[Ss][Qq][Ll][Gg]ateway-[Pp]od: //p')
+[ -n "$TX_ID" ] || fail "no TxID in begin response: $BEGIN"
+[ -n "$HINT" ] || fail "no routing hint in begin response: $BEGIN"
+grep -q sqlgateway_pod "$JAR" || fail "no routing hint cookie in begin response"
+echo "transaction $TX_ID is on $HINT"
+
+echo "querying with the cookie"
+for _ in $(seq 1 10); do
+  RES=$(query)
+  echo "$RES" | grep -q '"Remote":true' && fail "query was forwarded, envoy did not route with the cookie: $RES"
+done
+
+echo "querying with a stale hint"
+for POD in "${PODS[@]}"; do
+  if [ "$POD" != "$HINT" ]; then
+    STALE=$POD
+  fi
+done
+RES=$(curl -sf -i -H 'content-type: application/json' -H "x-sqlgateway-pod: $STALE" "$URL/psql/query" \
+  -d "{\"TxID\": \"$TX_ID\", \"Queries\": [{\"Statement\": \"SELECT 1\"}]}")
+echo "$RES" | grep -q '"Remote":true' || fail "query with a stale hint was not forwarded: $RES"
+echo "$RES" | tr -d '\r' | grep -qi "^x-sqlgateway-pod: $HINT$" || fail "stale hint was not corrected: $RES"
+
+echo "querying with a hint that is not a pod"
+RES=$(curl -sf -H 'content-type: application/json' -H "x-sqlgateway-pod: 169.254.169.254:80" "$URL/psql/query" \
+  -d "{\"TxID\": \"$TX_ID\", \"Queries\": [{\"Statement\": \"SELECT 1\"}]}") \
+  || fail "query with an unknown hint was not load balanced to a pod"
+echo "$RES" | grep -q '"Queries"' || fail "unexpected response for an unknown hint: $RES"
+
+echo "rolling back"
+RES=$(curl -sf -i -b "$JAR" -c "$JAR" -H 'content-type: application/json' "$URL/psql/rollback" -d "{\"TxID\": \"$TX_ID\"}")
+grep -q sqlgateway_pod "$JAR" && fail "routing hint cookie was not cleared: $RES"
+
+echo "PASS"
@@ -0,0 +1,593 @@
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/coord"
+	"github.com/danthegoodman1/SQLGateway/gologger"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/rs/zerolog"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+var (
+	logger = gologger.NewLogger()
+)
+
+type (
+	// Coordinator implements coord.Coordinator with etcd. Keys expire with leases, and this pod's peer key is attached
+	// to a lease that is kept alive for as long as the pod is running.
+	Coordinator struct {
+		client *clientv3.Client
+		// prefix is /{V_NAMESPACE}/, or /sqlgateway/ if it is not set
+		prefix string
+		// stop cancels the peer keepalive and watch
+		stop context.CancelFunc
+
+		peersMu      *sync.Mutex
+		peerLease    clientv3.LeaseID
+		peers        map[string]*coord.Peer
+		peersUpdated time.Time
+	}
+)
+
+var _ coord.Coordinator = &Coordinator{}
+
+// Connect connects to ETCD_ENDPOINTS and joins the cluster
+func Connect() (*Coordinator, error) {
+	logger.Debug().Msg("connecting to etcd")
+	cfg := clientv3.Config{
+		Endpoints:   strings.Split(utils.ETCD_ENDPOINTS, ","),
+		Username:    utils.ETCD_USERNAME,
+		Password:    utils.ETCD_PASSWORD,
+		DialTimeout: time.Second * 10,
+	}
+	if utils.ETCD_TLS {
+		cfg.TLS = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+	return NewCoordinator(cfg)
+}
+
+// NewCoordinator creates the client and joins the cluster, returning once the peer list is loaded
+func NewCoordinator(cfg clientv3.Config) (*Coordinator, error) {
+	client, err := clientv3.New(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("error in clientv3.New: %w", err)
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	c := &Coordinator{
+		client:  client,
+		prefix:  "/" + utils.GetEnvOrDefault("V_NAMESPACE", "sqlgateway") + "/",
+		stop:    stop,
+		peersMu: &sync.Mutex{},
+		peers:   map[string]*coord.Peer{},
+	}
+
+	joinCtx, cancel := context.WithTimeout(ctx, time.Second*10)
+	defer cancel()
+
+	err = c.putSelf(joinCtx)
+	if err != nil {
+		stop()
+		client.Close()
+		return nil, fmt.Errorf("error in putSelf: %w", err)
+	}
+	rev, err := c.loadPeers(joinCtx)
+	if err != nil {
+		stop()
+		client.Close()
+		return nil, fmt.Errorf("error in loadPeers: %w", err)
+	}
+	logger.Debug().Msg("connected to etcd")
+
+	go c.keepAlive(ctx)
+	go c.watchPeers(ctx, rev)
+
+	return c, nil
+}
+
+func (*Coordinator) Name() string {
+	return "etcd"
+}
+
+func (c *Coordinator) Ping(ctx context.Context) error {
+	// A linearizable read, so this fails without a quorum
+	_, err := c.client.Get(ctx, c.prefix+"ping", clientv3.WithCountOnly())
+	if err != nil {
+		return fmt.Errorf("error in client.Get: %w", err)
+	}
+	return nil
+}
+
+func (c *Coordinator) Shutdown(ctx context.Context) error {
+	logger.Debug().Msg("shutting down etcd client")
+	c.stop()
+
+	// Revoking the lease removes the pod from the cluster
+	c.peersMu.Lock()
+	lease := c.peerLease
+	c.peersMu.Unlock()
+	_, err := c.client.Revoke(ctx, lease)
+	if err != nil {
+		return fmt.Errorf("error in client.Revoke: %w", err)
+	}
+
+	err = c.client.Close()
+	if err != nil {
+		return fmt.Errorf("error in client.Close: %w", err)
+	}
+	return nil
+}
+
+func (c *Coordinator) txKey(txID string) string {
+	return c.prefix + "tx/" + txID
+}
+
+func (c *Coordinator) peerKey(podName string) string {
+	return c.prefix + "peers/" + podName
+}
+
+func (c *Coordinator) runningQueryKey(queryID string) string {
+	return c.prefix + "query/" + queryID
+}
+
+func (c *Coordinator) idempotencyKey(key string) string {
+	return c.prefix + "idempotency/" + key
+}
+
+// grantLease creates a lease that expires after the duration, rounded up to the second
+func (c *Coordinator) grantLease(ctx context.Context, ttl time.Duration) (clientv3.LeaseID, error) {
+	ttlSec := int64(math.Ceil(ttl.Seconds()))
+	if ttlSec < 1 {
+		ttlSec = 1
+	}
+	lease, err := c.client.Grant(ctx, ttlSec)
+	if err != nil {
+		return 0, fmt.Errorf("error in client.Grant: %w", err)
+	}
+	return lease.ID, nil
+}
+
+// putIfNotExists puts the key with a lease that expires after the ttl, only if the key does not exist
+func (c *Coordinator) putIfNotExists(ctx context.Context, key string, val []byte, ttl time.Duration) (bool, error) {
+	lease, err := c.grantLease(ctx, ttl)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := c.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, string(val), clientv3.WithLease(lease))).
+		Commit()
+	if err != nil {
+		return false, fmt.Errorf("error in client.Txn: %w", err)
+	}
+	if !res.Succeeded {
+		c.revokeLease(lease)
+		return false, nil
+	}
+	return true, nil
+}
+
+// putWithTTL puts the key with a lease that expires after the ttl, revoking the lease of the value it replaced
+func (c *Coordinator) putWithTTL(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	lease, err := c.grantLease(ctx, ttl)
+	if err != nil {
+		return err
+	}
+
+	res, err := c.client.Put(ctx, key, string(val), clientv3.WithLease(lease), clientv3.WithPrevKV())
+	if err != nil {
+		c.revokeLease(lease)
+		return fmt.Errorf("error in client.Put: %w", err)
+	}
+	if res.PrevKv != nil {
+		c.revokeLease(clientv3.LeaseID(res.PrevKv.Lease))
+	}
+	return nil
+}
+
+// get returns coord.ErrNotFound if the key does not exist
+func (c *Coordinator) get(ctx context.Context, key string) (*clientv3.GetResponse, error) {
+	res, err := c.client.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("error in client.Get: %w", err)
+	}
+	if len(res.Kvs) == 0 {
+		return nil, coord.ErrNotFound
+	}
+	return res, nil
+}
+
+// delete removes the key, revoking its lease since nothing else is attached to it
+func (c *Coordinator) delete(ctx context.Context, key string) error {
+	res, err := c.client.Delete(ctx, key, clientv3.WithPrevKV())
+	if err != nil {
+		return fmt.Errorf("error in client.Delete: %w", err)
+	}
+	for _, kv := range res.PrevKvs {
+		c.revokeLease(clientv3.LeaseID(kv.Lease))
+	}
+	return nil
+}
+
+// revokeLease revokes a lease that is no longer needed. Failures are only logged, since it will expire anyway.
+func (c *Coordinator) revokeLease(lease clientv3.LeaseID) {
+	if lease == clientv3.NoLease {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	_, err := c.client.Revoke(ctx, lease)
+	if err != nil {
+		logger.Warn().Err(err).Int64("lease", int64(lease)).Msg("error revoking lease")
+	}
+}
+
+func (c *Coordinator) SetTransaction(ctx context.Context, txMeta *coord.TransactionMeta) error {
+	logger := zerolog.Ctx(ctx)
+	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("txID", txMeta.TxID)
+	})
+	logger.Debug().Msg("setting transaction in etcd")
+
+	txMetaBytes, err := json.Marshal(txMeta)
+	if err != nil {
+		return fmt.Errorf("error in json.Marshal: %w", err)
+	}
+
+	set, err := c.putIfNotExists(ctx, c.txKey(txMeta.TxID), txMetaBytes, time.Until(txMeta.Expiry))
+	if err != nil {
+		return fmt.Errorf("error in putIfNotExists: %w", err)
+	}
+	if !set {
+		return coord.ErrTxAlreadyExists
+	}
+	return nil
+}
+
+func (c *Coordinator) GetTransaction(ctx context.Context, txID string) (*coord.TransactionMeta, error) {
+	logger := zerolog.Ctx(ctx)
+	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("txID", txID)
+	})
+	logger.Debug().Msg("getting transaction from etcd")
+
+	res, err := c.get(ctx, c.txKey(txID))
+	if err != nil {
+		return nil, err
+	}
+
+	var txMeta coord.TransactionMeta
+	err = json.Unmarshal(res.Kvs[0].Value, &txMeta)
+	if err != nil {
+		return nil, fmt.Errorf("error in json.Unmarshal: %w", err)
+	}
+	return &txMeta, nil
+}
+
+// ExtendTransaction moves the transaction to a new lease with the new expiry, then revokes the old one
+func (c *Coordinator) ExtendTransaction(ctx context.Context, txID string, expiry time.Time) error {
+	logger := zerolog.Ctx(ctx)
+	logger.Debug().Msg("extending transaction in etcd")
+
+	key := c.txKey(txID)
+	res, err := c.get(ctx, key)
+	if err != nil {
+		return err
+	}
+	kv := res.Kvs[0]
+
+	var txMeta coord.TransactionMeta
+	err = json.Unmarshal(kv.Value, &txMeta)
+	if err != nil {
+		return fmt.Errorf("error in json.Unmarshal: %w", err)
+	}
+	txMeta.Expiry = expiry
+	txMetaBytes, err := json.Marshal(txMeta)
+	if err != nil {
+		return fmt.Errorf("error in json.Marshal: %w", err)
+	}
+
+	lease, err := c.grantLease(ctx, time.Until(expiry))
+	if err != nil {
+		return err
+	}
+	txnRes, err := c.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)).
+		Then(clientv3.OpPut(key, string(txMetaBytes), clientv3.WithLease(lease))).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("error in client.Txn: %w", err)
+	}
+	if !txnRes.Succeeded {
+		c.revokeLease(lease)
+		return fmt.Errorf("transaction changed while extending: %w", coord.ErrNotFound)
+	}
+
+	c.revokeLease(clientv3.LeaseID(kv.Lease))
+	return nil
+}
+
+func (c *Coordinator) DeleteTransaction(ctx context.Context, txID string) error {
+	return c.delete(ctx, c.txKey(txID))
+}
+
+func (c *Coordinator) ListTransactions(ctx context.Context) ([]*coord.TransactionMeta, error) {
+	logger := zerolog.Ctx(ctx)
+	logger.Debug().Msg("listing transactions in etcd")
+
+	res, err := c.client.Get(ctx, c.txKey(""), clientv3.WithPrefix())
+	if err != nil {
+		return nil, fmt.Errorf("error in client.Get: %w", err)
+	}
+
+	txMetas := make([]*coord.TransactionMeta, 0, len(res.Kvs))
+	for _, kv := range res.Kvs {
+		var txMeta coord.TransactionMeta
+		err = json.Unmarshal(kv.Value, &txMeta)
+		if err != nil {
+			return nil, fmt.Errorf("error in json.Unmarshal: %w", err)
+		}
+		txMetas = append(txMetas, &txMeta)
+	}
+	return txMetas, nil
+}
+
+func (c *Coordinator) DeleteTransactionsForPod(ctx context.Context, podName string) (int, error) {
+	txMetas, err := c.ListTransactions(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error in ListTransactions: %w", err)
+	}
+
+	deleted := 0
+	for _, txMeta := range txMetas {
+		if txMeta.PodID != podName {
+			continue
+		}
+		err = c.DeleteTransaction(ctx, txMeta.TxID)
+		if err != nil {
+			return deleted, fmt.Errorf("error in DeleteTransaction: %w", err)
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+// putSelf puts this pod's peer key with a new lease of PEER_TTL_SEC
+func (c *Coordinator) putSelf(ctx context.Context) error {
+	lease, err := c.grantLease(ctx, time.Second*time.Duration(utils.PEER_TTL_SEC))
+	if err != nil {
+		return err
+	}
+
+	peerBytes, err := json.Marshal(&coord.Peer{
+		PodName:    utils.POD_NAME,
+		PodURL:     utils.GetPodURL(),
+		LastUpdate: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("error in json.Marshal: %w", err)
+	}
+
+	_, err = c.client.Put(ctx, c.peerKey(utils.POD_NAME), string(peerBytes), clientv3.WithLease(lease))
+	if err != nil {
+		return fmt.Errorf("error in client.Put: %w", err)
+	}
+
+	c.peersMu.Lock()
+	c.peerLease = lease
+	c.peersMu.Unlock()
+	return nil
+}
+
+// keepAlive keeps the peer lease alive, rejoining if it is lost (e.g. after a long partition from etcd)
+func (c *Coordinator) keepAlive(ctx context.Context) {
+	for {
+		c.peersMu.Lock()
+		lease := c.peerLease
+		c.peersMu.Unlock()
+
+		ch, err := c.client.KeepAlive(ctx, lease)
+		if err != nil {
+			logger.Error().Err(err).Msg("error in client.KeepAlive")
+		} else {
+			for range ch {
+				// Drain the responses until the lease is lost or we are stopped
+			}
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		logger.Warn().Msg("lost etcd peer lease, rejoining")
+		select {
+		case <-time.After(time.Second * time.Duration(utils.PEER_HEARTBEAT_SEC)):
+		case <-ctx.Done():
+			return
+		}
+		putCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+		err = c.putSelf(putCtx)
+		cancel()
+		if err != nil {
+			logger.Error().Err(err).Msg("error in putSelf")
+		}
+	}
+}
+
+// loadPeers replaces the cached peers with the ones in etcd, returning the revision they were read at
+func (c *Coordinator) loadPeers(ctx context.Context) (int64, error) {
+	peers, rev, err := c.getPeers(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	c.peersMu.Lock()
+	defer c.peersMu.Unlock()
+	c.peers = peers
+	c.peersUpdated = time.Now()
+	return rev, nil
+}
+
+// watchPeers keeps the cached peers up to date, reloading them if the watch fails
+func (c *Coordinator) watchPeers(ctx context.Context, rev int64) {
+	for {
+		watchChan := c.client.Watch(ctx, c.peerKey(""), clientv3.WithPrefix(), clientv3.WithRev(rev+1))
+		for res := range watchChan {
+			if err := res.Err(); err != nil {
+				logger.Warn().Err(err).Msg("error watching etcd peers")
+				break
+			}
+			c.applyPeerEvents(res.Events)
+			rev = res.Header.Revision
+		}
+		if ctx.Err() != nil {
+			return
+		}
+
+		select {
+		case <-time.After(time.Second * time.Duration(utils.PEER_HEARTBEAT_SEC)):
+		case <-ctx.Done():
+			return
+		}
+		loadCtx, cancel := context.WithTimeout(ctx, time.Second*5)
+		newRev, err := c.loadPeers(loadCtx)
+		cancel()
+		if err != nil {
+			logger.Error().Err(err).Msg("error in loadPeers")
+			continue
+		}
+		rev = newRev
+	}
+}
+
+func (c *Coordinator) applyPeerEvents(events []*clientv3.Event) {
+	c.peersMu.Lock()
+	defer c.peersMu.Unlock()
+
+	for _, event := range events {
+		podName := strings.TrimPrefix(string(event.Kv.Key), c.peerKey(""))
+		if event.Type == clientv3.EventTypeDelete {
+			logger.Debug().Str("peer", podName).Msg("peer left")
+			delete(c.peers, podName)
+			continue
+		}
+
+		var peer coord.Peer
+		err := json.Unmarshal(event.Kv.Value, &peer)
+		if err != nil {
+			logger.Error().Err(err).Str("peer", podName).Msg("error in json.Unmarshal for peer")
+			continue
+		}
+		logger.Debug().Str("peer", podName).Msg("peer joined")
+		peer.LastUpdate = time.Now()
+		c.peers[podName] = &peer
+	}
+	c.peersUpdated = time.Now()
+}
+
+func (c *Coordinator) getPeers(ctx context.Context) (map[string]*coord.Peer, int64, error) {
+	res, err := c.client.Get(ctx, c.peerKey(""), clientv3.WithPrefix())
+	if err != nil {
+		return nil, 0, fmt.Errorf("error in client.Get: %w", err)
+	}
+
+	peers := make(map[string]*coord.Peer, len(res.Kvs))
+	for _, kv := range res.Kvs {
+		var peer coord.Peer
+		err = json.Unmarshal(kv.Value, &peer)
+		if err != nil {
+			return nil, 0, fmt.Errorf("error in json.Unmarshal: %w", err)
+		}
+		// The key only exists while the peer keeps its lease alive
+		peer.LastUpdate = time.Now()
+		peers[strings.TrimPrefix(string(kv.Key), c.peerKey(""))] = &peer
+	}
+	return peers, res.Header.Revision, nil
+}
+
+func (c *Coordinator) GetPeers(ctx context.Context) (map[string]*coord.Peer, error) {
+	peers, _, err := c.getPeers(ctx)
+	return peers, err
+}
+
+func (c *Coordinator) CachedPeers() []*coord.Peer {
+	c.peersMu.Lock()
+	defer c.peersMu.Unlock()
+
+	peers := make([]*coord.Peer, 0, len(c.peers))
+	for _, peer := range c.peers {
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].PodName < peers[j].PodName
+	})
+	return peers
+}
+
+func (c *Coordinator) CachedPeersUpdated() time.Time {
+	c.peersMu.Lock()
+	defer c.peersMu.Unlock()
+	return c.peersUpdated
+}
+
+func (c *Coordinator) RemovePeer(ctx context.Context, podName string) error {
+	return c.delete(ctx, c.peerKey(podName))
+}
+
+func (c *Coordinator) SetRunningQuery(ctx context.Context, queryMeta *coord.RunningQueryMeta, ttl time.Duration) error {
+	queryMetaBytes, err := json.Marshal(queryMeta)
+	if err != nil {
+		return fmt.Errorf("error in json.Marshal: %w", err)
+	}
+	return c.putWithTTL(ctx, c.runningQueryKey(queryMeta.QueryID), queryMetaBytes, ttl)
+}
+
+func (c *Coordinator) GetRunningQuery(ctx context.Context, queryID string) (*coord.RunningQueryMeta, error) {
+	res, err := c.get(ctx, c.runningQueryKey(queryID))
+	if err != nil {
+		return nil, err
+	}
+
+	var queryMeta coord.RunningQueryMeta
+	err = json.Unmarshal(res.Kvs[0].Value, &queryMeta)
+	if err != nil {
+		return nil, fmt.Errorf("error in json.Unmarshal: %w", err)
+	}
+	return &queryMeta, nil
+}
+
+func (c *Coordinator) DeleteRunningQuery(ctx context.Context, queryID string) error {
+	return c.delete(ctx, c.runningQueryKey(queryID))
+}
+
+func (c *Coordinator) ReserveIdempotencyKey(ctx context.Context, key string, val []byte, ttl time.Duration) (bool, error) {
+	return c.putIfNotExists(ctx, c.idempotencyKey(key), val, ttl)
+}
+
+func (c *Coordinator) SetIdempotencyKey(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	return c.putWithTTL(ctx, c.idempotencyKey(key), val, ttl)
+}
+
+func (c *Coordinator) GetIdempotencyKey(ctx context.Context, key string) ([]byte, error) {
+	res, err := c.get(ctx, c.idempotencyKey(key))
+	if err != nil {
+		return nil, err
+	}
+	return res.Kvs[0].Value, nil
+}
+
+func (c *Coordinator) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	return c.delete(ctx, c.idempotencyKey(key))
+}
@@ -0,0 +1,213 @@
+package etcd
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/coord"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+func freeURL(t *testing.T) url.URL {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+// startEtcd starts a single node etcd server for the test, returning a coordinator connected to it
+func startEtcd(t *testing.T) *Coordinator {
+	t.Helper()
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	clientURL, peerURL := freeURL(t), freeURL(t)
+	cfg.ListenClientUrls = []url.URL{clientURL}
+	cfg.AdvertiseClientUrls = []url.URL{clientURL}
+	cfg.ListenPeerUrls = []url.URL{peerURL}
+	cfg.AdvertisePeerUrls = []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(e.Close)
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(time.Second * 10):
+		t.Fatal("timed out waiting for etcd to start")
+	}
+
+	c, err := NewCoordinator(clientv3.Config{
+		Endpoints:   []string{clientURL.String()},
+		DialTimeout: time.Second * 5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		c.Shutdown(context.Background())
+	})
+	return c
+}
+
+func TestTransactions(t *testing.T) {
+	ctx := context.Background()
+	c := startEtcd(t)
+
+	_, err := c.GetTransaction(ctx, "test")
+	if !errors.Is(err, coord.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+
+	txMeta := &coord.TransactionMeta{
+		TxID:   "test",
+		PodID:  "testpod",
+		PodURL: "localhost:8080",
+		Expiry: time.Now().Add(time.Second * 10),
+	}
+	err = c.SetTransaction(ctx, txMeta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.SetTransaction(ctx, txMeta)
+	if !errors.Is(err, coord.ErrTxAlreadyExists) {
+		t.Fatalf("expected ErrTxAlreadyExists, got %v", err)
+	}
+
+	txBack, err := c.GetTransaction(ctx, txMeta.TxID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if txBack.PodID != txMeta.PodID || txBack.PodURL != txMeta.PodURL {
+		t.Fatalf("got back a different transaction: %+v", txBack)
+	}
+
+	expiry := time.Now().Add(time.Minute)
+	err = c.ExtendTransaction(ctx, txMeta.TxID, expiry)
+	if err != nil {
+		t.Fatal(err)
+	}
+	txBack, err = c.GetTransaction(ctx, txMeta.TxID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !txBack.Expiry.Equal(expiry) {
+		t.Fatalf("expected expiry %s, got %s", expiry, txBack.Expiry)
+	}
+
+	deleted, err := c.DeleteTransactionsForPod(ctx, "otherpod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if deleted != 0 {
+		t.Fatalf("expected no transactions deleted for another pod, got %d", deleted)
+	}
+
+	err = c.DeleteTransaction(ctx, txMeta.TxID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = c.ExtendTransaction(ctx, txMeta.TxID, expiry)
+	if !errors.Is(err, coord.ErrNotFound) {
+		t.Fatalf("expected ErrNotFound extending a deleted transaction, got %v", err)
+	}
+	txMetas, err := c.ListTransactions(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(txMetas) != 0 {
+		t.Fatalf("expected no transactions, got %+v", txMetas)
+	}
+}
+
+func TestPeers(t *testing.T) {
+	ctx := context.Background()
+	c := startEtcd(t)
+
+	peers := c.CachedPeers()
+	if len(peers) != 1 || peers[0].PodName != utils.POD_NAME {
+		t.Fatalf("expected only this pod in the peers, got %+v", peers)
+	}
+
+	// Another pod joining should show up through the watch
+	_, err := c.client.Put(ctx, c.peerKey("otherpod"), `{"PodName":"otherpod","PodURL":"otherpod:8080"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second * 5)
+	for len(c.CachedPeers()) != 2 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for peer to join, got %+v", c.CachedPeers())
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+
+	err = c.RemovePeer(ctx, "otherpod")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline = time.Now().Add(time.Second * 5)
+	for len(c.CachedPeers()) != 1 {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for peer to leave, got %+v", c.CachedPeers())
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestReserveIdempotencyKey(t *testing.T) {
+	ctx := context.Background()
+	c := startEtcd(t)
+
+	reserved, err := c.ReserveIdempotencyKey(ctx, "key", []byte("pending"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reserved {
+		t.Fatal("expected the first reservation to succeed")
+	}
+	reserved, err = c.ReserveIdempotencyKey(ctx, "key", []byte("pending"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reserved {
+		t.Fatal("expected the second reservation to fail")
+	}
+
+	err = c.SetIdempotencyKey(ctx, "key", []byte("done"), time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	val, err := c.GetIdempotencyKey(ctx, "key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(val) != "done" {
+		t.Fatalf("expected done, got %s", val)
+	}
+
+	// Overwriting revokes the lease of the reservation, leaving the peer lease and the lease of the stored value
+	for i := 0; i < 3; i++ {
+		if err := c.SetIdempotencyKey(ctx, "key", []byte("done"), time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+	leases, err := c.client.Leases(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(leases.Leases) != 2 {
+		t.Fatalf("expected 2 leases, got %d", len(leases.Leases))
+	}
+}
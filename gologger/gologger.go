@@ -16,11 +16,14 @@ const ReqIDKey ctxKey = "reqID"
 
 type (
 	Action struct {
-		DurationNS int64
-		Statement  string `json:",omitempty"`
-		Error      string `json:",omitempty"`
-		Exec       bool   `json:",omitempty"`
-		NumRows    *int   `json:",omitempty"`
+		DurationNS   int64
+		Statement    string `json:",omitempty"`
+		Error        string `json:",omitempty"`
+		ErrorCode    string `json:",omitempty"`
+		Exec         bool   `json:",omitempty"`
+		NumRows      *int   `json:",omitempty"`
+		CommandTag   string `json:",omitempty"`
+		RowsAffected *int64 `json:",omitempty"`
 	}
 )
 
@@ -0,0 +1,95 @@
+package grpc_server
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/danthegoodman1/SQLGateway/grpc_server/pb"
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func queryReq(q *pb.QueryReq) *pg.QueryReq {
+	req := &pg.QueryReq{
+		Statement: q.Statement,
+		Params:    make([]any, len(q.Params)),
+	}
+	for i, param := range q.Params {
+		req.Params[i] = param.AsInterface()
+	}
+	if q.Exec {
+		req.Exec = utils.Ptr(true)
+	}
+	return req
+}
+
+func beginRequest(req *pb.BeginRequest) *pg.BeginRequest {
+	return &pg.BeginRequest{
+		TxTimeoutSec:   req.TxTimeoutSec,
+		TimeoutMS:      req.TimeoutMs,
+		IsoLevel:       req.IsoLevel,
+		AccessMode:     req.AccessMode,
+		DeferrableMode: req.DeferrableMode,
+		AsOfSystemTime: req.AsOfSystemTime,
+	}
+}
+
+func pbQueryRes(res *pg.QueryRes) (*pb.QueryRes, error) {
+	rows, err := listValues(res.Rows)
+	if err != nil {
+		return nil, err
+	}
+	return &pb.QueryRes{
+		Columns:      columns(res.Columns),
+		Rows:         rows,
+		Error:        pbQueryError(res.PGError),
+		TimeNs:       res.TimeNS,
+		CommandTag:   res.CommandTag,
+		RowsAffected: res.RowsAffected,
+	}, nil
+}
+
+func pbQueryError(err *pg.QueryError) *pb.QueryError {
+	if err == nil {
+		return nil
+	}
+	return &pb.QueryError{
+		Message:    err.Message,
+		Class:      err.Class,
+		Code:       err.Code,
+		Severity:   err.Severity,
+		Detail:     err.Detail,
+		Hint:       err.Hint,
+		Constraint: err.Constraint,
+		Table:      err.Table,
+		Column:     err.Column,
+		Position:   err.Position,
+		Where:      err.Where,
+	}
+}
+
+func columns(cols []any) []string {
+	names := make([]string, len(cols))
+	for i, col := range cols {
+		names[i] = fmt.Sprint(col)
+	}
+	return names
+}
+
+// listValues converts rows to the values they would have in the JSON API, so e.g. timestamps are strings
+func listValues(rows [][]any) ([]*structpb.ListValue, error) {
+	values := make([]*structpb.ListValue, len(rows))
+	for i, row := range rows {
+		b, err := json.Marshal(row)
+		if err != nil {
+			return nil, fmt.Errorf("error in json.Marshal: %w", err)
+		}
+		values[i] = &structpb.ListValue{}
+		if err := protojson.Unmarshal(b, values[i]); err != nil {
+			return nil, fmt.Errorf("error in protojson.Unmarshal: %w", err)
+		}
+	}
+	return values, nil
+}
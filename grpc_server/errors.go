@@ -0,0 +1,100 @@
+package grpc_server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/danthegoodman1/SQLGateway/gologger"
+	"github.com/danthegoodman1/SQLGateway/http_server"
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/rs/zerolog"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorDomain is the domain of the ErrorInfo detail of every gateway error
+const ErrorDomain = "sqlgateway"
+
+// errorStatus returns a status for the error code of the HTTP API, with an ErrorInfo detail that has the code as its
+// reason, and the request ID and pod as metadata
+func errorStatus(ctx context.Context, httpStatus int, code, msg string) error {
+	reqID, _ := ctx.Value(gologger.ReqIDKey).(string)
+	return remoteErrorStatus(httpStatus, http_server.ErrorResponse{
+		Code:      code,
+		Message:   msg,
+		RequestID: reqID,
+		Pod:       utils.POD_NAME,
+	})
+}
+
+// remoteErrorStatus returns a status for an error response, which may have been relayed from a remote pod
+func remoteErrorStatus(httpStatus int, errRes http_server.ErrorResponse) error {
+	st := status.New(grpcCode(httpStatus), errRes.Message)
+	withDetails, err := st.WithDetails(&errdetails.ErrorInfo{
+		Reason: errRes.Code,
+		Domain: ErrorDomain,
+		Metadata: map[string]string{
+			"request_id": errRes.RequestID,
+			"pod":        errRes.Pod,
+		},
+	})
+	if err != nil {
+		return st.Err()
+	}
+	return withDetails.Err()
+}
+
+func validationError(ctx context.Context, msg string) error {
+	return errorStatus(ctx, http.StatusBadRequest, http_server.ErrCodeValidation, msg)
+}
+
+// distributedError returns the status for a *pg.DistributedError, relaying remote errors as-is
+func distributedError(ctx context.Context, err *pg.DistributedError, msg string) error {
+	if err.Remote {
+		var remoteErr http_server.ErrorResponse
+		if jsonErr := json.Unmarshal([]byte(err.ErrString), &remoteErr); jsonErr == nil && remoteErr.Code != "" {
+			return remoteErrorStatus(err.StatusCode, remoteErr)
+		}
+		return errorStatus(ctx, err.StatusCode, http_server.ErrCodeRemoteError, err.ErrString)
+	}
+	if httpStatus, code, errMsg, ok := http_server.ErrorCode(err.Err); ok {
+		return errorStatus(ctx, httpStatus, code, errMsg)
+	}
+	return internalError(ctx, err.Err, msg)
+}
+
+func internalError(ctx context.Context, err error, msg string) error {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		zerolog.Ctx(ctx).Warn().CallerSkipFrame(1).Msg(err.Error())
+	} else {
+		zerolog.Ctx(ctx).Error().CallerSkipFrame(1).Err(err).Msg(msg)
+	}
+	return errorStatus(ctx, http.StatusInternalServerError, http_server.ErrCodeInternal, "internal error")
+}
+
+// grpcCode maps the status the HTTP API would respond with to a gRPC code
+func grpcCode(httpStatus int) codes.Code {
+	switch httpStatus {
+	case http.StatusBadRequest:
+		return codes.InvalidArgument
+	case http.StatusUnauthorized:
+		return codes.Unauthenticated
+	case http.StatusNotFound:
+		return codes.NotFound
+	case http.StatusRequestTimeout, http.StatusGatewayTimeout:
+		return codes.DeadlineExceeded
+	case http.StatusConflict:
+		return codes.Aborted
+	case http.StatusUnprocessableEntity:
+		return codes.FailedPrecondition
+	case http.StatusBadGateway, http.StatusServiceUnavailable:
+		return codes.Unavailable
+	case http.StatusInternalServerError:
+		return codes.Internal
+	}
+	return codes.Unknown
+}
@@ -0,0 +1,149 @@
+package grpc_server
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/gologger"
+	"github.com/danthegoodman1/SQLGateway/grpc_server/pb"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/google/uuid"
+	"github.com/rs/zerolog"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var logger = gologger.NewLogger()
+
+type (
+	// Server implements the SQLGateway gRPC service on top of the same pool and TxManager as the HTTP API
+	Server struct {
+		pb.UnimplementedSQLGatewayServer
+		GRPCServer *grpc.Server
+		validate   *validator.Validate
+	}
+
+	// contextStream overrides the context of a server stream with the one set up by the interceptor
+	contextStream struct {
+		grpc.ServerStream
+		ctx context.Context
+	}
+)
+
+// StartGRPCServer serves the gRPC API on GRPC_PORT
+func StartGRPCServer() (*Server, error) {
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", utils.GRPC_PORT))
+	if err != nil {
+		return nil, fmt.Errorf("error creating tcp listener: %w", err)
+	}
+	s := NewServer()
+
+	go func() {
+		logger.Info().Msg("starting grpc server on " + listener.Addr().String())
+		if err := s.GRPCServer.Serve(listener); err != nil {
+			logger.Error().Err(err).Msg("grpc server stopped")
+		}
+	}()
+	return s, nil
+}
+
+// NewServer creates a server without serving it on a listener
+func NewServer() *Server {
+	s := &Server{
+		validate: validator.New(),
+	}
+	s.GRPCServer = grpc.NewServer(
+		grpc.UnaryInterceptor(unaryInterceptor),
+		grpc.StreamInterceptor(streamInterceptor),
+	)
+	pb.RegisterSQLGatewayServer(s.GRPCServer, s)
+	return s
+}
+
+// Shutdown waits for running calls to finish, then stops them when the context is done
+func (s *Server) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		s.GRPCServer.GracefulStop()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.GRPCServer.Stop()
+		return ctx.Err()
+	}
+}
+
+func unaryInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	start := time.Now()
+	ctx = createReqContext(ctx)
+	var res any
+	err := authenticate(ctx)
+	if err == nil {
+		res, err = handler(ctx, req)
+	}
+	logCall(ctx, info.FullMethod, start, err)
+	return res, err
+}
+
+func streamInterceptor(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	start := time.Now()
+	ctx := createReqContext(ss.Context())
+	err := authenticate(ctx)
+	if err == nil {
+		err = handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+	logCall(ctx, info.FullMethod, start, err)
+	return err
+}
+
+func (cs *contextStream) Context() context.Context {
+	return cs.ctx
+}
+
+// createReqContext gives the call a request ID and logger, like the HTTP API does for each request
+func createReqContext(ctx context.Context) context.Context {
+	reqID := uuid.NewString()
+	ctx = context.WithValue(ctx, gologger.ReqIDKey, reqID)
+	ctx = logger.WithContext(ctx)
+	zerolog.Ctx(ctx).UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("reqID", reqID)
+	})
+	return ctx
+}
+
+// authenticate checks the Basic auth credentials in the authorization metadata if AUTH_USER and AUTH_PASS are set
+func authenticate(ctx context.Context) error {
+	if utils.AUTH_USER == "" || utils.AUTH_PASS == "" {
+		return nil
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	for _, auth := range md.Get("authorization") {
+		if len(auth) < len("basic ") || !strings.EqualFold(auth[:len("basic ")], "basic ") {
+			continue
+		}
+		b, err := base64.StdEncoding.DecodeString(auth[len("basic "):])
+		if err != nil {
+			continue
+		}
+		username, password, _ := strings.Cut(string(b), ":")
+		if subtle.ConstantTimeCompare([]byte(username), []byte(utils.AUTH_USER)) == 1 && subtle.ConstantTimeCompare([]byte(password), []byte(utils.AUTH_PASS)) == 1 {
+			return nil
+		}
+	}
+	return status.Error(codes.Unauthenticated, "invalid or missing basic auth credentials")
+}
+
+func logCall(ctx context.Context, method string, start time.Time, err error) {
+	zerolog.Ctx(ctx).Debug().Str("method", method).Str("code", status.Code(err).String()).Int64("latency_ns", int64(time.Since(start))).Msg("grpc call")
+}
@@ -0,0 +1,102 @@
+package grpc_server
+
+import (
+	"context"
+	"encoding/base64"
+	"net"
+	"testing"
+
+	"github.com/danthegoodman1/SQLGateway/grpc_server/pb"
+	"github.com/danthegoodman1/SQLGateway/http_server"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T) pb.SQLGatewayClient {
+	listener := bufconn.Listen(1024 * 1024)
+	s := NewServer()
+	go s.GRPCServer.Serve(listener)
+	t.Cleanup(s.GRPCServer.Stop)
+
+	conn, err := grpc.Dial("bufnet", grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+		return listener.DialContext(ctx)
+	}), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		conn.Close()
+	})
+	return pb.NewSQLGatewayClient(conn)
+}
+
+func expectErrorCode(t *testing.T, err error, grpcCode codes.Code, code string) {
+	t.Helper()
+	st := status.Convert(err)
+	if st.Code() != grpcCode {
+		t.Fatalf("expected %s, got %s: %s", grpcCode, st.Code(), st.Message())
+	}
+	if code == "" {
+		return
+	}
+	for _, detail := range st.Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			if info.Reason != code || info.Domain != ErrorDomain || info.Metadata["request_id"] == "" {
+				t.Fatalf("expected %s error info, got %+v", code, info)
+			}
+			return
+		}
+	}
+	t.Fatalf("expected error info detail, got %+v", st.Details())
+}
+
+func TestAuth(t *testing.T) {
+	prevUser, prevPass := utils.AUTH_USER, utils.AUTH_PASS
+	utils.AUTH_USER, utils.AUTH_PASS = "user", "pass"
+	defer func() {
+		utils.AUTH_USER, utils.AUTH_PASS = prevUser, prevPass
+	}()
+	client := newTestClient(t)
+
+	_, err := client.Commit(context.Background(), &pb.TxRequest{})
+	expectErrorCode(t, err, codes.Unauthenticated, "")
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("user:wrong")))
+	_, err = client.Commit(ctx, &pb.TxRequest{})
+	expectErrorCode(t, err, codes.Unauthenticated, "")
+
+	// Authenticated requests get to validation
+	ctx = metadata.AppendToOutgoingContext(context.Background(), "authorization", "Basic "+base64.StdEncoding.EncodeToString([]byte("user:pass")))
+	_, err = client.Commit(ctx, &pb.TxRequest{})
+	expectErrorCode(t, err, codes.InvalidArgument, http_server.ErrCodeValidation)
+
+	stream, err := client.QueryStream(context.Background(), &pb.QueryStreamRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	expectErrorCode(t, err, codes.Unauthenticated, "")
+}
+
+func TestValidation(t *testing.T) {
+	client := newTestClient(t)
+
+	_, err := client.Begin(context.Background(), &pb.BeginRequest{IsoLevel: utils.Ptr("nope")})
+	expectErrorCode(t, err, codes.InvalidArgument, http_server.ErrCodeValidation)
+
+	_, err = client.Query(context.Background(), &pb.QueryRequest{QueryId: utils.Ptr("")})
+	expectErrorCode(t, err, codes.InvalidArgument, http_server.ErrCodeValidation)
+
+	stream, err := client.QueryStream(context.Background(), &pb.QueryStreamRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = stream.Recv()
+	expectErrorCode(t, err, codes.InvalidArgument, http_server.ErrCodeValidation)
+}
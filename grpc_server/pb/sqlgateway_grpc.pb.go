@@ -0,0 +1,287 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.2.0
+// - protoc             v3.21.12
+// source: sqlgateway.proto
+
+package pb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+// SQLGatewayClient is the client API for SQLGateway service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type SQLGatewayClient interface {
+	// Query mirrors POST /psql/query
+	Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryResponse, error)
+	// QueryStream runs a single query, streaming its rows in batches as they are read
+	QueryStream(ctx context.Context, in *QueryStreamRequest, opts ...grpc.CallOption) (SQLGateway_QueryStreamClient, error)
+	// Begin mirrors POST /psql/begin
+	Begin(ctx context.Context, in *BeginRequest, opts ...grpc.CallOption) (*BeginResponse, error)
+	// Commit mirrors POST /psql/commit
+	Commit(ctx context.Context, in *TxRequest, opts ...grpc.CallOption) (*TxResponse, error)
+	// Rollback mirrors POST /psql/rollback
+	Rollback(ctx context.Context, in *TxRequest, opts ...grpc.CallOption) (*TxResponse, error)
+}
+
+type sQLGatewayClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewSQLGatewayClient(cc grpc.ClientConnInterface) SQLGatewayClient {
+	return &sQLGatewayClient{cc}
+}
+
+func (c *sQLGatewayClient) Query(ctx context.Context, in *QueryRequest, opts ...grpc.CallOption) (*QueryResponse, error) {
+	out := new(QueryResponse)
+	err := c.cc.Invoke(ctx, "/sqlgateway.v1.SQLGateway/Query", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sQLGatewayClient) QueryStream(ctx context.Context, in *QueryStreamRequest, opts ...grpc.CallOption) (SQLGateway_QueryStreamClient, error) {
+	stream, err := c.cc.NewStream(ctx, &SQLGateway_ServiceDesc.Streams[0], "/sqlgateway.v1.SQLGateway/QueryStream", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &sQLGatewayQueryStreamClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type SQLGateway_QueryStreamClient interface {
+	Recv() (*QueryStreamResponse, error)
+	grpc.ClientStream
+}
+
+type sQLGatewayQueryStreamClient struct {
+	grpc.ClientStream
+}
+
+func (x *sQLGatewayQueryStreamClient) Recv() (*QueryStreamResponse, error) {
+	m := new(QueryStreamResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *sQLGatewayClient) Begin(ctx context.Context, in *BeginRequest, opts ...grpc.CallOption) (*BeginResponse, error) {
+	out := new(BeginResponse)
+	err := c.cc.Invoke(ctx, "/sqlgateway.v1.SQLGateway/Begin", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sQLGatewayClient) Commit(ctx context.Context, in *TxRequest, opts ...grpc.CallOption) (*TxResponse, error) {
+	out := new(TxResponse)
+	err := c.cc.Invoke(ctx, "/sqlgateway.v1.SQLGateway/Commit", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sQLGatewayClient) Rollback(ctx context.Context, in *TxRequest, opts ...grpc.CallOption) (*TxResponse, error) {
+	out := new(TxResponse)
+	err := c.cc.Invoke(ctx, "/sqlgateway.v1.SQLGateway/Rollback", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// SQLGatewayServer is the server API for SQLGateway service.
+// All implementations must embed UnimplementedSQLGatewayServer
+// for forward compatibility
+type SQLGatewayServer interface {
+	// Query mirrors POST /psql/query
+	Query(context.Context, *QueryRequest) (*QueryResponse, error)
+	// QueryStream runs a single query, streaming its rows in batches as they are read
+	QueryStream(*QueryStreamRequest, SQLGateway_QueryStreamServer) error
+	// Begin mirrors POST /psql/begin
+	Begin(context.Context, *BeginRequest) (*BeginResponse, error)
+	// Commit mirrors POST /psql/commit
+	Commit(context.Context, *TxRequest) (*TxResponse, error)
+	// Rollback mirrors POST /psql/rollback
+	Rollback(context.Context, *TxRequest) (*TxResponse, error)
+	mustEmbedUnimplementedSQLGatewayServer()
+}
+
+// UnimplementedSQLGatewayServer must be embedded to have forward compatible implementations.
+type UnimplementedSQLGatewayServer struct {
+}
+
+func (UnimplementedSQLGatewayServer) Query(context.Context, *QueryRequest) (*QueryResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Query not implemented")
+}
+func (UnimplementedSQLGatewayServer) QueryStream(*QueryStreamRequest, SQLGateway_QueryStreamServer) error {
+	return status.Errorf(codes.Unimplemented, "method QueryStream not implemented")
+}
+func (UnimplementedSQLGatewayServer) Begin(context.Context, *BeginRequest) (*BeginResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Begin not implemented")
+}
+func (UnimplementedSQLGatewayServer) Commit(context.Context, *TxRequest) (*TxResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Commit not implemented")
+}
+func (UnimplementedSQLGatewayServer) Rollback(context.Context, *TxRequest) (*TxResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Rollback not implemented")
+}
+func (UnimplementedSQLGatewayServer) mustEmbedUnimplementedSQLGatewayServer() {}
+
+// UnsafeSQLGatewayServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to SQLGatewayServer will
+// result in compilation errors.
+type UnsafeSQLGatewayServer interface {
+	mustEmbedUnimplementedSQLGatewayServer()
+}
+
+func RegisterSQLGatewayServer(s grpc.ServiceRegistrar, srv SQLGatewayServer) {
+	s.RegisterService(&SQLGateway_ServiceDesc, srv)
+}
+
+func _SQLGateway_Query_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(QueryRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SQLGatewayServer).Query(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sqlgateway.v1.SQLGateway/Query",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SQLGatewayServer).Query(ctx, req.(*QueryRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SQLGateway_QueryStream_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(QueryStreamRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SQLGatewayServer).QueryStream(m, &sQLGatewayQueryStreamServer{stream})
+}
+
+type SQLGateway_QueryStreamServer interface {
+	Send(*QueryStreamResponse) error
+	grpc.ServerStream
+}
+
+type sQLGatewayQueryStreamServer struct {
+	grpc.ServerStream
+}
+
+func (x *sQLGatewayQueryStreamServer) Send(m *QueryStreamResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _SQLGateway_Begin_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(BeginRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SQLGatewayServer).Begin(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sqlgateway.v1.SQLGateway/Begin",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SQLGatewayServer).Begin(ctx, req.(*BeginRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SQLGateway_Commit_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TxRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SQLGatewayServer).Commit(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sqlgateway.v1.SQLGateway/Commit",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SQLGatewayServer).Commit(ctx, req.(*TxRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SQLGateway_Rollback_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(TxRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SQLGatewayServer).Rollback(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/sqlgateway.v1.SQLGateway/Rollback",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SQLGatewayServer).Rollback(ctx, req.(*TxRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// SQLGateway_ServiceDesc is the grpc.ServiceDesc for SQLGateway service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var SQLGateway_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "sqlgateway.v1.SQLGateway",
+	HandlerType: (*SQLGatewayServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Query",
+			Handler:    _SQLGateway_Query_Handler,
+		},
+		{
+			MethodName: "Begin",
+			Handler:    _SQLGateway_Begin_Handler,
+		},
+		{
+			MethodName: "Commit",
+			Handler:    _SQLGateway_Commit_Handler,
+		},
+		{
+			MethodName: "Rollback",
+			Handler:    _SQLGateway_Rollback_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "QueryStream",
+			Handler:       _SQLGateway_QueryStream_Handler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "sqlgateway.proto",
+}
@@ -0,0 +1,189 @@
+package grpc_server
+
+import (
+	"context"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/grpc_server/pb"
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/rs/zerolog"
+)
+
+// rowBatchSize is how many rows QueryStream sends per message
+const rowBatchSize = 500
+
+func (s *Server) Query(ctx context.Context, req *pb.QueryRequest) (*pb.QueryResponse, error) {
+	body := pg.QueryRequest{
+		Queries:        make([]*pg.QueryReq, len(req.Queries)),
+		TxID:           req.TxId,
+		IdempotencyKey: req.IdempotencyKey,
+		QueryID:        req.QueryId,
+		TimeoutMS:      req.TimeoutMs,
+	}
+	for i, query := range req.Queries {
+		body.Queries[i] = queryReq(query)
+	}
+	if err := s.validate.Struct(&body); err != nil {
+		return nil, validationError(ctx, err.Error())
+	}
+
+	logger := zerolog.Ctx(ctx)
+	if body.TxID != nil {
+		logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+			return c.Str("txID", *body.TxID)
+		})
+	}
+
+	runQuery := func() (*pg.QueryResponse, *pg.DistributedError) {
+		return pg.Query(ctx, pg.PGPool, &body)
+	}
+
+	var res *pg.QueryResponse
+	var dErr *pg.DistributedError
+	if body.IdempotencyKey != nil {
+		res, dErr = pg.RunIdempotent(ctx, &body, runQuery)
+	} else {
+		res, dErr = runQuery()
+	}
+	if dErr != nil {
+		return nil, distributedError(ctx, dErr, "error handling query")
+	}
+
+	pbRes := &pb.QueryResponse{
+		Queries:               make([]*pb.QueryRes, len(res.Queries)),
+		Remote:                res.Remote,
+		IdempotentReplay:      res.IdempotentReplay,
+		RolledBackToSavepoint: res.RolledBackToSavepoint,
+	}
+	for i, queryRes := range res.Queries {
+		if queryRes == nil {
+			continue
+		}
+		var err error
+		pbRes.Queries[i], err = pbQueryRes(queryRes)
+		if err != nil {
+			return nil, internalError(ctx, err, "error converting query result")
+		}
+	}
+	return pbRes, nil
+}
+
+// QueryStream sends the rows of a query in batches as they are read from the database. Queries in transactions on
+// remote pods are forwarded over HTTP, so their rows are only sent once the query finishes.
+func (s *Server) QueryStream(req *pb.QueryStreamRequest, stream pb.SQLGateway_QueryStreamServer) error {
+	ctx := stream.Context()
+	if req.Query == nil {
+		return validationError(ctx, "no query provided")
+	}
+	body := pg.QueryRequest{
+		Queries:   []*pg.QueryReq{queryReq(req.Query)},
+		TxID:      req.TxId,
+		QueryID:   req.QueryId,
+		TimeoutMS: req.TimeoutMs,
+	}
+	if err := s.validate.Struct(&body); err != nil {
+		return validationError(ctx, err.Error())
+	}
+
+	logger := zerolog.Ctx(ctx)
+	if body.TxID != nil {
+		logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+			return c.Str("txID", *body.TxID)
+		})
+	}
+
+	// Stop the query if the client goes away or can't be sent to
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sentColumns := false
+	var sendErr error
+	send := func(msg *pb.QueryStreamResponse, cols []any, rows [][]any) {
+		if sendErr != nil {
+			return
+		}
+		if !sentColumns {
+			msg.Columns = columns(cols)
+			sentColumns = true
+		}
+		msg.Rows, sendErr = listValues(rows)
+		if sendErr == nil {
+			sendErr = stream.Send(msg)
+		}
+		if sendErr != nil {
+			cancel()
+		}
+	}
+
+	ctx = pg.WithRowBatches(ctx, rowBatchSize, func(cols []any, rows [][]any) {
+		send(&pb.QueryStreamResponse{}, cols, rows)
+	})
+	res, dErr := pg.Query(ctx, pg.PGPool, &body)
+	if dErr != nil {
+		return distributedError(ctx, dErr, "error handling query stream")
+	}
+
+	// Forwarded queries have all of their rows
+	queryRes := res.Queries[0]
+	rows := queryRes.Rows
+	for len(rows) > rowBatchSize {
+		send(&pb.QueryStreamResponse{}, queryRes.Columns, rows[:rowBatchSize])
+		rows = rows[rowBatchSize:]
+	}
+	send(&pb.QueryStreamResponse{
+		Error:                 pbQueryError(queryRes.PGError),
+		TimeNs:                queryRes.TimeNS,
+		CommandTag:            queryRes.CommandTag,
+		RowsAffected:          queryRes.RowsAffected,
+		Remote:                res.Remote,
+		RolledBackToSavepoint: res.RolledBackToSavepoint,
+	}, queryRes.Columns, rows)
+	if sendErr != nil {
+		return internalError(ctx, sendErr, "error sending query stream")
+	}
+	return nil
+}
+
+func (s *Server) Begin(ctx context.Context, req *pb.BeginRequest) (*pb.BeginResponse, error) {
+	body := beginRequest(req)
+	if err := s.validate.Struct(body); err != nil {
+		return nil, validationError(ctx, err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+
+	txID, err := pg.Manager.NewTx(ctx, body)
+	if err != nil {
+		return nil, distributedError(ctx, &pg.DistributedError{Err: err}, "error creating new transaction")
+	}
+	return &pb.BeginResponse{TxId: txID}, nil
+}
+
+func (s *Server) Commit(ctx context.Context, req *pb.TxRequest) (*pb.TxResponse, error) {
+	if req.TxId == "" {
+		return nil, validationError(ctx, "tx_id is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+
+	if err := pg.Manager.CommitTx(ctx, req.TxId); err != nil {
+		return nil, distributedError(ctx, err, "error committing transaction")
+	}
+	return &pb.TxResponse{}, nil
+}
+
+func (s *Server) Rollback(ctx context.Context, req *pb.TxRequest) (*pb.TxResponse, error) {
+	if req.TxId == "" {
+		return nil, validationError(ctx, "tx_id is required")
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+
+	if err := pg.Manager.RollbackTx(ctx, req.TxId); err != nil {
+		return nil, distributedError(ctx, err, "error rolling back transaction")
+	}
+	return &pb.TxResponse{}, nil
+}
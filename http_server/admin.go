@@ -0,0 +1,171 @@
+package http_server
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/coord"
+	"github.com/danthegoodman1/SQLGateway/ksd"
+	"github.com/danthegoodman1/SQLGateway/peer"
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+)
+
+type (
+	PeersResponse struct {
+		Clustered bool
+		// Where the peers were discovered from: kubernetes, redis, etcd, or local
+		Source PeerSource
+		// When this pod last refreshed its local peer list
+		CacheUpdated *time.Time `json:",omitempty"`
+		Peers        []*PeerInfo
+	}
+
+	PeerInfo struct {
+		PodName string
+		PodURL  string
+		// The last heartbeat, or when the pod last changed for kubernetes
+		LastUpdate time.Time
+		// Whether the peer has heartbeated within PEER_TTL_SEC (unhealthy peers are evicted on the next heartbeat), or
+		// whether the pod is ready for kubernetes
+		Healthy bool
+		Self    bool
+	}
+
+	PeerSource string
+
+	ForwardingResponse struct {
+		// The pods that this pod has forwarded requests to recently
+		Peers []peer.PeerStats
+	}
+)
+
+const (
+	PeerSourceKubernetes PeerSource = "kubernetes"
+	PeerSourceRedis      PeerSource = "redis"
+	PeerSourceEtcd       PeerSource = "etcd"
+	PeerSourceLocal      PeerSource = "local"
+)
+
+func (s *HTTPServer) GetTransactions(c *CustomContext) error {
+	scope := c.QueryParam("scope")
+	if scope != "" && scope != "local" && scope != "cluster" {
+		return c.ErrorJSON(http.StatusBadRequest, ErrCodeValidation, "scope must be one of local, cluster")
+	}
+
+	if scope == "local" {
+		return c.JSON(http.StatusOK, pg.ListTxsResponse{
+			Transactions: pg.Manager.ListLocalTxs(),
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+
+	infos, err := pg.Manager.ListClusterTxs(ctx)
+	if err != nil {
+		return c.InternalError(err, "error listing cluster transactions")
+	}
+
+	return c.JSON(http.StatusOK, pg.ListTxsResponse{
+		Transactions: infos,
+	})
+}
+
+// DeleteTransaction force rolls back a transaction, cancelling its running query first, proxying if required
+func (s *HTTPServer) DeleteTransaction(c *CustomContext) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+
+	err := pg.Manager.KillTx(ctx, c.Param("id"))
+	if err != nil {
+		return c.DistributedError(err, "error rolling back transaction")
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// PostCancelTransaction cancels the query currently running in a transaction, proxying if required
+func (s *HTTPServer) PostCancelTransaction(c *CustomContext) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+
+	err := pg.Manager.CancelTxQuery(ctx, c.Param("id"))
+	if err != nil {
+		return c.DistributedError(err, "error cancelling transaction query")
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+// GetPeers lists the pods in the cluster as seen by kubernetes if K8S_SD is enabled, otherwise as seen by the coordinator
+func (s *HTTPServer) GetPeers(c *CustomContext) error {
+	if ksd.Discovery != nil {
+		res := PeersResponse{
+			Clustered: coord.Client != nil,
+			Source:    PeerSourceKubernetes,
+			Peers:     make([]*PeerInfo, 0),
+		}
+		for _, peer := range ksd.Discovery.Peers() {
+			res.Peers = append(res.Peers, &PeerInfo{
+				PodName:    peer.PodName,
+				PodURL:     peer.PodURL,
+				LastUpdate: peer.Updated,
+				Healthy:    peer.Ready,
+				Self:       peer.PodName == utils.POD_NAME,
+			})
+		}
+		return c.JSON(http.StatusOK, res)
+	}
+
+	if coord.Client == nil {
+		return c.JSON(http.StatusOK, PeersResponse{
+			Clustered: false,
+			Source:    PeerSourceLocal,
+			Peers: []*PeerInfo{{
+				PodName:    utils.POD_NAME,
+				PodURL:     utils.GetPodURL(),
+				LastUpdate: time.Now(),
+				Healthy:    true,
+				Self:       true,
+			}},
+		})
+	}
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+
+	peers, err := coord.Client.GetPeers(ctx)
+	if err != nil {
+		return c.InternalError(err, "error getting peers")
+	}
+
+	res := PeersResponse{
+		Clustered:    true,
+		Source:       PeerSource(coord.Client.Name()),
+		CacheUpdated: utils.Ptr(coord.Client.CachedPeersUpdated()),
+		Peers:        make([]*PeerInfo, 0, len(peers)),
+	}
+	for podName, peer := range peers {
+		res.Peers = append(res.Peers, &PeerInfo{
+			PodName:    podName,
+			PodURL:     peer.PodURL,
+			LastUpdate: peer.LastUpdate,
+			Healthy:    peer.Healthy(),
+			Self:       podName == utils.POD_NAME,
+		})
+	}
+	sort.Slice(res.Peers, func(i, j int) bool {
+		return res.Peers[i].PodName < res.Peers[j].PodName
+	})
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func (s *HTTPServer) GetForwarding(c *CustomContext) error {
+	return c.JSON(http.StatusOK, ForwardingResponse{
+		Peers: peer.DefaultClient.Stats(),
+	})
+}
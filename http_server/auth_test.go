@@ -0,0 +1,42 @@
+package http_server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+)
+
+func TestAuthScopes(t *testing.T) {
+	defer func(port, user, pass, adminUser, adminPass string) {
+		utils.HTTP_PORT, utils.AUTH_USER, utils.AUTH_PASS, utils.ADMIN_USER, utils.ADMIN_PASS = port, user, pass, adminUser, adminPass
+	}(utils.HTTP_PORT, utils.AUTH_USER, utils.AUTH_PASS, utils.ADMIN_USER, utils.ADMIN_PASS)
+	utils.HTTP_PORT, utils.AUTH_USER, utils.AUTH_PASS, utils.ADMIN_USER, utils.ADMIN_PASS = "0", "user", "pass", "admin", "secret"
+
+	s := StartHTTPServer()
+	defer s.Echo.Close()
+
+	tests := []struct {
+		method, path, user, pass string
+		status                   int
+	}{
+		{http.MethodGet, "/hc", "", "", http.StatusOK},
+		{http.MethodPost, "/psql/cancel", "", "", http.StatusUnauthorized},
+		{http.MethodPost, "/psql/cancel", "admin", "secret", http.StatusUnauthorized},
+		{http.MethodPost, "/psql/cancel", "user", "pass", http.StatusBadRequest},
+		{http.MethodGet, "/admin/peers", "user", "pass", http.StatusUnauthorized},
+		{http.MethodGet, "/admin/peers", "admin", "secret", http.StatusOK},
+	}
+	for _, test := range tests {
+		req := httptest.NewRequest(test.method, test.path, nil)
+		if test.user != "" {
+			req.SetBasicAuth(test.user, test.pass)
+		}
+		rec := httptest.NewRecorder()
+		s.Echo.ServeHTTP(rec, req)
+		if rec.Code != test.status {
+			t.Fatalf("expected %d for %s %s as %q, got %d %s", test.status, test.method, test.path, test.user, rec.Code, rec.Body.String())
+		}
+	}
+}
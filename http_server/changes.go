@@ -0,0 +1,100 @@
+package http_server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/cdc"
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+// GetChanges streams the changes to the tables as server-sent events or NDJSON until the client disconnects
+func (s *HTTPServer) GetChanges(c *CustomContext) error {
+	var params cdc.ChangesRequest
+	if err := ValidateRequest(c, &params); err != nil {
+		return c.ValidationError(err)
+	}
+	// EventSource sends the id of the last checkpoint when it reconnects
+	if params.Cursor == "" {
+		params.Cursor = c.Request().Header.Get("Last-Event-ID")
+	}
+	logger := zerolog.Ctx(c.Request().Context())
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	feed, err := cdc.Start(ctx, pg.PGPool, &params)
+	cancel()
+	if err != nil {
+		return c.DistributedError(&pg.DistributedError{Err: err}, "error starting changes stream")
+	}
+	// The feed holds a connection (and the changefeed on CockroachDB) from here on, so it's closed even if Run is never
+	// reached. Run closes it too.
+	defer feed.Close(context.Background())
+
+	ndjson := params.Format == "ndjson"
+	res := c.Response()
+	if ndjson {
+		res.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	} else {
+		res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	}
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	res.Flush()
+
+	err = feed.Run(c.Request().Context(), func(event *cdc.Event) error {
+		if ndjson {
+			return writeNDJSON(res, event)
+		}
+		return writeSSEWithID(res, event.Cursor, event.Type, event)
+	})
+	if err != nil && c.Request().Context().Err() == nil {
+		logger.Warn().Err(err).Msg("changes stream ended")
+		_, code, msg, ok := ErrorCode(err)
+		if !ok {
+			code, msg = ErrCodeInternal, "changes stream ended unexpectedly"
+		}
+		closed := ErrorResponse{
+			Code:      code,
+			Message:   msg,
+			RequestID: c.RequestID,
+			Pod:       utils.POD_NAME,
+		}
+		if ndjson {
+			writeNDJSON(res, closed)
+		} else {
+			writeSSE(res, SSEEventClosed, closed)
+		}
+	}
+	return nil
+}
+
+// DeleteChangesConsumer drops the replication slot of a /psql/changes consumer
+func (s *HTTPServer) DeleteChangesConsumer(c *CustomContext) error {
+	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+
+	if err := cdc.DropConsumer(ctx, pg.PGPool, c.Param("consumer")); err != nil {
+		return c.DistributedError(&pg.DistributedError{Err: err}, "error dropping consumer")
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func writeNDJSON(res *echo.Response, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error in json.Marshal: %w", err)
+	}
+	if _, err := fmt.Fprintf(res, "%s\n", b); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
@@ -0,0 +1,78 @@
+package http_server
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+type (
+	// copyOutWriter sends the response headers on the first write, so an error before any rows can still be returned
+	copyOutWriter struct {
+		res     *echo.Response
+		written bool
+	}
+)
+
+// PostCopyIn copies the CSV or NDJSON body into a table, streaming it to the database as it is received
+func (s *HTTPServer) PostCopyIn(c *CustomContext) error {
+	var params pg.CopyInRequest
+	if err := ValidateQueryParams(c, &params); err != nil {
+		return c.ValidationError(err)
+	}
+	defer c.Request().Body.Close()
+
+	if params.Format == "" {
+		params.Format = pg.CopyFormatCSV
+		if strings.HasPrefix(c.Request().Header.Get(echo.HeaderContentType), "application/x-ndjson") {
+			params.Format = pg.CopyFormatNDJSON
+		}
+	}
+
+	res, err := pg.CopyIn(c.Request().Context(), pg.PGPool, &params, c.Request().Body)
+	if err != nil {
+		return c.DistributedError(err, "error copying rows")
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// GetCopyOut streams the rows of a query as CSV. The query is in the JSON body, so it isn't logged with the URI.
+func (s *HTTPServer) GetCopyOut(c *CustomContext) error {
+	var params pg.CopyOutRequest
+	if err := ValidateRequest(c, &params); err != nil {
+		return c.ValidationError(err)
+	}
+	defer c.Request().Body.Close()
+
+	w := &copyOutWriter{res: c.Response()}
+	err := pg.CopyOut(c.Request().Context(), pg.PGPool, &params, w)
+	if err != nil {
+		if !w.written {
+			return c.DistributedError(err, "error copying rows")
+		}
+		// The status was already sent, so abort the response to stop the client from mistaking it for a complete one
+		zerolog.Ctx(c.Request().Context()).Warn().Err(err.Err).Str("remoteErr", err.ErrString).Msg("copy failed after rows were sent, aborting response")
+		panic(http.ErrAbortHandler)
+	}
+	if !w.written {
+		w.writeHeader()
+	}
+	return nil
+}
+
+func (w *copyOutWriter) Write(p []byte) (int, error) {
+	if !w.written {
+		w.writeHeader()
+	}
+	return w.res.Write(p)
+}
+
+func (w *copyOutWriter) writeHeader() {
+	w.written = true
+	w.res.Header().Set(echo.HeaderContentType, "text/csv; charset=utf-8")
+	w.res.WriteHeader(http.StatusOK)
+}
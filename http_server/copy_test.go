@@ -0,0 +1,172 @@
+package http_server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/labstack/echo/v4"
+)
+
+func TestValidateQueryParams(t *testing.T) {
+	e := echo.New()
+	e.Validator = &CustomValidator{validator: validator.New()}
+	req := httptest.NewRequest(http.MethodPost, "/psql/copy_in?table=users&column=a&column=b&header=false&tx_id=tx", strings.NewReader("a,b\n"))
+	req.Header.Set(echo.HeaderContentType, "text/csv")
+	c := e.NewContext(req, httptest.NewRecorder())
+
+	var params pg.CopyInRequest
+	if err := ValidateQueryParams(c, &params); err != nil {
+		t.Fatal(err)
+	}
+	if params.Table != "users" || len(params.Column) != 2 || params.Header == nil || *params.Header || params.TxID == nil || *params.TxID != "tx" {
+		t.Fatalf("unexpected params %+v", params)
+	}
+}
+
+func TestCopyOutWriter(t *testing.T) {
+	e := echo.New()
+	rec := httptest.NewRecorder()
+	c := e.NewContext(httptest.NewRequest(http.MethodGet, "/", nil), rec)
+
+	w := &copyOutWriter{res: c.Response()}
+	if w.written || c.Response().Committed {
+		t.Fatal("expected nothing written yet")
+	}
+	w.Write([]byte("id\n"))
+	w.Write([]byte("1\n"))
+	if !w.written || rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderContentType) != "text/csv; charset=utf-8" || rec.Body.String() != "id\n1\n" {
+		t.Fatalf("unexpected response %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+// copyBackend keeps the rows copied into it, and copies them all out for any query
+type copyBackend struct {
+	mu         *sync.Mutex
+	rows       *bytes.Buffer
+	statements []string
+}
+
+func (b *copyBackend) handle(backend *pgproto3.Backend, query string) error {
+	b.mu.Lock()
+	b.statements = append(b.statements, query)
+	b.mu.Unlock()
+
+	switch {
+	case strings.HasSuffix(query, " FROM STDIN WITH CSV"):
+		backend.Send(&pgproto3.CopyInResponse{})
+		var copied []byte
+		for {
+			msg, err := backend.Receive()
+			if err != nil {
+				return err
+			}
+			if data, ok := msg.(*pgproto3.CopyData); ok {
+				copied = append(copied, data.Data...)
+				continue
+			}
+			if _, ok := msg.(*pgproto3.CopyDone); !ok {
+				return fmt.Errorf("unexpected message %T", msg)
+			}
+			break
+		}
+		b.mu.Lock()
+		b.rows.Write(copied)
+		b.mu.Unlock()
+		backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(fmt.Sprintf("COPY %d", bytes.Count(copied, []byte("\n"))))})
+	case strings.HasPrefix(query, "COPY (\n") && strings.HasSuffix(query, "\n) TO STDOUT WITH CSV"):
+		b.mu.Lock()
+		rows := append([]byte{}, b.rows.Bytes()...)
+		b.mu.Unlock()
+		backend.Send(&pgproto3.CopyOutResponse{})
+		backend.Send(&pgproto3.CopyData{Data: rows})
+		backend.Send(&pgproto3.CopyDone{})
+		backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(fmt.Sprintf("COPY %d", bytes.Count(rows, []byte("\n"))))})
+	default:
+		backend.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "42601", Message: "syntax error"})
+	}
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	return nil
+}
+
+func TestCopyRoundTrip(t *testing.T) {
+	b := &copyBackend{mu: &sync.Mutex{}, rows: &bytes.Buffer{}}
+	defer func(pool *pgxpool.Pool, port string) {
+		pg.PGPool, utils.HTTP_PORT = pool, port
+	}(pg.PGPool, utils.HTTP_PORT)
+	pg.PGPool, utils.HTTP_PORT = startFakeBackend(t, b.handle), "0"
+	s := StartHTTPServer()
+	defer s.Echo.Close()
+
+	do := func(method, path, contentType, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, contentType)
+		rec := httptest.NewRecorder()
+		s.Echo.ServeHTTP(rec, req)
+		return rec
+	}
+	copyIn := func(contentType, body string, rows int64) {
+		rec := do(http.MethodPost, "/psql/copy_in?table=users", contentType, body)
+		var res pg.QueryResponse
+		if err := json.Unmarshal(rec.Body.Bytes(), &res); err != nil {
+			t.Fatal(err)
+		}
+		if rec.Code != http.StatusOK || len(res.Queries) != 1 || res.Queries[0].Error != nil || utils.Deref(res.Queries[0].RowsAffected, 0) != rows {
+			t.Fatalf("expected %d rows copied in, got %d %s", rows, rec.Code, rec.Body.String())
+		}
+	}
+
+	copyIn("application/x-ndjson", "{\"id\":1,\"name\":\"dan\"}\n{\"id\":2,\"name\":null}\n", 2)
+	copyIn("text/csv", "id,name\n3,ann\n", 1)
+
+	for _, method := range []string{http.MethodGet, http.MethodPost} {
+		rec := do(method, "/psql/copy_out", echo.MIMEApplicationJSON, `{"Query":"SELECT id, name FROM users","Header":false}`)
+		if rec.Code != http.StatusOK || rec.Header().Get(echo.HeaderContentType) != "text/csv; charset=utf-8" {
+			t.Fatalf("expected CSV from %s, got %d %s", method, rec.Code, rec.Body.String())
+		}
+		if rows := rec.Body.String(); rows != "\"1\",\"dan\"\n\"2\",\n3,ann\n" {
+			t.Fatalf("unexpected rows %q", rows)
+		}
+	}
+
+	copyOut := func(query string) *httptest.ResponseRecorder {
+		body, err := json.Marshal(pg.CopyOutRequest{Query: query, Header: utils.Ptr(false)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return do(http.MethodGet, "/psql/copy_out", echo.MIMEApplicationJSON, string(body))
+	}
+
+	// Strings the database lexes are left to it
+	quoted := `SELECT U&'d\0061t\+000061', $outer$ $inner$ ) $inner$ $outer$ -- )`
+	if rec := copyOut(quoted); rec.Code != http.StatusOK {
+		t.Fatalf("expected CSV, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	// A query that would end the COPY statement fails to prepare, so it never reaches the COPY
+	rec := copyOut("SELECT 1) TO STDOUT WITH CSV; DROP TABLE users; --")
+	if rec.Code != http.StatusBadRequest || !strings.Contains(rec.Body.String(), ErrCodeCopyFailed) {
+		t.Fatalf("expected copy failed error, got %d %s", rec.Code, rec.Body.String())
+	}
+
+	expected := []string{
+		`COPY "users" ("id", "name") FROM STDIN WITH CSV`,
+		`COPY "users" ("id", "name") FROM STDIN WITH CSV`,
+		"COPY (\nSELECT id, name FROM users\n) TO STDOUT WITH CSV",
+		"COPY (\nSELECT id, name FROM users\n) TO STDOUT WITH CSV",
+		"COPY (\n" + quoted + "\n) TO STDOUT WITH CSV",
+	}
+	if fmt.Sprintf("%q", b.statements) != fmt.Sprintf("%q", expected) {
+		t.Fatalf("unexpected statements %q", b.statements)
+	}
+}
@@ -43,15 +43,11 @@ func ccHandler(h func(*CustomContext) error) echo.HandlerFunc {
 	}
 }
 
-func (c *CustomContext) internalErrorMessage() string {
-	return "internal error, request id: " + c.RequestID
-}
-
 func (c *CustomContext) InternalError(err error, msg string) error {
 	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
 		zerolog.Ctx(c.Request().Context()).Warn().CallerSkipFrame(1).Msg(err.Error())
 	} else {
 		zerolog.Ctx(c.Request().Context()).Error().CallerSkipFrame(1).Err(err).Msg(msg)
 	}
-	return c.String(http.StatusInternalServerError, c.internalErrorMessage())
+	return c.ErrorJSON(http.StatusInternalServerError, ErrCodeInternal, "internal error")
 }
@@ -0,0 +1,137 @@
+package http_server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/danthegoodman1/SQLGateway/cdc"
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	// ErrorResponse is the body returned for every gateway-level (non-query) error
+	ErrorResponse struct {
+		Code      string
+		Message   string
+		RequestID string
+		// The pod that generated the error, preserved when the error is relayed from a remote pod
+		Pod string `json:",omitempty"`
+	}
+)
+
+const (
+	ErrCodeValidation            = "VALIDATION"
+	ErrCodeInternal              = "INTERNAL"
+	ErrCodeTxNotFound            = "TX_NOT_FOUND"
+	ErrCodeTxNotFoundLocal       = "TX_NOT_FOUND_LOCAL"
+	ErrCodePoolTimeout           = "POOL_TIMEOUT"
+	ErrCodeQueryTimeout          = "QUERY_TIMEOUT"
+	ErrCodeRemoteTimeout         = "REMOTE_TIMEOUT"
+	ErrCodeRemoteUnavailable     = "REMOTE_UNAVAILABLE"
+	ErrCodeIdempotencyInProgress = "IDEMPOTENCY_IN_PROGRESS"
+	ErrCodeIdempotencyMismatch   = "IDEMPOTENCY_MISMATCH"
+	ErrCodeSavepointNotFound     = "SAVEPOINT_NOT_FOUND"
+	ErrCodeQueryNotFound         = "QUERY_NOT_FOUND"
+	ErrCodeQueryIDInUse          = "QUERY_ID_IN_USE"
+	ErrCodeDraining              = "DRAINING"
+	ErrCodeListenUnavailable     = "LISTEN_UNAVAILABLE"
+	ErrCodeSubscriberTooSlow     = "SUBSCRIBER_TOO_SLOW"
+	ErrCodeConsumerInUse         = "CONSUMER_IN_USE"
+	ErrCodeUnknownConsumer       = "UNKNOWN_CONSUMER"
+	ErrCodeChangesUnavailable    = "CHANGES_UNAVAILABLE"
+	ErrCodeCopyFailed            = "COPY_FAILED"
+	// ErrCodeRemoteError is used when a remote pod returned an error that was not an ErrorResponse
+	ErrCodeRemoteError = "REMOTE_ERROR"
+)
+
+func (c *CustomContext) ErrorJSON(status int, code, msg string) error {
+	return c.JSON(status, ErrorResponse{
+		Code:      code,
+		Message:   msg,
+		RequestID: c.RequestID,
+		Pod:       utils.POD_NAME,
+	})
+}
+
+// ValidationError responds with the error produced by ValidateRequest
+func (c *CustomContext) ValidationError(err error) error {
+	return c.ErrorJSON(http.StatusBadRequest, ErrCodeValidation, validationMessage(err))
+}
+
+func validationMessage(err error) string {
+	var httpErr *echo.HTTPError
+	if errors.As(err, &httpErr) {
+		return fmt.Sprint(httpErr.Message)
+	}
+	return err.Error()
+}
+
+// DistributedError responds with the appropriate error for a *pg.DistributedError, relaying remote errors as-is
+func (c *CustomContext) DistributedError(err *pg.DistributedError, msg string) error {
+	if err.Remote {
+		var remoteErr ErrorResponse
+		if jsonErr := json.Unmarshal([]byte(err.ErrString), &remoteErr); jsonErr == nil && remoteErr.Code != "" {
+			return c.JSON(err.StatusCode, remoteErr)
+		}
+		return c.ErrorJSON(err.StatusCode, ErrCodeRemoteError, err.ErrString)
+	}
+	if status, code, errMsg, ok := ErrorCode(err.Err); ok {
+		return c.ErrorJSON(status, code, errMsg)
+	}
+	return c.InternalError(err.Err, msg)
+}
+
+// ErrorCode returns the status, code, and message for a known gateway error, or false if it is an internal error
+func ErrorCode(err error) (int, string, string, bool) {
+	switch {
+	case errors.Is(err, utils.ErrPoolTimeout):
+		return http.StatusRequestTimeout, ErrCodePoolTimeout, utils.ErrPoolTimeout.Error(), true
+	case errors.Is(err, pg.ErrRemoteTimeout):
+		return http.StatusGatewayTimeout, ErrCodeRemoteTimeout, pg.ErrRemoteTimeout.Error(), true
+	case errors.Is(err, context.DeadlineExceeded):
+		// Anything else that ran out of time, such as waiting on a query or a lock in the database
+		return http.StatusRequestTimeout, ErrCodeQueryTimeout, "timed out running the request", true
+	case errors.Is(err, pg.ErrTxNotFound):
+		return http.StatusNotFound, ErrCodeTxNotFound, "transaction not found, did it timeout?", true
+	case errors.Is(err, pg.ErrTxNotFoundLocal):
+		return http.StatusNotFound, ErrCodeTxNotFoundLocal, err.Error(), true
+	case errors.Is(err, pg.ErrSavepointNotFound):
+		return http.StatusNotFound, ErrCodeSavepointNotFound, "savepoint not found", true
+	case errors.Is(err, pg.ErrQueryNotFound):
+		return http.StatusNotFound, ErrCodeQueryNotFound, err.Error(), true
+	case errors.Is(err, pg.ErrQueryIDInUse):
+		return http.StatusConflict, ErrCodeQueryIDInUse, err.Error(), true
+	case errors.Is(err, pg.ErrIdempotencyInProgress):
+		return http.StatusConflict, ErrCodeIdempotencyInProgress, err.Error(), true
+	case errors.Is(err, pg.ErrIdempotencyMismatch):
+		return http.StatusUnprocessableEntity, ErrCodeIdempotencyMismatch, err.Error(), true
+	case errors.Is(err, pg.ErrRemoteUnavailable):
+		return http.StatusBadGateway, ErrCodeRemoteUnavailable, err.Error(), true
+	case errors.Is(err, pg.ErrInvalidTxOptions):
+		return http.StatusBadRequest, ErrCodeValidation, err.Error(), true
+	case errors.Is(err, pg.ErrDraining):
+		return http.StatusServiceUnavailable, ErrCodeDraining, err.Error(), true
+	case errors.Is(err, pg.ErrListenerClosed):
+		return http.StatusServiceUnavailable, ErrCodeDraining, err.Error(), true
+	case errors.Is(err, pg.ErrSubscriberTooSlow):
+		return http.StatusServiceUnavailable, ErrCodeSubscriberTooSlow, err.Error(), true
+	case errors.Is(err, pg.ErrCopyFailed):
+		return http.StatusBadRequest, ErrCodeCopyFailed, err.Error(), true
+	case errors.Is(err, cdc.ErrInvalidRequest):
+		return http.StatusBadRequest, ErrCodeValidation, err.Error(), true
+	case errors.Is(err, cdc.ErrConsumerInUse):
+		return http.StatusConflict, ErrCodeConsumerInUse, err.Error(), true
+	case errors.Is(err, cdc.ErrUnknownConsumer):
+		return http.StatusNotFound, ErrCodeUnknownConsumer, err.Error(), true
+	case errors.Is(err, cdc.ErrFeedsClosed):
+		return http.StatusServiceUnavailable, ErrCodeDraining, err.Error(), true
+	case errors.Is(err, cdc.ErrChangesUnavailable):
+		return http.StatusServiceUnavailable, ErrCodeChangesUnavailable, err.Error(), true
+	}
+	return 0, "", "", false
+}
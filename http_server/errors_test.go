@@ -0,0 +1,29 @@
+package http_server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+)
+
+func TestErrorCodeTimeouts(t *testing.T) {
+	tests := []struct {
+		err    error
+		status int
+		code   string
+	}{
+		{fmt.Errorf("error in utils.AcquireConn: %w", fmt.Errorf("%w: %s", utils.ErrPoolTimeout, context.DeadlineExceeded)), http.StatusRequestTimeout, ErrCodePoolTimeout},
+		{fmt.Errorf("%w: %s", pg.ErrRemoteTimeout, context.DeadlineExceeded), http.StatusGatewayTimeout, ErrCodeRemoteTimeout},
+		{fmt.Errorf("error in transaction execution: %w", context.DeadlineExceeded), http.StatusRequestTimeout, ErrCodeQueryTimeout},
+	}
+	for _, test := range tests {
+		status, code, _, ok := ErrorCode(test.err)
+		if !ok || status != test.status || code != test.code {
+			t.Fatalf("expected %d %s for %q, got %d %s", test.status, test.code, test.err, status, code)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package http_server
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+// startFakeBackend serves Postgres connections that start up without authentication, and have handle respond to every
+// simple query. Prepared statements are described as having no parameters or rows. It returns a pool that connects to it.
+func startFakeBackend(t *testing.T, handle func(backend *pgproto3.Backend, query string) error) *pgxpool.Pool {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		listener.Close()
+	})
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeBackend(conn, handle)
+		}
+	}()
+
+	config, err := pgxpool.ParseConfig("postgres://gateway@" + listener.Addr().String() + "/db?sslmode=disable")
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.LazyConnect = true
+	pool, err := pgxpool.ConnectConfig(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+	return pool
+}
+
+func serveFakeBackend(conn net.Conn, handle func(backend *pgproto3.Backend, query string) error) {
+	defer conn.Close()
+	backend := pgproto3.NewBackend(pgproto3.NewChunkReader(conn), conn)
+	if _, err := backend.ReceiveStartupMessage(); err != nil {
+		return
+	}
+	backend.Send(&pgproto3.AuthenticationOk{})
+	backend.Send(&pgproto3.BackendKeyData{ProcessID: 1, SecretKey: 1})
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return
+		}
+		switch msg := msg.(type) {
+		case *pgproto3.Query:
+			if err := handle(backend, msg.String); err != nil {
+				return
+			}
+		case *pgproto3.Parse:
+			if err := prepareFake(backend, msg.Query); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+// prepareFake answers the rest of an extended protocol prepare, rejecting multiple statements like Postgres does
+func prepareFake(backend *pgproto3.Backend, query string) error {
+	for {
+		msg, err := backend.Receive()
+		if err != nil {
+			return err
+		}
+		if _, ok := msg.(*pgproto3.Sync); ok {
+			break
+		}
+	}
+	// Only a stand-in for the parser, test queries don't have semicolons in strings
+	if strings.Contains(query, ";") {
+		backend.Send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: "42601", Message: "cannot insert multiple commands into a prepared statement"})
+	} else {
+		backend.Send(&pgproto3.ParseComplete{})
+		backend.Send(&pgproto3.ParameterDescription{})
+		backend.Send(&pgproto3.NoData{})
+	}
+	backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+	return nil
+}
@@ -0,0 +1,123 @@
+package http_server
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/coord"
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/labstack/echo/v4"
+)
+
+type (
+	HealthResponse struct {
+		Status     HealthStatus
+		Components map[string]*ComponentHealth
+	}
+
+	ComponentHealth struct {
+		Status HealthStatus
+		Error  string `json:",omitempty"`
+	}
+
+	HealthStatus string
+
+	healthCheck func(ctx context.Context) error
+)
+
+const (
+	HealthStatusOK   HealthStatus = "ok"
+	HealthStatusFail HealthStatus = "fail"
+
+	// healthCheckTimeout is how long each component has to respond, a check that hangs (e.g. on a deadlock) fails
+	healthCheckTimeout = time.Second * 2
+)
+
+// Readyz fails when a dependency is unavailable, the pool is saturated, or the pod is draining, so load balancers
+// stop routing to it
+func (*HTTPServer) Readyz(c echo.Context) error {
+	checks := map[string]healthCheck{
+		"postgres": pg.PingPool,
+		"pool": func(ctx context.Context) error {
+			return pg.CheckPoolSaturation()
+		},
+		"draining": func(ctx context.Context) error {
+			if pg.Manager.Draining() {
+				return pg.ErrDraining
+			}
+			return nil
+		},
+	}
+	if coord.Client != nil {
+		checks[coord.Client.Name()] = coord.Client.Ping
+	}
+
+	return healthJSON(c, runHealthChecks(c.Request().Context(), checks))
+}
+
+// Livez fails when the transaction manager is wedged, so the pod gets restarted
+func (*HTTPServer) Livez(c echo.Context) error {
+	return healthJSON(c, runHealthChecks(c.Request().Context(), map[string]healthCheck{
+		"tx_manager": func(ctx context.Context) error {
+			return pg.Manager.CheckLiveness()
+		},
+	}))
+}
+
+func healthJSON(c echo.Context, res *HealthResponse) error {
+	status := http.StatusOK
+	if res.Status != HealthStatusOK {
+		status = http.StatusServiceUnavailable
+	}
+	return c.JSON(status, res)
+}
+
+// runHealthChecks runs the checks concurrently, failing any that do not finish within healthCheckTimeout
+func runHealthChecks(ctx context.Context, checks map[string]healthCheck) *HealthResponse {
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	res := &HealthResponse{
+		Status:     HealthStatusOK,
+		Components: make(map[string]*ComponentHealth, len(checks)),
+	}
+	resMu := &sync.Mutex{}
+	wg := &sync.WaitGroup{}
+	for name, check := range checks {
+		wg.Add(1)
+		go func(name string, check healthCheck) {
+			defer wg.Done()
+
+			// Buffered so the check can finish after timing out without blocking forever
+			errChan := make(chan error, 1)
+			go func() {
+				errChan <- check(ctx)
+			}()
+
+			var err error
+			select {
+			case err = <-errChan:
+			case <-ctx.Done():
+				err = ctx.Err()
+			}
+
+			component := &ComponentHealth{Status: HealthStatusOK}
+			if err != nil {
+				component.Status = HealthStatusFail
+				component.Error = err.Error()
+			}
+
+			resMu.Lock()
+			defer resMu.Unlock()
+			res.Components[name] = component
+			if err != nil {
+				res.Status = HealthStatusFail
+			}
+		}(name, check)
+	}
+	wg.Wait()
+
+	return res
+}
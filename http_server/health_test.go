@@ -0,0 +1,37 @@
+package http_server
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestRunHealthChecks(t *testing.T) {
+	res := runHealthChecks(context.Background(), map[string]healthCheck{
+		"ok": func(ctx context.Context) error {
+			return nil
+		},
+		"error": func(ctx context.Context) error {
+			return errors.New("broken")
+		},
+		"hung": func(ctx context.Context) error {
+			// Ignores the context, like a check stuck on a mutex
+			time.Sleep(healthCheckTimeout * 2)
+			return nil
+		},
+	})
+
+	if res.Status != HealthStatusFail {
+		t.Fatalf("expected overall status to fail, got %s", res.Status)
+	}
+	if res.Components["ok"].Status != HealthStatusOK {
+		t.Fatalf("expected ok component to pass, got %+v", res.Components["ok"])
+	}
+	if c := res.Components["error"]; c.Status != HealthStatusFail || c.Error != "broken" {
+		t.Fatalf("expected error component to fail, got %+v", c)
+	}
+	if c := res.Components["hung"]; c.Status != HealthStatusFail || c.Error != context.DeadlineExceeded.Error() {
+		t.Fatalf("expected hung component to time out, got %+v", c)
+	}
+}
@@ -49,22 +49,47 @@ func StartHTTPServer() *HTTPServer {
 
 	// technical - no auth
 	s.Echo.GET("/hc", s.HealthCheck)
+	s.Echo.GET("/readyz", s.Readyz)
+	s.Echo.GET("/livez", s.Livez)
 
+	psqlGroup := s.Echo.Group("/psql")
 	if utils.AUTH_USER != "" && utils.AUTH_PASS != "" {
 		logger.Debug().Msg("using basic auth")
-		s.Echo.Use(middleware.BasicAuth(func(username, password string, c echo.Context) (bool, error) {
-			if subtle.ConstantTimeCompare([]byte(username), []byte(utils.AUTH_USER)) == 1 && subtle.ConstantTimeCompare([]byte(password), []byte(utils.AUTH_PASS)) == 1 {
-				return true, nil
-			}
-			return false, nil
-		}))
+		psqlGroup.Use(middleware.BasicAuth(basicAuthValidator(utils.AUTH_USER, utils.AUTH_PASS)))
+	}
+	if utils.ROUTING_HINT {
+		psqlGroup.Use(RoutingHintMiddleware)
 	}
-
-	psqlGroup := s.Echo.Group("/psql")
 	psqlGroup.POST("/query", ccHandler(s.PostQuery))
 	psqlGroup.POST("/begin", ccHandler(s.PostBegin))
 	psqlGroup.POST("/commit", ccHandler(s.PostCommit))
 	psqlGroup.POST("/rollback", ccHandler(s.PostRollback))
+	psqlGroup.POST("/cancel", ccHandler(s.PostCancel))
+	psqlGroup.POST("/extend", ccHandler(s.PostExtend))
+	psqlGroup.POST("/savepoint", ccHandler(s.PostSavepoint))
+	psqlGroup.POST("/rollback_to", ccHandler(s.PostRollbackTo))
+	psqlGroup.POST("/release", ccHandler(s.PostRelease))
+	psqlGroup.GET("/ws", ccHandler(s.GetWS))
+	psqlGroup.GET("/listen", ccHandler(s.GetListen))
+	psqlGroup.POST("/notify", ccHandler(s.PostNotify))
+	psqlGroup.GET("/changes", ccHandler(s.GetChanges))
+	psqlGroup.POST("/copy_in", ccHandler(s.PostCopyIn))
+	psqlGroup.GET("/copy_out", ccHandler(s.GetCopyOut))
+	// For clients and proxies that drop the body of a GET
+	psqlGroup.POST("/copy_out", ccHandler(s.GetCopyOut))
+
+	// The admin API can kill any transaction, so it's only served with its own credentials
+	if utils.ADMIN_USER != "" && utils.ADMIN_PASS != "" {
+		adminGroup := s.Echo.Group("/admin", middleware.BasicAuth(basicAuthValidator(utils.ADMIN_USER, utils.ADMIN_PASS)))
+		adminGroup.GET("/transactions", ccHandler(s.GetTransactions))
+		adminGroup.DELETE("/transactions/:id", ccHandler(s.DeleteTransaction))
+		adminGroup.POST("/transactions/:id/cancel", ccHandler(s.PostCancelTransaction))
+		adminGroup.DELETE("/changes/:consumer", ccHandler(s.DeleteChangesConsumer))
+		adminGroup.GET("/peers", ccHandler(s.GetPeers))
+		adminGroup.GET("/forwarding", ccHandler(s.GetForwarding))
+	} else {
+		logger.Debug().Msg("ADMIN_USER and ADMIN_PASS not set, not serving the admin API")
+	}
 
 	s.Echo.Listener = listener
 	go func() {
@@ -80,6 +105,16 @@ func StartHTTPServer() *HTTPServer {
 	return s
 }
 
+// basicAuthValidator checks Basic auth credentials against user and pass in constant time
+func basicAuthValidator(user, pass string) middleware.BasicAuthValidator {
+	return func(username, password string, c echo.Context) (bool, error) {
+		if subtle.ConstantTimeCompare([]byte(username), []byte(user)) == 1 && subtle.ConstantTimeCompare([]byte(password), []byte(pass)) == 1 {
+			return true, nil
+		}
+		return false, nil
+	}
+}
+
 func (cv *CustomValidator) Validate(i interface{}) error {
 	if err := cv.validator.Struct(i); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
@@ -97,6 +132,17 @@ func ValidateRequest(c echo.Context, s interface{}) error {
 	return nil
 }
 
+// ValidateQueryParams is like ValidateRequest, but only binds the query params, for requests whose body is not JSON
+func ValidateQueryParams(c echo.Context, s interface{}) error {
+	if err := (&echo.DefaultBinder{}).BindQueryParams(c, s); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+	if err := c.Validate(s); err != nil {
+		return err
+	}
+	return nil
+}
+
 func (*HTTPServer) HealthCheck(c echo.Context) error {
 	return c.String(http.StatusOK, "ok")
 }
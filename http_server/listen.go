@@ -0,0 +1,135 @@
+package http_server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+)
+
+const (
+	SSEEventListening    = "listening"
+	SSEEventNotification = "notification"
+	SSEEventReconnected  = "reconnected"
+	// Sent before the stream ends because the subscriber fell behind or the pod is shutting down. Not named error,
+	// since EventSource fires error events for connection errors.
+	SSEEventClosed = "closed"
+)
+
+// GetListen streams the notifications of the channels as server-sent events until the client disconnects
+func (s *HTTPServer) GetListen(c *CustomContext) error {
+	var params pg.ListenRequest
+	if err := ValidateRequest(c, &params); err != nil {
+		return c.ValidationError(err)
+	}
+	logger := zerolog.Ctx(c.Request().Context())
+
+	sub, err := pg.Listener.Subscribe(params.Channel)
+	if err != nil {
+		return c.DistributedError(&pg.DistributedError{Err: err}, "error subscribing to channels")
+	}
+	defer sub.Close()
+
+	// Don't respond until notifications can't be missed
+	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	select {
+	case <-sub.Ready:
+	case <-sub.Done:
+		cancel()
+		return c.DistributedError(&pg.DistributedError{Err: sub.Err}, "error subscribing to channels")
+	case <-ctx.Done():
+		cancel()
+		return c.ErrorJSON(http.StatusServiceUnavailable, ErrCodeListenUnavailable, "timed out waiting to listen to the channels, is the database reachable?")
+	}
+	cancel()
+
+	res := c.Response()
+	res.Header().Set(echo.HeaderContentType, "text/event-stream")
+	res.Header().Set(echo.HeaderCacheControl, "no-cache")
+	// Stop proxies like nginx from buffering the stream
+	res.Header().Set("X-Accel-Buffering", "no")
+	res.WriteHeader(http.StatusOK)
+	if err := writeSSE(res, SSEEventListening, struct{}{}); err != nil {
+		return nil
+	}
+
+	heartbeat := time.NewTicker(time.Second * time.Duration(utils.LISTEN_HEARTBEAT_SEC))
+	defer heartbeat.Stop()
+	for {
+		var err error
+		select {
+		case n := <-sub.C:
+			err = writeSSE(res, SSEEventNotification, n)
+		case <-sub.Reconnected:
+			err = writeSSE(res, SSEEventReconnected, struct{}{})
+		case <-heartbeat.C:
+			_, err = fmt.Fprint(res, ": heartbeat\n\n")
+			res.Flush()
+		case <-sub.Done:
+			_, code, msg, _ := ErrorCode(sub.Err)
+			writeSSE(res, SSEEventClosed, ErrorResponse{
+				Code:      code,
+				Message:   msg,
+				RequestID: c.RequestID,
+				Pod:       utils.POD_NAME,
+			})
+			return nil
+		case <-c.Request().Context().Done():
+			return nil
+		}
+		if err != nil {
+			logger.Debug().Err(err).Msg("error writing server-sent event")
+			return nil
+		}
+	}
+}
+
+func (s *HTTPServer) PostNotify(c *CustomContext) error {
+	var body pg.NotifyRequest
+	if err := ValidateRequest(c, &body); err != nil {
+		return c.ValidationError(err)
+	}
+	defer c.Request().Body.Close()
+
+	res, err := pg.Query(c.Request().Context(), pg.PGPool, &pg.QueryRequest{
+		Queries: []*pg.QueryReq{{
+			Statement: "SELECT pg_notify($1, $2)",
+			Params:    []any{body.Channel, body.Payload},
+			Exec:      utils.Ptr(true),
+		}},
+		TxID: body.TxID,
+	})
+	if err != nil {
+		return c.DistributedError(err, "error sending notification")
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+func writeSSE(res *echo.Response, event string, data any) error {
+	return writeSSEWithID(res, "", event, data)
+}
+
+// writeSSEWithID writes the event with an id if provided, which EventSource sends back as Last-Event-ID when reconnecting
+func writeSSEWithID(res *echo.Response, id, event string, data any) error {
+	b, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("error in json.Marshal: %w", err)
+	}
+	if id != "" {
+		if _, err := fmt.Fprintf(res, "id: %s\n", id); err != nil {
+			return err
+		}
+	}
+	if _, err := fmt.Fprintf(res, "event: %s\ndata: %s\n\n", event, b); err != nil {
+		return err
+	}
+	res.Flush()
+	return nil
+}
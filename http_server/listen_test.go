@@ -0,0 +1,99 @@
+package http_server
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgproto3/v2"
+)
+
+// readSSE reads the next event, skipping comments
+func readSSE(t *testing.T, r *bufio.Reader) (event string, data string) {
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			data = strings.TrimPrefix(line, "data: ")
+		case line == "" && event != "":
+			return event, data
+		}
+	}
+}
+
+func TestListenEvents(t *testing.T) {
+	// Receives the backend once it's LISTENing, so notifications can be sent with it
+	listening := make(chan *pgproto3.Backend, 1)
+	pool := startFakeBackend(t, func(backend *pgproto3.Backend, query string) error {
+		backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(strings.Fields(query)[0])})
+		backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'I'})
+		if strings.HasPrefix(query, "LISTEN") {
+			listening <- backend
+		}
+		return nil
+	})
+
+	defer func(listener *pg.NotificationListener, port string) {
+		pg.Listener, utils.HTTP_PORT = listener, port
+	}(pg.Listener, utils.HTTP_PORT)
+	pg.Listener, utils.HTTP_PORT = pg.NewNotificationListener(pool), "0"
+	s := StartHTTPServer()
+	defer s.Echo.Close()
+	server := httptest.NewServer(s.Echo)
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, server.URL+"/psql/listen?channel=jobs", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK || res.Header.Get("Content-Type") != "text/event-stream" {
+		t.Fatalf("expected an event stream, got %d %s", res.StatusCode, res.Header.Get("Content-Type"))
+	}
+	events := bufio.NewReader(res.Body)
+
+	if event, _ := readSSE(t, events); event != SSEEventListening {
+		t.Fatalf("expected %s event, got %s", SSEEventListening, event)
+	}
+
+	backend := <-listening
+	backend.Send(&pgproto3.NotificationResponse{PID: 42, Channel: "jobs", Payload: "hello"})
+	event, data := readSSE(t, events)
+	var n pg.Notification
+	if err := json.Unmarshal([]byte(data), &n); err != nil {
+		t.Fatal(err)
+	}
+	if event != SSEEventNotification || n.Channel != "jobs" || n.Payload != "hello" || n.PID != 42 {
+		t.Fatalf("unexpected %s event %s", event, data)
+	}
+
+	// Shutting down ends the stream with the reason
+	pg.Listener.Shutdown()
+	event, data = readSSE(t, events)
+	var closed ErrorResponse
+	if err := json.Unmarshal([]byte(data), &closed); err != nil {
+		t.Fatal(err)
+	}
+	if event != SSEEventClosed || closed.Code != ErrCodeDraining {
+		t.Fatalf("unexpected %s event %s", event, data)
+	}
+}
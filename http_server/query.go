@@ -2,8 +2,8 @@ package http_server
 
 import (
 	"context"
-	"errors"
 	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
 	"github.com/rs/zerolog"
 	"net/http"
 	"time"
@@ -12,7 +12,7 @@ import (
 func (s *HTTPServer) PostQuery(c *CustomContext) error {
 	var body pg.QueryRequest
 	if err := ValidateRequest(c, &body); err != nil {
-		return c.String(http.StatusBadRequest, err.Error())
+		return c.ValidationError(err)
 	}
 	defer c.Request().Body.Close()
 	//logger := zerolog.Ctx(c.Request().Context())
@@ -25,20 +25,19 @@ func (s *HTTPServer) PostQuery(c *CustomContext) error {
 		})
 	}
 
-	res, err := pg.Query(c.Request().Context(), pg.PGPool, body.Queries, body.TxID)
+	runQuery := func() (*pg.QueryResponse, *pg.DistributedError) {
+		return pg.Query(c.Request().Context(), pg.PGPool, &body)
+	}
+
+	var res *pg.QueryResponse
+	var err *pg.DistributedError
+	if body.IdempotencyKey != nil {
+		res, err = pg.RunIdempotent(c.Request().Context(), &body, runQuery)
+	} else {
+		res, err = runQuery()
+	}
 	if err != nil {
-		if errors.Is(err.Err, pg.ErrTxNotFound) {
-			return c.String(http.StatusNotFound, "transaction not found, did it timeout?")
-		}
-		if errors.Is(err.Err, pg.ErrTxNotFoundLocal) {
-			return c.String(http.StatusNotFound, err.Err.Error())
-		}
-		if err.Err != nil {
-			return c.InternalError(err.Err, "error handling query")
-		}
-		if err.Remote {
-			return c.String(err.StatusCode, err.ErrString)
-		}
+		return c.DistributedError(err, "error handling query")
 	}
 
 	return c.JSON(http.StatusOK, res)
@@ -47,21 +46,25 @@ func (s *HTTPServer) PostQuery(c *CustomContext) error {
 func (s *HTTPServer) PostBegin(c *CustomContext) error {
 	var body pg.BeginRequest
 	if err := ValidateRequest(c, &body); err != nil {
-		return c.String(http.StatusBadRequest, err.Error())
+		return c.ValidationError(err)
 	}
 	defer c.Request().Body.Close()
 
-	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Second*10)
+	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
 	defer cancel()
 
-	txID, err := pg.Manager.NewTx(ctx, body.TxTimeoutSec)
-	if errors.Is(err, context.DeadlineExceeded) {
-		return c.String(http.StatusRequestTimeout, "timed out waiting for free pool connection")
+	txID, err := pg.Manager.NewTx(ctx, &body)
+	if status, code, msg, ok := ErrorCode(err); ok {
+		return c.ErrorJSON(status, code, msg)
 	}
 	if err != nil {
 		return c.InternalError(err, "error creating new transaction")
 	}
 
+	if utils.ROUTING_HINT {
+		setRoutingHint(c, utils.GetPodURL())
+	}
+
 	return c.JSON(http.StatusOK, pg.TxIDJSON{
 		TxID: txID,
 	})
@@ -70,30 +73,20 @@ func (s *HTTPServer) PostBegin(c *CustomContext) error {
 func (s *HTTPServer) PostCommit(c *CustomContext) error {
 	var body pg.TxIDJSON
 	if err := ValidateRequest(c, &body); err != nil {
-		return c.String(http.StatusBadRequest, err.Error())
+		return c.ValidationError(err)
 	}
 	defer c.Request().Body.Close()
 
-	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Second*10)
+	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
 	defer cancel()
 
 	err := pg.Manager.CommitTx(ctx, body.TxID)
 	if err != nil {
-		if errors.Is(err.Err, context.DeadlineExceeded) {
-			return c.String(http.StatusRequestTimeout, "timed out waiting for free pool connection")
-		}
-		if errors.Is(err.Err, pg.ErrTxNotFound) {
-			return c.String(http.StatusNotFound, "transaction not found")
-		}
-		if errors.Is(err.Err, pg.ErrTxNotFoundLocal) {
-			return c.String(http.StatusNotFound, err.Err.Error())
-		}
-		if err.Err != nil {
-			return c.InternalError(err.Err, "error committing transaction")
-		}
-		if err.Remote {
-			return c.String(err.StatusCode, err.ErrString)
-		}
+		return c.DistributedError(err, "error committing transaction")
+	}
+
+	if utils.ROUTING_HINT {
+		clearRoutingHint(c)
 	}
 
 	return c.NoContent(http.StatusOK)
@@ -102,30 +95,88 @@ func (s *HTTPServer) PostCommit(c *CustomContext) error {
 func (s *HTTPServer) PostRollback(c *CustomContext) error {
 	var body pg.TxIDJSON
 	if err := ValidateRequest(c, &body); err != nil {
-		return c.String(http.StatusBadRequest, err.Error())
+		return c.ValidationError(err)
 	}
 	defer c.Request().Body.Close()
 
-	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Second*10)
+	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
 	defer cancel()
 
 	err := pg.Manager.RollbackTx(ctx, body.TxID)
 	if err != nil {
-		if errors.Is(err.Err, context.DeadlineExceeded) {
-			return c.String(http.StatusRequestTimeout, "timed out waiting for free pool connection")
-		}
-		if errors.Is(err.Err, pg.ErrTxNotFound) {
-			return c.String(http.StatusNotFound, "transaction not found")
-		}
-		if errors.Is(err.Err, pg.ErrTxNotFoundLocal) {
-			return c.String(http.StatusNotFound, err.Err.Error())
-		}
-		if err.Err != nil {
-			return c.InternalError(err.Err, "error rolling back transaction")
-		}
-		if err.Remote {
-			return c.String(err.StatusCode, err.ErrString)
-		}
+		return c.DistributedError(err, "error rolling back transaction")
+	}
+
+	if utils.ROUTING_HINT {
+		clearRoutingHint(c)
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (s *HTTPServer) PostCancel(c *CustomContext) error {
+	var body pg.CancelRequest
+	if err := ValidateRequest(c, &body); err != nil {
+		return c.ValidationError(err)
+	}
+	defer c.Request().Body.Close()
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+
+	err := pg.CancelQuery(ctx, body.QueryID)
+	if err != nil {
+		return c.DistributedError(err, "error cancelling query")
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+func (s *HTTPServer) PostExtend(c *CustomContext) error {
+	var body pg.ExtendRequest
+	if err := ValidateRequest(c, &body); err != nil {
+		return c.ValidationError(err)
+	}
+	defer c.Request().Body.Close()
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+
+	expires, err := pg.Manager.ExtendTx(ctx, body.TxID, body.TxTimeoutSec)
+	if err != nil {
+		return c.DistributedError(err, "error extending transaction")
+	}
+
+	return c.JSON(http.StatusOK, pg.ExtendResponse{
+		Expires: expires,
+	})
+}
+
+func (s *HTTPServer) PostSavepoint(c *CustomContext) error {
+	return s.handleSavepoint(c, pg.SavepointOpCreate)
+}
+
+func (s *HTTPServer) PostRollbackTo(c *CustomContext) error {
+	return s.handleSavepoint(c, pg.SavepointOpRollbackTo)
+}
+
+func (s *HTTPServer) PostRelease(c *CustomContext) error {
+	return s.handleSavepoint(c, pg.SavepointOpRelease)
+}
+
+func (s *HTTPServer) handleSavepoint(c *CustomContext, op pg.SavepointOp) error {
+	var body pg.SavepointRequest
+	if err := ValidateRequest(c, &body); err != nil {
+		return c.ValidationError(err)
+	}
+	defer c.Request().Body.Close()
+
+	ctx, cancel := context.WithTimeout(c.Request().Context(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+
+	err := pg.Manager.SavepointTx(ctx, body.TxID, body.Name, op)
+	if err != nil {
+		return c.DistributedError(err, "error handling savepoint")
 	}
 
 	return c.NoContent(http.StatusOK)
@@ -0,0 +1,52 @@
+package http_server
+
+import (
+	"net/http"
+
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/labstack/echo/v4"
+)
+
+// RoutingHintHeader is the response header with the URL of the pod that owns the transaction
+const RoutingHintHeader = "X-SQLGateway-Pod"
+
+// RoutingHintMiddleware updates the routing hint when a transaction request had to be forwarded to another pod, so
+// the client or load balancer can route to the owning pod directly next time
+func RoutingHintMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		ctx, forwardedTo := pg.WithForwardedTo(c.Request().Context())
+		c.SetRequest(c.Request().WithContext(ctx))
+		c.Response().Before(func() {
+			// Don't override a hint the handler set or cleared
+			if *forwardedTo == "" || c.Response().Header().Get(RoutingHintHeader) != "" || c.Response().Header().Get(echo.HeaderSetCookie) != "" {
+				return
+			}
+			setRoutingHint(c, *forwardedTo)
+		})
+		return next(c)
+	}
+}
+
+func setRoutingHint(c echo.Context, podURL string) {
+	c.Response().Header().Set(RoutingHintHeader, podURL)
+	c.SetCookie(&http.Cookie{
+		Name:     utils.ROUTING_HINT_COOKIE,
+		Value:    podURL,
+		Path:     "/",
+		MaxAge:   int(utils.TX_MAX_LIFETIME_SEC),
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// clearRoutingHint expires the cookie once the transaction is finished, so requests are load balanced again
+func clearRoutingHint(c echo.Context) {
+	c.SetCookie(&http.Cookie{
+		Name:     utils.ROUTING_HINT_COOKIE,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
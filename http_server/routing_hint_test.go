@@ -0,0 +1,96 @@
+package http_server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/danthegoodman1/SQLGateway/coord"
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/go-playground/validator/v10"
+	"github.com/labstack/echo/v4"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// fakeCoordinator only implements GetTransaction, the other methods panic
+type fakeCoordinator struct {
+	coord.Coordinator
+	txMeta *coord.TransactionMeta
+}
+
+func (f *fakeCoordinator) GetTransaction(ctx context.Context, txID string) (*coord.TransactionMeta, error) {
+	if txID != f.txMeta.TxID {
+		return nil, coord.ErrNotFound
+	}
+	return f.txMeta, nil
+}
+
+func TestRoutingHintFollowsForwarding(t *testing.T) {
+	// The pod that owns the transaction
+	owner := httptest.NewServer(h2c.NewHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"Expires":"2022-01-01T00:00:00Z"}`))
+	}), &http2.Server{}))
+	defer owner.Close()
+	ownerURL := strings.TrimPrefix(owner.URL, "http://")
+
+	defer func(client coord.Coordinator, manager *pg.TxManager, hint bool) {
+		coord.Client, pg.Manager, utils.ROUTING_HINT = client, manager, hint
+	}(coord.Client, pg.Manager, utils.ROUTING_HINT)
+	utils.ROUTING_HINT = true
+	coord.Client = &fakeCoordinator{txMeta: &coord.TransactionMeta{
+		TxID:   "tx1",
+		PodID:  "otherpod",
+		PodURL: ownerURL,
+	}}
+	pg.Manager = pg.NewTxManager()
+	defer pg.Manager.Shutdown()
+
+	s := &HTTPServer{Echo: echo.New()}
+	s.Echo.Validator = &CustomValidator{validator: validator.New()}
+	s.Echo.Use(CreateReqContext)
+	psqlGroup := s.Echo.Group("/psql", RoutingHintMiddleware)
+	psqlGroup.POST("/extend", ccHandler(s.PostExtend))
+	psqlGroup.POST("/rollback", ccHandler(s.PostRollback))
+
+	do := func(path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+		rec := httptest.NewRecorder()
+		s.Echo.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// A stale hint sent the request here, so it is forwarded and the hint points at the owner
+	rec := do("/psql/extend", `{"TxID":"tx1"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	if hint := rec.Header().Get(RoutingHintHeader); hint != ownerURL {
+		t.Fatalf("expected hint %s, got %q", ownerURL, hint)
+	}
+	if cookie := rec.Header().Get(echo.HeaderSetCookie); !strings.HasPrefix(cookie, utils.ROUTING_HINT_COOKIE+"="+ownerURL) {
+		t.Fatalf("expected hint cookie, got %q", cookie)
+	}
+
+	// Finishing the transaction clears the hint, even though it was forwarded
+	rec = do("/psql/rollback", `{"TxID":"tx1"}`)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d %s", rec.Code, rec.Body.String())
+	}
+	if hint := rec.Header().Get(RoutingHintHeader); hint != "" {
+		t.Fatalf("expected no hint, got %q", hint)
+	}
+	if cookie := rec.Header().Get(echo.HeaderSetCookie); !strings.Contains(cookie, "Max-Age=0") {
+		t.Fatalf("expected the hint cookie to be cleared, got %q", cookie)
+	}
+
+	// Transactions that are not found don't get a hint
+	rec = do("/psql/extend", `{"TxID":"tx2"}`)
+	if rec.Code != http.StatusNotFound || rec.Header().Get(RoutingHintHeader) != "" {
+		t.Fatalf("expected 404 without a hint, got %d %q", rec.Code, rec.Header().Get(RoutingHintHeader))
+	}
+}
@@ -0,0 +1,301 @@
+package http_server
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/rs/zerolog"
+	"golang.org/x/net/websocket"
+)
+
+type (
+	// WSRequest is a message sent by the client on a /psql/ws socket
+	WSRequest struct {
+		// Echoed back on every response to this request
+		ID *string
+		// One of begin, query, commit, or rollback
+		Type string `validate:"oneof=begin query commit rollback"`
+		// For begin
+		Options *pg.BeginRequest
+		// For query
+		Queries   []*pg.QueryReq
+		QueryID   *string `validate:"omitempty,min=1,max=128"`
+		TimeoutMS *int64  `validate:"omitempty,min=1"`
+	}
+
+	// WSResponse is a message sent by the gateway on a /psql/ws socket
+	WSResponse struct {
+		ID *string `json:",omitempty"`
+		// The request type once it's finished, result for each query result, or error
+		Type string
+		// For begin
+		TxID string `json:",omitempty"`
+		// For result, the index of the query in the request
+		Index *int `json:",omitempty"`
+		// For result
+		Result *pg.QueryRes `json:",omitempty"`
+		// For query, if a query failed, the savepoint that the transaction was rolled back to
+		RolledBackToSavepoint *string `json:",omitempty"`
+		// For query and error, whether the transaction is over because a query failed and it was rolled back
+		TxAborted bool `json:",omitempty"`
+		// For error
+		Error *ErrorResponse `json:",omitempty"`
+	}
+
+	// wsSession is a socket bound to at most one session transaction at a time
+	wsSession struct {
+		c    *CustomContext
+		ws   *websocket.Conn
+		txID string
+	}
+)
+
+var ErrWSOriginNotAllowed = errors.New("origin not allowed")
+
+const (
+	WSTypeBegin    = "begin"
+	WSTypeQuery    = "query"
+	WSTypeCommit   = "commit"
+	WSTypeRollback = "rollback"
+	WSTypeResult   = "result"
+	WSTypeError    = "error"
+
+	// wsMaxQueuedRequests is how many requests can wait on a socket while another is handled
+	wsMaxQueuedRequests = 32
+)
+
+// GetWS upgrades to a websocket that runs a transaction for as long as the socket is open
+func (s *HTTPServer) GetWS(c *CustomContext) error {
+	server := websocket.Server{
+		// Browsers don't apply CORS to websockets, so the origin is checked here
+		Handshake: checkWSOrigin,
+		Handler: func(ws *websocket.Conn) {
+			session := &wsSession{c: c, ws: ws}
+			session.run()
+		},
+	}
+	server.ServeHTTP(c.Response(), c.Request())
+	return nil
+}
+
+// checkWSOrigin only accepts browsers on the same host, or on an origin in WS_ALLOWED_ORIGINS, so that other sites
+// can't open a socket with the user's credentials. Clients that are not browsers don't send an Origin.
+func checkWSOrigin(config *websocket.Config, req *http.Request) error {
+	var err error
+	config.Origin, err = websocket.Origin(config, req)
+	if err != nil {
+		return fmt.Errorf("error in websocket.Origin: %w", err)
+	}
+	if config.Origin == nil || config.Origin.Host == req.Host {
+		return nil
+	}
+	origin := config.Origin.Scheme + "://" + config.Origin.Host
+	for _, allowed := range strings.Split(utils.WS_ALLOWED_ORIGINS, ",") {
+		if strings.TrimSpace(allowed) == origin {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrWSOriginNotAllowed, origin)
+}
+
+// run handles requests one at a time until the socket closes, then rolls back the transaction if one is open
+func (session *wsSession) run() {
+	logger := zerolog.Ctx(session.c.Request().Context())
+	// Cancelled when the socket closes, so a running query doesn't outlive it
+	ctx, cancel := context.WithCancel(session.c.Request().Context())
+	defer cancel()
+
+	// Frames are always being read, even while a query runs, so that a closed socket is noticed right away
+	reqs := make(chan []byte, wsMaxQueuedRequests)
+	go func() {
+		defer cancel()
+		defer close(reqs)
+		for {
+			var msg []byte
+			if err := websocket.Message.Receive(session.ws, &msg); err != nil {
+				return
+			}
+			select {
+			case reqs <- msg:
+			default:
+				// Rejected rather than buffered without limit
+				var req WSRequest
+				_ = json.Unmarshal(msg, &req)
+				session.sendErrorCode(req.ID, ErrCodeValidation, fmt.Sprintf("too many requests queued on this socket, the limit is %d", wsMaxQueuedRequests))
+			}
+		}
+	}()
+
+	for msg := range reqs {
+		if ctx.Err() != nil {
+			// The socket is closed, so queued requests are dropped
+			break
+		}
+		session.handle(ctx, msg)
+	}
+
+	if session.txID != "" {
+		logger.Debug().Str("txID", session.txID).Msg("websocket closed, rolling back session transaction")
+		rollbackCtx, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+		defer cancel()
+		if err := pg.Manager.RollbackTx(logger.WithContext(rollbackCtx), session.txID); err != nil && !errors.Is(err.Err, pg.ErrTxNotFound) {
+			logger.Error().Err(err.Err).Str("txID", session.txID).Msg("error rolling back session transaction")
+		}
+	}
+}
+
+func (session *wsSession) handle(ctx context.Context, msg []byte) {
+	var req WSRequest
+	if err := json.Unmarshal(msg, &req); err != nil {
+		session.sendErrorCode(nil, ErrCodeValidation, err.Error())
+		return
+	}
+	if err := session.c.Validate(&req); err != nil {
+		session.sendErrorCode(req.ID, ErrCodeValidation, validationMessage(err))
+		return
+	}
+
+	switch req.Type {
+	case WSTypeBegin:
+		session.begin(ctx, &req)
+	case WSTypeQuery:
+		session.query(ctx, &req)
+	case WSTypeCommit, WSTypeRollback:
+		session.finish(ctx, &req)
+	}
+}
+
+func (session *wsSession) begin(ctx context.Context, req *WSRequest) {
+	if session.txID != "" {
+		session.sendErrorCode(req.ID, ErrCodeValidation, "a transaction is already open on this socket")
+		return
+	}
+	opts := utils.Deref(req.Options, pg.BeginRequest{})
+	if err := session.c.Validate(&opts); err != nil {
+		session.sendErrorCode(req.ID, ErrCodeValidation, validationMessage(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+
+	txID, err := pg.Manager.NewSessionTx(ctx, &opts)
+	if err != nil {
+		session.sendError(req.ID, err, "error creating new session transaction", false)
+		return
+	}
+	session.txID = txID
+	session.send(&WSResponse{ID: req.ID, Type: WSTypeBegin, TxID: txID})
+}
+
+func (session *wsSession) query(ctx context.Context, req *WSRequest) {
+	if session.txID == "" {
+		session.sendErrorCode(req.ID, ErrCodeValidation, "no transaction is open on this socket, send a begin first")
+		return
+	}
+	if len(req.Queries) == 0 {
+		session.sendErrorCode(req.ID, ErrCodeValidation, "no queries provided")
+		return
+	}
+
+	ctx = pg.WithQueryResultFunc(ctx, func(i int, res *pg.QueryRes) {
+		session.send(&WSResponse{ID: req.ID, Type: WSTypeResult, Index: utils.Ptr(i), Result: res})
+	})
+	res, dErr := pg.Query(ctx, pg.PGPool, &pg.QueryRequest{
+		Queries:   req.Queries,
+		TxID:      utils.Ptr(session.txID),
+		QueryID:   req.QueryID,
+		TimeoutMS: req.TimeoutMS,
+	})
+	// A failed query without a savepoint rolls back the transaction, as does it timing out
+	aborted := pg.Manager.GetTx(session.txID) == nil
+	if aborted {
+		session.txID = ""
+	}
+	if dErr != nil {
+		session.sendError(req.ID, dErr.Err, "error handling session query", aborted)
+		return
+	}
+	session.send(&WSResponse{
+		ID:                    req.ID,
+		Type:                  WSTypeQuery,
+		RolledBackToSavepoint: res.RolledBackToSavepoint,
+		TxAborted:             aborted,
+	})
+}
+
+func (session *wsSession) finish(ctx context.Context, req *WSRequest) {
+	if session.txID == "" {
+		session.sendErrorCode(req.ID, ErrCodeValidation, "no transaction is open on this socket")
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+
+	var dErr *pg.DistributedError
+	if req.Type == WSTypeCommit {
+		dErr = pg.Manager.CommitTx(ctx, session.txID)
+	} else {
+		dErr = pg.Manager.RollbackTx(ctx, session.txID)
+	}
+	// The transaction is over unless it's still in the manager
+	aborted := pg.Manager.GetTx(session.txID) == nil
+	if aborted {
+		session.txID = ""
+	}
+	if dErr != nil {
+		session.sendError(req.ID, dErr.Err, "error finishing session transaction", aborted)
+		return
+	}
+	session.send(&WSResponse{ID: req.ID, Type: req.Type})
+}
+
+// sendError sends the error code for known errors, otherwise it logs the error and sends an internal error
+func (session *wsSession) sendError(id *string, err error, msg string, txAborted bool) {
+	code, errMsg := ErrCodeInternal, "internal error"
+	if _, knownCode, knownMsg, ok := ErrorCode(err); ok {
+		code, errMsg = knownCode, knownMsg
+	} else if errors.Is(err, context.Canceled) {
+		zerolog.Ctx(session.c.Request().Context()).Warn().Msg(err.Error())
+	} else {
+		zerolog.Ctx(session.c.Request().Context()).Error().Err(err).Msg(msg)
+	}
+	session.send(&WSResponse{
+		ID:        id,
+		Type:      WSTypeError,
+		TxAborted: txAborted,
+		Error: &ErrorResponse{
+			Code:      code,
+			Message:   errMsg,
+			RequestID: session.c.RequestID,
+			Pod:       utils.POD_NAME,
+		},
+	})
+}
+
+func (session *wsSession) sendErrorCode(id *string, code, msg string) {
+	session.send(&WSResponse{
+		ID:   id,
+		Type: WSTypeError,
+		Error: &ErrorResponse{
+			Code:      code,
+			Message:   msg,
+			RequestID: session.c.RequestID,
+			Pod:       utils.POD_NAME,
+		},
+	})
+}
+
+func (session *wsSession) send(res *WSResponse) {
+	if err := websocket.JSON.Send(session.ws, res); err != nil {
+		zerolog.Ctx(session.c.Request().Context()).Debug().Err(err).Msg("error sending websocket message")
+	}
+}
@@ -0,0 +1,152 @@
+package http_server
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"golang.org/x/net/websocket"
+)
+
+func TestWSOrigin(t *testing.T) {
+	defer func(port string) {
+		utils.HTTP_PORT = port
+	}(utils.HTTP_PORT)
+	utils.HTTP_PORT = "0"
+	s := StartHTTPServer()
+	defer s.Echo.Close()
+	server := httptest.NewServer(s.Echo)
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/psql/ws", "", server.URL)
+	if err != nil {
+		t.Fatalf("expected a socket from the same origin to be accepted, got %v", err)
+	}
+	ws.Close()
+
+	if _, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/psql/ws", "", "https://evil.example.com"); err == nil {
+		t.Fatal("expected a socket from a foreign origin to be rejected")
+	}
+	defer func(origins string) {
+		utils.WS_ALLOWED_ORIGINS = origins
+	}(utils.WS_ALLOWED_ORIGINS)
+	utils.WS_ALLOWED_ORIGINS = "https://app.example.com, https://other.example.com"
+	allowed, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/psql/ws", "", "https://other.example.com")
+	if err != nil {
+		t.Fatalf("expected a socket from an allowed origin to be accepted, got %v", err)
+	}
+	allowed.Close()
+}
+
+func TestWSIdleSession(t *testing.T) {
+	var mu sync.Mutex
+	var statements []string
+	pool := startFakeBackend(t, func(backend *pgproto3.Backend, query string) error {
+		mu.Lock()
+		statements = append(statements, query)
+		mu.Unlock()
+		txStatus := byte('I')
+		if query == "begin" {
+			txStatus = 'T'
+		}
+		backend.Send(&pgproto3.CommandComplete{CommandTag: []byte(strings.ToUpper(query))})
+		backend.Send(&pgproto3.ReadyForQuery{TxStatus: txStatus})
+		return nil
+	})
+
+	defer func(pool *pgxpool.Pool, manager *pg.TxManager, port string) {
+		pg.PGPool, pg.Manager, utils.HTTP_PORT = pool, manager, port
+	}(pg.PGPool, pg.Manager, utils.HTTP_PORT)
+	pg.PGPool, pg.Manager, utils.HTTP_PORT = pool, pg.NewTxManager(), "0"
+	defer pg.Manager.Shutdown()
+	s := StartHTTPServer()
+	defer s.Echo.Close()
+	server := httptest.NewServer(s.Echo)
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/psql/ws", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ws.Close()
+	request := func(req string) WSResponse {
+		if err := websocket.Message.Send(ws, req); err != nil {
+			t.Fatal(err)
+		}
+		var res WSResponse
+		if err := websocket.JSON.Receive(ws, &res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	if res := request(`{"Type":"begin","Options":{"TxTimeoutSec":1}}`); res.Type != WSTypeBegin {
+		t.Fatalf("expected begin, got %+v", res.Error)
+	}
+	// Idle past the timeout and an expiry check
+	time.Sleep(time.Second * 3)
+	if res := request(`{"Type":"commit"}`); res.Type != WSTypeCommit {
+		t.Fatalf("expected commit, got %+v", res.Error)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if strings.Join(statements, ",") != "begin,commit" {
+		t.Fatalf("expected the transaction to be committed, got %q", statements)
+	}
+}
+
+func TestWSDisconnectCancelsQuery(t *testing.T) {
+	running, cancelled := make(chan bool, 1), make(chan bool, 1)
+	pool := startFakeBackend(t, func(backend *pgproto3.Backend, query string) error {
+		if query == "begin" {
+			backend.Send(&pgproto3.CommandComplete{CommandTag: []byte("BEGIN")})
+			backend.Send(&pgproto3.ReadyForQuery{TxStatus: 'T'})
+			return nil
+		}
+		// Never finishes, so the query only ends if the client gives up on it and terminates the connection
+		running <- true
+		backend.Receive()
+		cancelled <- true
+		return errors.New("query cancelled")
+	})
+
+	defer func(pool *pgxpool.Pool, manager *pg.TxManager, port string) {
+		pg.PGPool, pg.Manager, utils.HTTP_PORT = pool, manager, port
+	}(pg.PGPool, pg.Manager, utils.HTTP_PORT)
+	pg.PGPool, pg.Manager, utils.HTTP_PORT = pool, pg.NewTxManager(), "0"
+	defer pg.Manager.Shutdown()
+	s := StartHTTPServer()
+	defer s.Echo.Close()
+	server := httptest.NewServer(s.Echo)
+	defer server.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(server.URL, "http")+"/psql/ws", "", server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, req := range []string{`{"Type":"begin"}`, `{"Type":"query","Queries":[{"Statement":"SELECT pg_sleep(60)","Exec":true}]}`} {
+		if err := websocket.Message.Send(ws, req); err != nil {
+			t.Fatal(err)
+		}
+	}
+	<-running
+	// A request sent while the query runs is queued, and doesn't stop the socket from being read
+	if err := websocket.Message.Send(ws, `{"Type":"commit"}`); err != nil {
+		t.Fatal(err)
+	}
+	ws.Close()
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the query to be cancelled when the socket closed")
+	}
+}
@@ -2,9 +2,13 @@ package ksd
 
 import (
 	"fmt"
+	"sort"
+	"sync"
+	"time"
+
 	"github.com/danthegoodman1/SQLGateway/gologger"
+	"github.com/danthegoodman1/SQLGateway/utils"
 	v1 "k8s.io/api/core/v1"
-	"time"
 
 	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/informers"
@@ -15,19 +19,36 @@ import (
 
 var (
 	logger = gologger.NewLogger()
+
+	// Discovery is the pod peer set when running with K8S_SD, nil otherwise
+	Discovery *KSD
 )
 
 type (
 	KSD struct {
-		kubeClient      *kubernetes.Clientset
+		kubeClient      kubernetes.Interface
 		informerFactory informers.SharedInformerFactory
 		podInformer     cache.SharedIndexInformer
 		stopChan        chan struct{}
+		onDelete        func(pod *v1.Pod)
+
+		peersMu *sync.Mutex
+		peers   map[string]*PodPeer
+	}
+
+	PodPeer struct {
+		PodName string
+		PodIP   string
+		// PodURL is {PodIP}:{HTTP_PORT}, empty until the pod has an IP
+		PodURL string
+		Ready  bool
+		// Updated is when the informer last saw a change to the pod
+		Updated time.Time
 	}
 )
 
-// NewPodKSD creates a new endpoint watcher that listens for added, deleted, and updated endpoints.
-func NewPodKSD(namespace, labelSelector string, addFunc, deleteFunc func(obj *v1.Pod), updateFunc func(oldObj, newObj *v1.Pod)) (*KSD, error) {
+// InClusterClient creates a kubernetes client from the service account of the pod
+func InClusterClient() (kubernetes.Interface, error) {
 	config, err := rest.InClusterConfig()
 	if err != nil {
 		return nil, fmt.Errorf("error in rest.InClusterConfig: %w", err)
@@ -37,40 +58,112 @@ func NewPodKSD(namespace, labelSelector string, addFunc, deleteFunc func(obj *v1
 	if err != nil {
 		return nil, fmt.Errorf("error in kubernetes.NewForConfig: %w", err)
 	}
+	return client, nil
+}
+
+// NewPodKSD creates a new pod watcher that maintains the peer set from the pods matching the label selector.
+// onDelete is called when a pod is deleted, after it is removed from the peer set.
+func NewPodKSD(client kubernetes.Interface, namespace, labelSelector string, resyncTime time.Duration, onDelete func(pod *v1.Pod)) (*KSD, error) {
 	logger.Debug().Msg("starting informer factory")
 
-	// TODO: Make time configurable
-	resyncTime := 30 * time.Second
 	informerFactory := informers.NewSharedInformerFactoryWithOptions(client, resyncTime, informers.WithNamespace(namespace), informers.WithTweakListOptions(func(options *v12.ListOptions) {
 		options.LabelSelector = labelSelector
 	}))
 
-	podInformer := informerFactory.Core().V1().Pods().Informer()
-	podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
+	ksd := &KSD{
+		kubeClient:      client,
+		informerFactory: informerFactory,
+		podInformer:     informerFactory.Core().V1().Pods().Informer(),
+		stopChan:        make(chan struct{}),
+		onDelete:        onDelete,
+		peersMu:         &sync.Mutex{},
+		peers:           map[string]*PodPeer{},
+	}
+
+	ksd.podInformer.AddEventHandler(cache.ResourceEventHandlerFuncs{
 		AddFunc: func(obj interface{}) {
 			logger.Debug().Interface("obj", obj).Str("informer", "pod").Msg("got add event")
-			addFunc(obj.(*v1.Pod))
+			ksd.setPeer(obj.(*v1.Pod))
 		},
 		UpdateFunc: func(oldObj, newObj interface{}) {
 			logger.Debug().Interface("old_obj", oldObj).Interface("new_obj", newObj).Str("informer", "pod").Msg("got update event")
-			updateFunc(oldObj.(*v1.Pod), newObj.(*v1.Pod))
+			ksd.setPeer(newObj.(*v1.Pod))
 		},
 		DeleteFunc: func(obj interface{}) {
 			logger.Debug().Interface("obj", obj).Str("informer", "pod").Msg("got delete event")
-			deleteFunc(obj.(*v1.Pod))
+			// If the watch missed the delete then we get the last known state
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			pod, ok := obj.(*v1.Pod)
+			if !ok {
+				logger.Error().Interface("obj", obj).Msg("got delete event for unknown object")
+				return
+			}
+			ksd.deletePeer(pod)
 		},
 	})
-	stopChan := make(chan struct{})
-	go podInformer.Run(stopChan)
+	go ksd.podInformer.Run(ksd.stopChan)
 
-	ksd := &KSD{
-		kubeClient:      client,
-		informerFactory: informerFactory,
-		podInformer:     podInformer,
-		stopChan:        stopChan,
+	return ksd, nil
+}
+
+func (k *KSD) setPeer(pod *v1.Pod) {
+	peer := &PodPeer{
+		PodName: pod.Name,
+		PodIP:   pod.Status.PodIP,
+		Ready:   podReady(pod),
+		Updated: time.Now(),
+	}
+	if peer.PodIP != "" {
+		peer.PodURL = fmt.Sprintf("%s:%s", peer.PodIP, utils.HTTP_PORT)
 	}
 
-	return ksd, nil
+	k.peersMu.Lock()
+	defer k.peersMu.Unlock()
+	k.peers[pod.Name] = peer
+}
+
+func (k *KSD) deletePeer(pod *v1.Pod) {
+	k.peersMu.Lock()
+	delete(k.peers, pod.Name)
+	k.peersMu.Unlock()
+
+	if k.onDelete != nil {
+		k.onDelete(pod)
+	}
+}
+
+func podReady(pod *v1.Pod) bool {
+	if pod.DeletionTimestamp != nil {
+		return false
+	}
+	for _, condition := range pod.Status.Conditions {
+		if condition.Type == v1.PodReady {
+			return condition.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// HasSynced returns whether the informer has done its initial list of pods
+func (k *KSD) HasSynced() bool {
+	return k.podInformer.HasSynced()
+}
+
+// Peers returns the pods in the peer set sorted by name, including ones that are not ready
+func (k *KSD) Peers() []*PodPeer {
+	k.peersMu.Lock()
+	defer k.peersMu.Unlock()
+
+	peers := make([]*PodPeer, 0, len(k.peers))
+	for _, peer := range k.peers {
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].PodName < peers[j].PodName
+	})
+	return peers
 }
 
 func (k *KSD) Stop() {
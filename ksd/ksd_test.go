@@ -0,0 +1,84 @@
+package ksd
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	v1 "k8s.io/api/core/v1"
+	v12 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func waitFor(t *testing.T, msg string, f func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second * 5)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("timed out waiting for %s", msg)
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
+
+func TestPodKSD(t *testing.T) {
+	ctx := context.Background()
+	client := fake.NewSimpleClientset()
+
+	deleted := make(chan string, 1)
+	k, err := NewPodKSD(client, "default", "app=SQLGateway", time.Minute, func(pod *v1.Pod) {
+		deleted <- pod.Name
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Stop()
+	waitFor(t, "informer sync", k.HasSynced)
+
+	pod := &v1.Pod{
+		ObjectMeta: v12.ObjectMeta{
+			Name:      "sqlgateway-0",
+			Namespace: "default",
+			Labels:    map[string]string{"app": "SQLGateway"},
+		},
+		Status: v1.PodStatus{
+			PodIP: "10.0.0.1",
+		},
+	}
+	_, err = client.CoreV1().Pods("default").Create(ctx, pod, v12.CreateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "pod to be added", func() bool {
+		return len(k.Peers()) == 1
+	})
+	if peer := k.Peers()[0]; peer.Ready || peer.PodIP != "10.0.0.1" {
+		t.Fatalf("expected pod to not be ready yet, got %+v", peer)
+	}
+
+	pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+	_, err = client.CoreV1().Pods("default").UpdateStatus(ctx, pod, v12.UpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitFor(t, "pod to be ready", func() bool {
+		peers := k.Peers()
+		return len(peers) == 1 && peers[0].Ready
+	})
+
+	err = client.CoreV1().Pods("default").Delete(ctx, pod.Name, v12.DeleteOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case name := <-deleted:
+		if name != pod.Name {
+			t.Fatalf("expected delete of %s, got %s", pod.Name, name)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for delete")
+	}
+	if len(k.Peers()) != 0 {
+		t.Fatalf("expected no peers after delete, got %+v", k.Peers())
+	}
+}
@@ -3,8 +3,16 @@ package main
 import (
 	"context"
 	"fmt"
+	"github.com/danthegoodman1/SQLGateway/cdc"
+	"github.com/danthegoodman1/SQLGateway/coord"
+	"github.com/danthegoodman1/SQLGateway/etcd"
+	"github.com/danthegoodman1/SQLGateway/grpc_server"
+	"github.com/danthegoodman1/SQLGateway/ksd"
+	"github.com/danthegoodman1/SQLGateway/peer"
 	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/pgwire"
 	"github.com/danthegoodman1/SQLGateway/red"
+	v1 "k8s.io/api/core/v1"
 	"os"
 	"os/signal"
 	"syscall"
@@ -25,33 +33,67 @@ func main() {
 		os.Exit(1)
 	}
 
+	if utils.REDIS_ADDR != "" && utils.ETCD_ENDPOINTS != "" {
+		logger.Error().Msg("only one of REDIS_ADDR and ETCD_ENDPOINTS can be set")
+		os.Exit(1)
+	}
+
 	if utils.REDIS_ADDR != "" {
-		if err := red.ConnectRedis(); err != nil {
+		client, err := red.ConnectRedis()
+		if err != nil {
 			logger.Error().Err(err).Msg("error connecting to Redis")
 			os.Exit(1)
 		}
+		coord.Client = client
+	}
+
+	if utils.ETCD_ENDPOINTS != "" {
+		client, err := etcd.Connect()
+		if err != nil {
+			logger.Error().Err(err).Msg("error connecting to etcd")
+			os.Exit(1)
+		}
+		coord.Client = client
 	}
 
-	//if utils.K8S_SD {
-	//	k, err := ksd.NewPodKSD("default", "app=SQLGateway", func(obj *v1.Pod) {
-	//		//fmt.Println("ADD EVENT: %+v", obj)
-	//	}, func(obj *v1.Pod) {
-	//		//fmt.Println("DELETE EVENT: %+v", obj)
-	//	}, func(oldObj, newObj *v1.Pod) {
-	//		//fmt.Println("UPDATE EVENT OLD: %+v", oldObj)
-	//		//fmt.Println("UPDATE EVENT NEW: %+v", newObj)
-	//	})
-	//	if err != nil {
-	//		logger.Error().Err(err).Msg("failed to create new pod ksd")
-	//		os.Exit(1)
-	//	}
-	//	defer k.Stop()
-	//}
+	if utils.K8S_SD {
+		client, err := ksd.InClusterClient()
+		if err != nil {
+			logger.Error().Err(err).Msg("error creating kubernetes client")
+			os.Exit(1)
+		}
+		ksd.Discovery, err = ksd.NewPodKSD(client, utils.K8S_SD_NAMESPACE, utils.K8S_SD_LABEL_SELECTOR, time.Second*time.Duration(utils.K8S_SD_RESYNC_SEC), cleanupDeletedPod)
+		if err != nil {
+			logger.Error().Err(err).Msg("failed to create new pod ksd")
+			os.Exit(1)
+		}
+	}
 
 	pg.Manager = pg.NewTxManager()
+	pg.Listener = pg.NewNotificationListener(pg.PGPool)
 
 	httpServer := http_server.StartHTTPServer()
 
+	var pgwireServer *pgwire.Server
+	if utils.PGWIRE_PORT != "" {
+		var err error
+		pgwireServer, err = pgwire.StartServer()
+		if err != nil {
+			logger.Error().Err(err).Msg("error starting pgwire server")
+			os.Exit(1)
+		}
+	}
+
+	var grpcServer *grpc_server.Server
+	if utils.GRPC_PORT != "" {
+		var err error
+		grpcServer, err = grpc_server.StartGRPCServer()
+		if err != nil {
+			logger.Error().Err(err).Msg("error starting grpc server")
+			os.Exit(1)
+		}
+	}
+
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	<-c
@@ -59,26 +101,75 @@ func main() {
 
 	// Convert the time to seconds
 	sleepTime := utils.GetEnvOrDefaultInt("SHUTDOWN_SLEEP_SEC", 0)
-	logger.Info().Msg(fmt.Sprintf("sleeping for %ds before exiting", sleepTime))
+	logger.Info().Msg(fmt.Sprintf("draining transactions for %ds before exiting", sleepTime))
 
-	time.Sleep(time.Second * time.Duration(sleepTime))
+	sleepDeadline := time.Now().Add(time.Second * time.Duration(sleepTime))
+	drainCtx, drainCancel := context.WithDeadline(context.Background(), sleepDeadline)
+	pg.Manager.Drain(drainCtx)
+	drainCancel()
+
+	// Keep failing readiness for the full time so load balancers have stopped routing to us
+	time.Sleep(time.Until(sleepDeadline))
 	logger.Info().Msg(fmt.Sprintf("slept for %ds, exiting", sleepTime))
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*time.Duration(utils.SHUTDOWN_TIMEOUT_SEC))
 	defer cancel()
+	// End listen and changes streams first, the HTTP server waits for them otherwise
+	pg.Listener.Shutdown()
+	logger.Info().Msg("shut down notification listener")
+	cdc.Shutdown()
+	logger.Info().Msg("shut down changes streams")
 	if err := httpServer.Shutdown(ctx); err != nil {
 		logger.Error().Err(err).Msg("failed to shutdown HTTP server")
 	} else {
 		logger.Info().Msg("successfully shutdown HTTP server")
 	}
-	if utils.REDIS_ADDR != "" {
-		if err := red.Shutdown(ctx); err != nil {
-			logger.Error().Err(err).Msg("error shutting down redis connection")
+	if pgwireServer != nil {
+		if err := pgwireServer.Shutdown(ctx); err != nil {
+			logger.Error().Err(err).Msg("failed to shutdown pgwire server")
+		} else {
+			logger.Info().Msg("successfully shutdown pgwire server")
+		}
+	}
+	if grpcServer != nil {
+		if err := grpcServer.Shutdown(ctx); err != nil {
+			logger.Error().Err(err).Msg("failed to shutdown grpc server")
 		} else {
-			logger.Info().Msg("shut down redis")
+			logger.Info().Msg("successfully shutdown grpc server")
 		}
 	}
 	pg.Manager.Shutdown()
 	logger.Info().Msg("shut down tx manager")
+	peer.DefaultClient.CloseIdleConnections()
+	if ksd.Discovery != nil {
+		ksd.Discovery.Stop()
+	}
+	if coord.Client != nil {
+		if err := coord.Client.Shutdown(ctx); err != nil {
+			logger.Error().Err(err).Str("coordinator", coord.Client.Name()).Msg("error shutting down coordinator")
+		} else {
+			logger.Info().Str("coordinator", coord.Client.Name()).Msg("shut down coordinator")
+		}
+	}
 	os.Exit(0)
 }
+
+// cleanupDeletedPod removes a deleted pod's transactions from the coordinator, since its transactions died with it
+func cleanupDeletedPod(pod *v1.Pod) {
+	if coord.Client == nil || pod.Name == utils.POD_NAME {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	deleted, err := coord.Client.DeleteTransactionsForPod(ctx, pod.Name)
+	if err != nil {
+		logger.Error().Err(err).Str("pod", pod.Name).Msg("error deleting transactions of deleted pod")
+		return
+	}
+	if err := coord.Client.RemovePeer(ctx, pod.Name); err != nil {
+		logger.Error().Err(err).Str("pod", pod.Name).Msg("error removing deleted pod from peers")
+	}
+	logger.Info().Str("pod", pod.Name).Int("transactions", deleted).Msg("cleaned up deleted pod")
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"github.com/danthegoodman1/SQLGateway/coord"
 	"github.com/danthegoodman1/SQLGateway/pg"
 	"github.com/danthegoodman1/SQLGateway/red"
 	"github.com/danthegoodman1/SQLGateway/utils"
@@ -16,19 +17,23 @@ func TestMain(t *testing.M) {
 	}
 
 	if utils.REDIS_ADDR != "" {
-		if err := red.ConnectRedis(); err != nil {
+		client, err := red.ConnectRedis()
+		if err != nil {
 			logger.Error().Err(err).Msg("error connecting to Redis")
 			os.Exit(1)
 		}
+		coord.Client = client
 	}
 
 	c := t.Run()
 
 	pg.PGPool.Close()
-	err := red.Shutdown(context.Background())
-	if err != nil {
-		logger.Error().Err(err).Msg("error shutting down to Redis")
-		os.Exit(1)
+	if coord.Client != nil {
+		err := coord.Client.Shutdown(context.Background())
+		if err != nil {
+			logger.Error().Err(err).Msg("error shutting down to Redis")
+			os.Exit(1)
+		}
 	}
 	logger.Debug().Msg("done tests")
 	os.Exit(c)
@@ -0,0 +1,79 @@
+package peer
+
+import (
+	"time"
+)
+
+type (
+	BreakerState string
+
+	// breaker is a circuit breaker for a single pod, guarded by the mutex of its peerState
+	breaker struct {
+		state BreakerState
+		// failures is the number of consecutive failed requests
+		failures int64
+		openedAt time.Time
+		// trialInFlight is whether the one request allowed while half open has not finished yet
+		trialInFlight bool
+	}
+)
+
+const (
+	// BreakerClosed lets all requests through
+	BreakerClosed BreakerState = "closed"
+	// BreakerOpen rejects all requests until the cooldown has passed
+	BreakerOpen BreakerState = "open"
+	// BreakerHalfOpen lets a single request through to check whether the pod has recovered
+	BreakerHalfOpen BreakerState = "half_open"
+)
+
+func newBreaker() *breaker {
+	return &breaker{
+		state: BreakerClosed,
+	}
+}
+
+// allow returns whether a request can be made, which must then be reported with success or failure
+func (b *breaker) allow(now time.Time, cooldown time.Duration) bool {
+	switch b.state {
+	case BreakerOpen:
+		if now.Sub(b.openedAt) < cooldown {
+			return false
+		}
+		b.state = BreakerHalfOpen
+		b.trialInFlight = true
+		return true
+	case BreakerHalfOpen:
+		if b.trialInFlight {
+			return false
+		}
+		b.trialInFlight = true
+		return true
+	default:
+		return true
+	}
+}
+
+func (b *breaker) success() {
+	b.state = BreakerClosed
+	b.failures = 0
+	b.trialInFlight = false
+}
+
+// abandoned records a request that the caller gave up on, which says nothing about the pod. A trial request is let
+// through again.
+func (b *breaker) abandoned() {
+	b.trialInFlight = false
+}
+
+// failure records a failed request, returning whether it opened the breaker
+func (b *breaker) failure(now time.Time, maxFailures int64) bool {
+	b.failures++
+	b.trialInFlight = false
+	if b.state == BreakerHalfOpen || (b.state == BreakerClosed && b.failures >= maxFailures) {
+		b.state = BreakerOpen
+		b.openedAt = now
+		return true
+	}
+	return false
+}
@@ -0,0 +1,43 @@
+package peer
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	b := newBreaker()
+	now := time.Now()
+	cooldown := time.Second
+
+	if !b.allow(now, cooldown) || b.failure(now, 2) {
+		t.Fatal("expected the breaker to stay closed after one failure")
+	}
+	if !b.allow(now, cooldown) || !b.failure(now, 2) {
+		t.Fatal("expected the breaker to open after two failures")
+	}
+	if b.allow(now.Add(cooldown/2), cooldown) {
+		t.Fatal("expected the breaker to reject during the cooldown")
+	}
+
+	// One trial request is let through after the cooldown
+	now = now.Add(cooldown)
+	if !b.allow(now, cooldown) || b.state != BreakerHalfOpen {
+		t.Fatal("expected a trial request after the cooldown")
+	}
+	if b.allow(now, cooldown) {
+		t.Fatal("expected only one trial request")
+	}
+	if !b.failure(now, 2) {
+		t.Fatal("expected a failed trial to open the breaker again")
+	}
+
+	now = now.Add(cooldown)
+	if !b.allow(now, cooldown) {
+		t.Fatal("expected a trial request after the cooldown")
+	}
+	b.success()
+	if b.state != BreakerClosed || b.failures != 0 || !b.allow(now, cooldown) {
+		t.Fatalf("expected a successful trial to close the breaker, got %+v", b)
+	}
+}
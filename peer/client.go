@@ -0,0 +1,395 @@
+package peer
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/UltimateTournament/backoff/v4"
+	"github.com/danthegoodman1/SQLGateway/gologger"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"golang.org/x/net/http2"
+)
+
+var (
+	logger = gologger.NewLogger()
+
+	ErrBreakerOpen = errors.New("circuit breaker is open for pod")
+	// errUnhealthyStatus is counted against a pod that responded, but with a status meaning it can't serve requests
+	errUnhealthyStatus = errors.New("pod responded with an unhealthy status")
+
+	// DefaultClient is used for all requests to other pods
+	DefaultClient = NewClient()
+)
+
+type (
+	// Client makes requests to other pods over reused connections, with retries and a circuit breaker per pod
+	Client struct {
+		httpClient *http.Client
+		scheme     string
+
+		timeout         time.Duration
+		retries         int64
+		breakerFailures int64
+		breakerCooldown time.Duration
+		// idleTTL is how long stats are kept for a pod that has not been sent a request
+		idleTTL time.Duration
+
+		peersMu *sync.Mutex
+		peers   map[string]*peerState
+	}
+
+	Request struct {
+		Method string
+		Path   string
+		// Body is encoded as JSON if not nil
+		Body any
+		// Idempotent requests are retried on any connection error, others only if the connection could not be made
+		Idempotent bool
+		// Timeout is used instead of PEER_TIMEOUT_MS if it is longer
+		Timeout time.Duration
+	}
+
+	// StreamRequest is a request whose body and response are streamed rather than buffered
+	StreamRequest struct {
+		Method string
+		// Path including the query string
+		Path        string
+		Body        io.Reader
+		ContentType string
+	}
+
+	Response struct {
+		StatusCode int
+		Body       []byte
+	}
+
+	// PeerStats are the counters of requests to a pod since it was first sent a request
+	PeerStats struct {
+		PodURL       string
+		BreakerState BreakerState
+		// Requests is every attempt, including retries
+		Requests int64
+		// Errors are attempts that failed to get a response, or got a 502, 503, or 504
+		Errors  int64
+		Retries int64
+		// Rejected are requests that were not attempted because the breaker was open
+		Rejected            int64
+		ConsecutiveFailures int64
+		AvgLatencyMS        float64
+		LastError           string     `json:",omitempty"`
+		LastErrorTime       *time.Time `json:",omitempty"`
+	}
+
+	peerState struct {
+		mu       *sync.Mutex
+		breaker  *breaker
+		stats    PeerStats
+		latency  time.Duration
+		lastUsed time.Time
+	}
+)
+
+// NewClient creates a client from the PEER_ config, using h2c unless POD_HTTPS is set to match the HTTP server
+func NewClient() *Client {
+	return &Client{
+		httpClient: &http.Client{
+			Transport: newTransport(utils.POD_HTTPS),
+		},
+		scheme:          utils.GetHTTPPrefix(),
+		timeout:         time.Millisecond * time.Duration(utils.PEER_TIMEOUT_MS),
+		retries:         utils.PEER_RETRIES,
+		breakerFailures: utils.PEER_BREAKER_FAILURES,
+		breakerCooldown: time.Millisecond * time.Duration(utils.PEER_BREAKER_COOLDOWN_MS),
+		idleTTL:         time.Minute * 10,
+		peersMu:         &sync.Mutex{},
+		peers:           map[string]*peerState{},
+	}
+}
+
+func newTransport(https bool) http.RoundTripper {
+	if https {
+		return &http.Transport{
+			ForceAttemptHTTP2:   true,
+			MaxIdleConnsPerHost: 16,
+			IdleConnTimeout:     time.Second * 90,
+			TLSHandshakeTimeout: time.Second * 10,
+		}
+	}
+
+	dialer := &net.Dialer{
+		Timeout:   time.Second * 5,
+		KeepAlive: time.Second * 30,
+	}
+	return &http2.Transport{
+		AllowHTTP: true,
+		// h2c, so there is no TLS even though the transport calls it to dial
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return dialer.DialContext(ctx, network, addr)
+		},
+		// Ping connections that have gone quiet so dead pods are noticed
+		ReadIdleTimeout: time.Second * 30,
+		PingTimeout:     time.Second * 15,
+	}
+}
+
+// Do sends the request to the pod, retrying if it is safe to. Any response from the pod is returned without an
+// error, whatever the status code. If the pod's breaker is open then ErrBreakerOpen is returned.
+func (c *Client) Do(ctx context.Context, podURL string, req *Request) (*Response, error) {
+	var body []byte
+	if req.Body != nil {
+		var err error
+		body, err = json.Marshal(req.Body)
+		if err != nil {
+			return nil, fmt.Errorf("error in json.Marshal for request body: %w", err)
+		}
+	}
+
+	timeout := c.timeout
+	if req.Timeout > timeout {
+		timeout = req.Timeout
+	}
+
+	peer := c.getPeer(podURL)
+	cfg := backoff.NewExponentialBackOff()
+	cfg.InitialInterval = time.Millisecond * 50
+	cfg.MaxInterval = time.Second
+
+	var res *Response
+	err := backoff.RetryNotify(func() error {
+		if !peer.allow(c.breakerCooldown) {
+			return backoff.Permanent(fmt.Errorf("%w %s", ErrBreakerOpen, podURL))
+		}
+
+		s := time.Now()
+		var err error
+		res, err = c.do(ctx, podURL, req, body, timeout)
+		failure := err
+		if err == nil {
+			// The response is still returned, but a pod that is up and failing every request should trip the breaker
+			failure = statusError(res.StatusCode)
+		}
+		peer.done(ctx, time.Since(s), failure, c.breakerFailures)
+		if err == nil {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return backoff.Permanent(err)
+		}
+		if req.Idempotent || isDialError(err) {
+			return err
+		}
+		return backoff.Permanent(err)
+	}, backoff.WithContext(backoff.WithMaxRetries(cfg, uint64(c.retries)), ctx), func(err error, next time.Duration) {
+		logger.Debug().Err(err).Str("podURL", podURL).Str("path", req.Path).Msgf("retrying request to pod in %s", next)
+		peer.retried()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Stream sends the request to the pod and returns the response as soon as its headers arrive, the caller must close
+// its body. It is never retried since the body can only be read once, and the caller's context is the only timeout. If
+// the pod's breaker is open then ErrBreakerOpen is returned.
+func (c *Client) Stream(ctx context.Context, podURL string, req *StreamRequest) (*http.Response, error) {
+	peer := c.getPeer(podURL)
+	if !peer.allow(c.breakerCooldown) {
+		return nil, fmt.Errorf("%w %s", ErrBreakerOpen, podURL)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, fmt.Sprintf("%s://%s%s", c.scheme, podURL, req.Path), req.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error in http.NewRequestWithContext: %w", err)
+	}
+	if req.ContentType != "" {
+		httpReq.Header.Set("content-type", req.ContentType)
+	}
+	setAuth(httpReq, req.Path)
+
+	s := time.Now()
+	httpRes, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		peer.done(ctx, time.Since(s), err, c.breakerFailures)
+		return nil, err
+	}
+	peer.done(ctx, time.Since(s), statusError(httpRes.StatusCode), c.breakerFailures)
+	return httpRes, nil
+}
+
+func (c *Client) do(ctx context.Context, podURL string, req *Request, body []byte, timeout time.Duration) (*Response, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	httpReq, err := http.NewRequestWithContext(ctx, req.Method, fmt.Sprintf("%s://%s%s", c.scheme, podURL, req.Path), bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error in http.NewRequestWithContext: %w", err)
+	}
+	if body != nil {
+		httpReq.Header.Set("content-type", "application/json")
+	}
+	setAuth(httpReq, req.Path)
+
+	httpRes, err := c.httpClient.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer httpRes.Body.Close()
+
+	resBody, err := io.ReadAll(httpRes.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	return &Response{
+		StatusCode: httpRes.StatusCode,
+		Body:       resBody,
+	}, nil
+}
+
+// setAuth adds the credentials that the pod requires for the path, since it checks them like for any other client
+func setAuth(httpReq *http.Request, path string) {
+	if strings.HasPrefix(path, "/admin/") {
+		httpReq.SetBasicAuth(utils.ADMIN_USER, utils.ADMIN_PASS)
+		return
+	}
+	if utils.AUTH_USER != "" && utils.AUTH_PASS != "" {
+		httpReq.SetBasicAuth(utils.AUTH_USER, utils.AUTH_PASS)
+	}
+}
+
+// statusError returns an error for the statuses of a pod that is up but unhealthy, or a proxy in front of it that
+// can't reach it
+func statusError(statusCode int) error {
+	switch statusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return fmt.Errorf("%w %d", errUnhealthyStatus, statusCode)
+	}
+	return nil
+}
+
+// isDialError returns whether the connection could not be made, so the request was never sent
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial"
+}
+
+func (c *Client) getPeer(podURL string) *peerState {
+	c.peersMu.Lock()
+	defer c.peersMu.Unlock()
+
+	peer, exists := c.peers[podURL]
+	if exists {
+		return peer
+	}
+
+	// Pods come and go, so forget the ones that have not been used in a while
+	for url, p := range c.peers {
+		p.mu.Lock()
+		idle := time.Since(p.lastUsed) > c.idleTTL
+		p.mu.Unlock()
+		if idle {
+			delete(c.peers, url)
+		}
+	}
+
+	peer = &peerState{
+		mu:       &sync.Mutex{},
+		breaker:  newBreaker(),
+		stats:    PeerStats{PodURL: podURL},
+		lastUsed: time.Now(),
+	}
+	c.peers[podURL] = peer
+	return peer
+}
+
+// Stats returns the stats of the pods that have been sent requests, sorted by URL
+func (c *Client) Stats() []PeerStats {
+	c.peersMu.Lock()
+	peers := make([]*peerState, 0, len(c.peers))
+	for _, peer := range c.peers {
+		peers = append(peers, peer)
+	}
+	c.peersMu.Unlock()
+
+	stats := make([]PeerStats, 0, len(peers))
+	for _, peer := range peers {
+		stats = append(stats, peer.snapshot())
+	}
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].PodURL < stats[j].PodURL
+	})
+	return stats
+}
+
+// CloseIdleConnections closes the connections to other pods that are not in use
+func (c *Client) CloseIdleConnections() {
+	c.httpClient.CloseIdleConnections()
+}
+
+func (p *peerState) allow(cooldown time.Duration) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.lastUsed = time.Now()
+	if !p.breaker.allow(p.lastUsed, cooldown) {
+		p.stats.Rejected++
+		return false
+	}
+	p.stats.Requests++
+	return true
+}
+
+// done records the result of a request. Errors after the caller's context ended are not counted against the pod, since
+// the caller cancelling or running out of time does not mean the pod is unhealthy.
+func (p *peerState) done(ctx context.Context, latency time.Duration, err error, maxFailures int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.latency += latency
+	if err == nil {
+		p.breaker.success()
+		return
+	}
+	if ctx.Err() != nil {
+		p.breaker.abandoned()
+		return
+	}
+
+	now := time.Now()
+	p.stats.Errors++
+	p.stats.LastError = err.Error()
+	p.stats.LastErrorTime = &now
+	if p.breaker.failure(now, maxFailures) {
+		logger.Warn().Err(err).Str("podURL", p.stats.PodURL).Msg("opened circuit breaker for pod")
+	}
+}
+
+func (p *peerState) retried() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.stats.Retries++
+}
+
+func (p *peerState) snapshot() PeerStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	stats := p.stats
+	stats.BreakerState = p.breaker.state
+	stats.ConsecutiveFailures = p.breaker.failures
+	if stats.Requests > 0 {
+		stats.AvgLatencyMS = float64(p.latency.Microseconds()) / 1000 / float64(stats.Requests)
+	}
+	return stats
+}
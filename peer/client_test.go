@@ -0,0 +1,242 @@
+package peer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// newH2CServer starts a server like the HTTP server of a pod, returning its host:port
+func newH2CServer(t *testing.T, handler http.HandlerFunc) (string, *int64) {
+	t.Helper()
+	var conns int64
+	srv := httptest.NewUnstartedServer(h2c.NewHandler(handler, &http2.Server{}))
+	srv.Config.ConnState = func(conn net.Conn, state http.ConnState) {
+		if state == http.StateNew {
+			atomic.AddInt64(&conns, 1)
+		}
+	}
+	srv.Start()
+	t.Cleanup(srv.Close)
+	return strings.TrimPrefix(srv.URL, "http://"), &conns
+}
+
+func newTestClient() *Client {
+	c := NewClient()
+	c.retries = 2
+	c.breakerFailures = 2
+	// Longer than the retry backoff, so a retry never finds the breaker half-open
+	c.breakerCooldown = time.Second * 10
+	return c
+}
+
+func TestClientReusesH2CConnection(t *testing.T) {
+	podURL, conns := newH2CServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor != 2 {
+			w.WriteHeader(http.StatusHTTPVersionNotSupported)
+			return
+		}
+		w.WriteHeader(http.StatusTeapot)
+		w.Write([]byte(r.URL.Path))
+	})
+	c := newTestClient()
+
+	for i := 0; i < 5; i++ {
+		res, err := c.Do(context.Background(), podURL, &Request{
+			Method: http.MethodPost,
+			Path:   "/psql/query",
+			Body:   map[string]string{"a": "b"},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.StatusCode != http.StatusTeapot || string(res.Body) != "/psql/query" {
+			t.Fatalf("unexpected response %d %s", res.StatusCode, res.Body)
+		}
+	}
+	if n := atomic.LoadInt64(conns); n != 1 {
+		t.Fatalf("expected 1 connection, got %d", n)
+	}
+
+	stats := c.Stats()
+	if len(stats) != 1 || stats[0].Requests != 5 || stats[0].Errors != 0 || stats[0].BreakerState != BreakerClosed {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestClientOnlyRetriesIdempotent(t *testing.T) {
+	var calls int64
+	podURL, _ := newH2CServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		// Resets the stream after the request was received
+		panic(http.ErrAbortHandler)
+	})
+	c := newTestClient()
+	c.breakerFailures = 100
+
+	_, err := c.Do(context.Background(), podURL, &Request{Method: http.MethodPost, Path: "/psql/commit"})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if n := atomic.LoadInt64(&calls); n != 1 {
+		t.Fatalf("expected a non idempotent request to be sent once, got %d", n)
+	}
+
+	atomic.StoreInt64(&calls, 0)
+	_, err = c.Do(context.Background(), podURL, &Request{Method: http.MethodPost, Path: "/psql/extend", Idempotent: true})
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	if n := atomic.LoadInt64(&calls); n != 3 {
+		t.Fatalf("expected an idempotent request to be sent 3 times, got %d", n)
+	}
+	if stats := c.Stats(); stats[0].Retries != 2 {
+		t.Fatalf("expected 2 retries, got %+v", stats)
+	}
+}
+
+func TestClientBreakerOpensForDeadPod(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	podURL := l.Addr().String()
+	l.Close()
+	c := newTestClient()
+
+	// Dial errors are always retried, so the first request opens the breaker
+	_, err = c.Do(context.Background(), podURL, &Request{Method: http.MethodPost, Path: "/psql/commit"})
+	if !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("expected ErrBreakerOpen after retrying, got %v", err)
+	}
+	stats := c.Stats()
+	if len(stats) != 1 || stats[0].BreakerState != BreakerOpen || stats[0].Requests != 2 || stats[0].Rejected != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	_, err = c.Do(context.Background(), podURL, &Request{Method: http.MethodPost, Path: "/psql/commit"})
+	if !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("expected ErrBreakerOpen, got %v", err)
+	}
+	if stats = c.Stats(); stats[0].Requests != 2 {
+		t.Fatalf("expected no request while open, got %+v", stats)
+	}
+}
+
+func TestClientCancelledRequestsDontOpenBreaker(t *testing.T) {
+	podURL, _ := newH2CServer(t, func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	c := newTestClient()
+
+	for i := 0; i < 3; i++ {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*20)
+		_, err := c.Do(ctx, podURL, &Request{Method: http.MethodPost, Path: "/psql/query", Idempotent: true})
+		cancel()
+		if !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected context.DeadlineExceeded, got %v", err)
+		}
+	}
+	if stats := c.Stats(); stats[0].BreakerState != BreakerClosed || stats[0].Errors != 0 {
+		t.Fatalf("expected requests the caller gave up on to not count, got %+v", stats)
+	}
+}
+
+func TestClientStream(t *testing.T) {
+	podURL, _ := newH2CServer(t, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("content-type", r.Header.Get("content-type"))
+		w.WriteHeader(http.StatusOK)
+		io.Copy(w, r.Body)
+	})
+	c := newTestClient()
+
+	res, err := c.Stream(context.Background(), podURL, &StreamRequest{
+		Method:      http.MethodPost,
+		Path:        "/psql/copy_in?table=a",
+		Body:        strings.NewReader("1,2\n3,4\n"),
+		ContentType: "text/csv",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.StatusCode != http.StatusOK || res.Header.Get("content-type") != "text/csv" || string(body) != "1,2\n3,4\n" {
+		t.Fatalf("unexpected response %d %s", res.StatusCode, body)
+	}
+	if stats := c.Stats(); stats[0].Requests != 1 || stats[0].Errors != 0 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestClientSendsCredentials(t *testing.T) {
+	defer func(user, pass, adminUser, adminPass string) {
+		utils.AUTH_USER, utils.AUTH_PASS, utils.ADMIN_USER, utils.ADMIN_PASS = user, pass, adminUser, adminPass
+	}(utils.AUTH_USER, utils.AUTH_PASS, utils.ADMIN_USER, utils.ADMIN_PASS)
+	utils.AUTH_USER, utils.AUTH_PASS, utils.ADMIN_USER, utils.ADMIN_PASS = "user", "pass", "admin", "secret"
+
+	podURL, _ := newH2CServer(t, func(w http.ResponseWriter, r *http.Request) {
+		user, pass, _ := r.BasicAuth()
+		w.Write([]byte(user + ":" + pass))
+	})
+	c := newTestClient()
+
+	for path, expected := range map[string]string{
+		"/psql/query":                  "user:pass",
+		"/admin/transactions/x/cancel": "admin:secret",
+	} {
+		res, err := c.Do(context.Background(), podURL, &Request{Method: http.MethodPost, Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(res.Body) != expected {
+			t.Fatalf("expected %s for %s, got %s", expected, path, res.Body)
+		}
+	}
+}
+
+func TestClientBreakerOpensForUnhealthyPod(t *testing.T) {
+	var calls int64
+	podURL, _ := newH2CServer(t, func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(&calls, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	c := newTestClient()
+
+	// The responses are returned, but count against the pod
+	for i := 0; i < 2; i++ {
+		res, err := c.Do(context.Background(), podURL, &Request{Method: http.MethodPost, Path: "/psql/query", Idempotent: true})
+		if err != nil || res.StatusCode != http.StatusServiceUnavailable {
+			t.Fatalf("expected the 503 response, got %+v %v", res, err)
+		}
+	}
+	if n := atomic.LoadInt64(&calls); n != 2 {
+		t.Fatalf("expected the responses to not be retried, got %d calls", n)
+	}
+	stats := c.Stats()
+	if stats[0].BreakerState != BreakerOpen || stats[0].Errors != 2 {
+		t.Fatalf("expected the breaker to open, got %+v", stats)
+	}
+
+	_, err := c.Do(context.Background(), podURL, &Request{Method: http.MethodPost, Path: "/psql/query"})
+	if !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("expected ErrBreakerOpen, got %v", err)
+	}
+	if _, err := c.Stream(context.Background(), podURL, &StreamRequest{Method: http.MethodGet, Path: "/psql/copy_out"}); !errors.Is(err, ErrBreakerOpen) {
+		t.Fatalf("expected ErrBreakerOpen for a stream, got %v", err)
+	}
+}
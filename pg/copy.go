@@ -0,0 +1,459 @@
+package pg
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/peer"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+type (
+	CopyInRequest struct {
+		// As `schema.table` or `table`
+		Table string `query:"table" validate:"required,max=127"`
+		// The columns of the fields or keys, defaults to the CSV header, or the keys of the first NDJSON row
+		Column []string `query:"column" validate:"max=1600,dive,min=1,max=63"`
+		// csv or ndjson
+		Format string `query:"format" validate:"omitempty,oneof=csv ndjson"`
+		// CSV only, whether the first line is a header. Defaults to true.
+		Header    *bool   `query:"header"`
+		TxID      *string `query:"tx_id"`
+		TimeoutMS *int64  `query:"timeout_ms" validate:"omitempty,min=1"`
+	}
+
+	CopyOutRequest struct {
+		// A single statement, e.g. `SELECT * FROM users`
+		Query string `validate:"required"`
+		// Whether the first line is a header. Defaults to true.
+		Header    *bool
+		TxID      *string
+		TimeoutMS *int64 `validate:"omitempty,min=1"`
+	}
+
+	// copySource converts the request body to CSV for COPY FROM STDIN
+	copySource struct {
+		columns []string
+		r       io.Reader
+
+		// For NDJSON, the pipe the rows are converted into and the conversion error, which is reported instead of the
+		// database's error for the COPY that was failed because of it
+		pr   *io.PipeReader
+		done chan struct{}
+		err  error
+	}
+)
+
+const (
+	CopyFormatCSV    = "csv"
+	CopyFormatNDJSON = "ndjson"
+)
+
+var (
+	ErrCopyFailed = errors.New("copy failed")
+)
+
+// CopyIn copies the CSV or NDJSON rows of body into the table, in the transaction if TxID is set. Like Query, errors
+// from the database or in the rows are in the query error of the response, and a failed COPY in a transaction rolls
+// it back to the most recent savepoint, or rolls back the transaction if there is none.
+func CopyIn(ctx context.Context, pool *pgxpool.Pool, req *CopyInRequest, body io.Reader) (*QueryResponse, *DistributedError) {
+	logger := zerolog.Ctx(ctx)
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(req.TimeoutMS))
+	defer cancel()
+
+	var tx *Tx
+	if req.TxID != nil {
+		logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+			return c.Str("txID", *req.TxID)
+		})
+		tx = Manager.GetTx(*req.TxID)
+		if tx == nil {
+			return forwardCopyIn(ctx, req, body)
+		}
+	}
+
+	src, err := newCopySource(req, body)
+	if err != nil {
+		res := &QueryRes{}
+		res.setError(&QueryError{Message: err.Error(), Class: ErrorClassData})
+		return &QueryResponse{Queries: []*QueryRes{res}}, nil
+	}
+	defer src.close()
+	sql := copyInStatement(req.Table, src.columns)
+
+	qres := &QueryResponse{}
+	if tx != nil {
+		if utils.TX_SLIDING_EXPIRY {
+			if _, dErr := Manager.extendLocalTx(ctx, tx, nil); dErr != nil {
+				return nil, dErr
+			}
+		}
+
+		res, savepoint, err := tx.CopyFrom(ctx, src, sql)
+		qres.Queries = []*QueryRes{res}
+		qres.RolledBackToSavepoint = savepoint
+		if err != nil {
+			logger.Debug().Msg("error copying in transaction, rolling back")
+			if dErr := Manager.RollbackTx(ctx, *req.TxID); dErr != nil {
+				return qres, dErr
+			}
+		}
+		return qres, nil
+	}
+
+	conn, err := utils.AcquireConn(ctx, pool)
+	if err != nil {
+		return nil, &DistributedError{Err: fmt.Errorf("error in utils.AcquireConn: %w", err)}
+	}
+	defer conn.Release()
+	// The body can only be read once, so unlike queries this is never retried
+	res := copyFrom(ctx, conn.Conn().PgConn(), req.TimeoutMS, src, sql)
+	qres.Queries = []*QueryRes{res}
+	return qres, nil
+}
+
+// CopyOut writes the rows of the query to w as CSV, in the transaction if TxID is set. Errors from the database wrap
+// ErrCopyFailed. If anything was written to w before an error, the output is incomplete.
+func CopyOut(ctx context.Context, pool *pgxpool.Pool, req *CopyOutRequest, w io.Writer) *DistributedError {
+	logger := zerolog.Ctx(ctx)
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(req.TimeoutMS))
+	defer cancel()
+	header := utils.Deref(req.Header, true)
+
+	if req.TxID != nil {
+		logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+			return c.Str("txID", *req.TxID)
+		})
+		tx := Manager.GetTx(*req.TxID)
+		if tx == nil {
+			return forwardCopyOut(ctx, req, w)
+		}
+
+		if utils.TX_SLIDING_EXPIRY {
+			if _, dErr := Manager.extendLocalTx(ctx, tx, nil); dErr != nil {
+				return dErr
+			}
+		}
+
+		_, savepoint, err := tx.CopyTo(ctx, w, req.Query, header)
+		if err != nil {
+			if savepoint == nil {
+				logger.Debug().Msg("error copying in transaction, rolling back")
+				if dErr := Manager.RollbackTx(ctx, *req.TxID); dErr != nil {
+					return dErr
+				}
+			}
+			return &DistributedError{Err: fmt.Errorf("%w: %s", ErrCopyFailed, err)}
+		}
+		return nil
+	}
+
+	conn, err := utils.AcquireConn(ctx, pool)
+	if err != nil {
+		return &DistributedError{Err: fmt.Errorf("error in utils.AcquireConn: %w", err)}
+	}
+	defer conn.Release()
+	err = inTimeoutTx(ctx, conn.Conn().PgConn(), req.TimeoutMS, func() (err error) {
+		_, err = copyTo(ctx, conn.Conn().PgConn(), w, req.Query, header)
+		return
+	})
+	if err != nil {
+		return &DistributedError{Err: fmt.Errorf("%w: %s", ErrCopyFailed, err)}
+	}
+	return nil
+}
+
+// CopyFrom copies the rows into the transaction, handling an error like RunQueries
+func (tx *Tx) CopyFrom(ctx context.Context, src *copySource, sql string) (*QueryRes, *string, error) {
+	tx.PoolMu.Lock()
+	defer tx.PoolMu.Unlock()
+
+	tx.recordStatement(sql)
+	res := copyFrom(ctx, tx.PoolConn.Conn().PgConn(), nil, src, sql)
+	if res.Error != nil {
+		savepoint, err := tx.recoverFromError(ctx)
+		return res, savepoint, err
+	}
+	return res, nil, nil
+}
+
+// CopyTo copies the rows of the query to w as CSV, handling an error like RunQueries. The error of the COPY is returned
+// with the savepoint that was rolled back to, or ErrTxError wraps it if there was none.
+func (tx *Tx) CopyTo(ctx context.Context, w io.Writer, query string, header bool) (pgconn.CommandTag, *string, error) {
+	tx.PoolMu.Lock()
+	defer tx.PoolMu.Unlock()
+
+	tx.recordStatement(query)
+	tag, err := copyTo(ctx, tx.PoolConn.Conn().PgConn(), w, query, header)
+	if err != nil {
+		savepoint, txErr := tx.recoverFromError(ctx)
+		if txErr != nil {
+			return nil, nil, fmt.Errorf("%w: %s", txErr, err)
+		}
+		return nil, savepoint, err
+	}
+	return tag, nil, nil
+}
+
+func copyFrom(ctx context.Context, conn *pgconn.PgConn, timeoutMS *int64, src *copySource, sql string) *QueryRes {
+	res := &QueryRes{}
+	s := time.Now()
+	var tag pgconn.CommandTag
+	err := inTimeoutTx(ctx, conn, timeoutMS, func() (err error) {
+		tag, err = conn.CopyFrom(ctx, src.r, sql)
+		return
+	})
+	res.TimeNS = utils.Ptr(time.Since(s).Nanoseconds())
+	if err != nil {
+		res.setError(NewQueryError(err))
+		res.err = err
+		if convErr := src.close(); convErr != nil {
+			res.setError(&QueryError{Message: convErr.Error(), Class: ErrorClassData})
+		}
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("got copy error")
+		return res
+	}
+	setCommandTag(res, tag)
+	return res
+}
+
+// inTimeoutTx runs f in a transaction with the statement_timeout if one is provided, since pool connections have the
+// default statement_timeout
+func inTimeoutTx(ctx context.Context, conn *pgconn.PgConn, timeoutMS *int64, f func() error) error {
+	if timeoutMS == nil {
+		return f()
+	}
+
+	_, err := conn.Exec(ctx, "BEGIN; "+statementTimeoutStatement(queryTimeoutMS(timeoutMS))).ReadAll()
+	if err != nil {
+		return fmt.Errorf("error setting statement_timeout: %w", err)
+	}
+	if err := f(); err != nil {
+		conn.Exec(ctx, "ROLLBACK").ReadAll()
+		return err
+	}
+	_, err = conn.Exec(ctx, "COMMIT").ReadAll()
+	return err
+}
+
+// copyTo copies the rows of the query to w as CSV. The query is prepared on its own first, so the database rejects
+// anything but a single statement before it is put in the COPY statement.
+func copyTo(ctx context.Context, conn *pgconn.PgConn, w io.Writer, query string, header bool) (pgconn.CommandTag, error) {
+	if _, err := conn.Prepare(ctx, "", query, nil); err != nil {
+		return nil, fmt.Errorf("error preparing query: %w", err)
+	}
+	return conn.CopyTo(ctx, w, copyOutStatement(query, header))
+}
+
+// copyOutStatement puts the query on its own lines, so a trailing line comment can't swallow the end of the statement
+func copyOutStatement(query string, header bool) string {
+	sql := "COPY (\n" + query + "\n) TO STDOUT WITH CSV"
+	if header {
+		sql += " HEADER"
+	}
+	return sql
+}
+
+func copyInStatement(table string, columns []string) string {
+	sql := "COPY " + pgx.Identifier(strings.Split(table, ".")).Sanitize()
+	if len(columns) > 0 {
+		names := make([]string, len(columns))
+		for i, column := range columns {
+			names[i] = pgx.Identifier{column}.Sanitize()
+		}
+		sql += " (" + strings.Join(names, ", ") + ")"
+	}
+	return sql + " FROM STDIN WITH CSV"
+}
+
+// newCopySource reads the columns from the CSV header or first NDJSON row if they weren't provided, and converts
+// NDJSON rows to CSV
+func newCopySource(req *CopyInRequest, body io.Reader) (*copySource, error) {
+	br := bufio.NewReaderSize(body, 64*1024)
+	src := &copySource{columns: req.Column, r: br}
+
+	if req.Format != CopyFormatNDJSON {
+		if !utils.Deref(req.Header, true) {
+			return src, nil
+		}
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("error reading CSV header: %w", err)
+		}
+		header, err := csv.NewReader(strings.NewReader(line)).Read()
+		if err != nil && err != io.EOF {
+			return nil, fmt.Errorf("invalid CSV header: %w", err)
+		}
+		if len(src.columns) == 0 {
+			src.columns = header
+		}
+		return src, nil
+	}
+
+	decoder := json.NewDecoder(br)
+	var first map[string]json.RawMessage
+	if err := decoder.Decode(&first); err != nil && err != io.EOF {
+		return nil, fmt.Errorf("row 1: invalid JSON object: %w", err)
+	}
+	if len(src.columns) == 0 {
+		for column := range first {
+			src.columns = append(src.columns, column)
+		}
+		sort.Strings(src.columns)
+	}
+
+	pr, pw := io.Pipe()
+	src.r, src.pr, src.done = pr, pr, make(chan struct{})
+	go func() {
+		defer close(src.done)
+		src.err = writeCSVRows(pw, decoder, first, src.columns)
+		pw.CloseWithError(src.err)
+	}()
+	return src, nil
+}
+
+// writeCSVRows writes the NDJSON rows to w as CSV, starting with the first one if there was one
+func writeCSVRows(w io.Writer, decoder *json.Decoder, first map[string]json.RawMessage, columns []string) error {
+	index := make(map[string]int, len(columns))
+	for i, column := range columns {
+		index[column] = i
+	}
+
+	bw := bufio.NewWriterSize(w, 64*1024)
+	row := first
+	fields := make([]json.RawMessage, len(columns))
+	for n := 1; row != nil; n++ {
+		for i := range fields {
+			fields[i] = nil
+		}
+		for key, value := range row {
+			i, ok := index[key]
+			if !ok {
+				return fmt.Errorf("row %d: unknown column %s", n, key)
+			}
+			fields[i] = value
+		}
+		for i, value := range fields {
+			if i > 0 {
+				bw.WriteByte(',')
+			}
+			if err := writeCSVField(bw, value); err != nil {
+				return fmt.Errorf("row %d: invalid value for %s: %w", n, columns[i], err)
+			}
+		}
+		if err := bw.WriteByte('\n'); err != nil {
+			return err
+		}
+
+		row = nil
+		if err := decoder.Decode(&row); err != nil && err != io.EOF {
+			return fmt.Errorf("row %d: invalid JSON object: %w", n+1, err)
+		}
+	}
+	return bw.Flush()
+}
+
+// writeCSVField writes the JSON value as a CSV field. Missing and null values are unquoted so COPY reads them as NULL,
+// everything else is quoted so empty strings aren't. Objects and arrays are written as JSON, for json and jsonb columns.
+func writeCSVField(w *bufio.Writer, value json.RawMessage) error {
+	value = bytes.TrimSpace(value)
+	if len(value) == 0 || string(value) == "null" {
+		return nil
+	}
+	s := string(value)
+	if value[0] == '"' {
+		if err := json.Unmarshal(value, &s); err != nil {
+			return err
+		}
+	}
+	w.WriteByte('"')
+	w.WriteString(strings.ReplaceAll(s, `"`, `""`))
+	return w.WriteByte('"')
+}
+
+// close stops converting NDJSON rows and returns the error converting them, if any
+func (src *copySource) close() error {
+	if src.pr == nil {
+		return nil
+	}
+	src.pr.Close()
+	<-src.done
+	// Writing fails once the COPY stopped reading because of a database error, which is the one to report
+	if errors.Is(src.err, io.ErrClosedPipe) {
+		return nil
+	}
+	return src.err
+}
+
+// query returns the request as query parameters for forwarding
+func (req *CopyInRequest) query() url.Values {
+	q := url.Values{"table": {req.Table}, "column": req.Column, "tx_id": {*req.TxID}}
+	if req.Format != "" {
+		q.Set("format", req.Format)
+	}
+	if req.Header != nil {
+		q.Set("header", strconv.FormatBool(*req.Header))
+	}
+	if req.TimeoutMS != nil {
+		q.Set("timeout_ms", strconv.FormatInt(*req.TimeoutMS, 10))
+	}
+	return q
+}
+
+func forwardCopyIn(ctx context.Context, req *CopyInRequest, body io.Reader) (*QueryResponse, *DistributedError) {
+	res, dErr := forwardTxStream(ctx, *req.TxID, &peer.StreamRequest{
+		Method:      http.MethodPost,
+		Path:        "/psql/copy_in?" + req.query().Encode(),
+		Body:        body,
+		ContentType: "application/octet-stream",
+	})
+	if dErr != nil {
+		return nil, dErr
+	}
+	defer res.Body.Close()
+
+	var qres QueryResponse
+	if err := json.NewDecoder(res.Body).Decode(&qres); err != nil {
+		return nil, &DistributedError{Err: fmt.Errorf("error in json.Decode for remote response body: %w", err)}
+	}
+	qres.Remote = true
+	return &qres, nil
+}
+
+func forwardCopyOut(ctx context.Context, req *CopyOutRequest, w io.Writer) *DistributedError {
+	body, err := json.Marshal(req)
+	if err != nil {
+		return &DistributedError{Err: fmt.Errorf("error in json.Marshal: %w", err)}
+	}
+	res, dErr := forwardTxStream(ctx, *req.TxID, &peer.StreamRequest{
+		Method:      http.MethodPost,
+		Path:        "/psql/copy_out",
+		Body:        bytes.NewReader(body),
+		ContentType: "application/json",
+	})
+	if dErr != nil {
+		return dErr
+	}
+	defer res.Body.Close()
+
+	if _, err := io.Copy(w, res.Body); err != nil {
+		return &DistributedError{Err: fmt.Errorf("error streaming copy from remote pod: %w", err)}
+	}
+	return nil
+}
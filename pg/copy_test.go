@@ -0,0 +1,126 @@
+package pg
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+)
+
+func TestCopySourceNDJSON(t *testing.T) {
+	body := `{"id":1,"name":"dan","tags":["a"]}
+{"id":2,"name":"","tags":null}
+{"id":3,"name":"say \"hi\", ok"}
+`
+	src, err := newCopySource(&CopyInRequest{Format: CopyFormatNDJSON}, strings.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(src.columns, ",") != "id,name,tags" {
+		t.Fatalf("unexpected columns %v", src.columns)
+	}
+	b, err := io.ReadAll(src.r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `"1","dan","[""a""]"
+"2","",
+"3","say ""hi"", ok",
+`
+	if string(b) != expected {
+		t.Fatalf("unexpected CSV:\n%s", b)
+	}
+	if err := src.close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCopySourceNDJSONErrors(t *testing.T) {
+	cases := map[string]string{
+		"{\"id\":1}\n{\"other\":2}\n": "row 2: unknown column other",
+		"{\"id\":1}\n[1]\n":           "row 2: invalid JSON object",
+	}
+	for body, msg := range cases {
+		src, err := newCopySource(&CopyInRequest{Format: CopyFormatNDJSON}, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := io.ReadAll(src.r); err == nil || !strings.HasPrefix(err.Error(), msg) {
+			t.Fatalf("expected %q, got %v", msg, err)
+		}
+		if err := src.close(); err == nil || !strings.HasPrefix(err.Error(), msg) {
+			t.Fatalf("expected %q from close, got %v", msg, err)
+		}
+	}
+
+	// Errors after the COPY stopped reading are from the database, not the rows
+	src, err := newCopySource(&CopyInRequest{Format: CopyFormatNDJSON}, strings.NewReader(strings.Repeat("{\"id\":1}\n", 100000)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := src.close(); err != nil {
+		t.Fatalf("expected no error after closing early, got %v", err)
+	}
+}
+
+func TestCopySourceCSVHeader(t *testing.T) {
+	src, err := newCopySource(&CopyInRequest{Format: CopyFormatCSV}, strings.NewReader("id,\"full name\"\r\n1,dan\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := io.ReadAll(src.r)
+	if strings.Join(src.columns, "|") != "id|full name" || string(b) != "1,dan\n" {
+		t.Fatalf("unexpected columns %v and rows %q", src.columns, b)
+	}
+
+	src, err = newCopySource(&CopyInRequest{Format: CopyFormatCSV, Column: []string{"a"}, Header: utils.Ptr(false)}, strings.NewReader("1\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ = io.ReadAll(src.r)
+	if strings.Join(src.columns, "|") != "a" || string(b) != "1\n" {
+		t.Fatalf("unexpected columns %v and rows %q", src.columns, b)
+	}
+}
+
+func TestCopyInStatement(t *testing.T) {
+	if sql := copyInStatement("billing.invoices", []string{"id", "full name"}); sql != `COPY "billing"."invoices" ("id", "full name") FROM STDIN WITH CSV` {
+		t.Fatalf("unexpected statement %s", sql)
+	}
+	if sql := copyInStatement("users", nil); sql != `COPY "users" FROM STDIN WITH CSV` {
+		t.Fatalf("unexpected statement %s", sql)
+	}
+}
+
+func TestCopyRequestQuery(t *testing.T) {
+	req := &CopyInRequest{
+		Table:  "users",
+		Column: []string{"a", "b"},
+		Format: CopyFormatNDJSON,
+		Header: utils.Ptr(false),
+		TxID:   utils.Ptr("tx"),
+	}
+	if q := req.query().Encode(); q != "column=a&column=b&format=ndjson&header=false&table=users&tx_id=tx" {
+		t.Fatalf("unexpected query %s", q)
+	}
+}
+
+func TestCopyOutStatement(t *testing.T) {
+	// The database checks that the query is a single statement when it's prepared, so it's used as is
+	queries := []string{
+		"SELECT * FROM users",
+		`SELECT U&'d\0061t\+000061', U&"d!0061t!+000061" UESCAPE '!' FROM t`,
+		"SELECT $outer$ $inner$ ) $inner$ $outer$, $$ ( $$ FROM t",
+	}
+	for _, query := range queries {
+		if sql := copyOutStatement(query, false); sql != "COPY (\n"+query+"\n) TO STDOUT WITH CSV" {
+			t.Fatalf("unexpected statement %q", sql)
+		}
+	}
+
+	// A trailing line comment ends before the rest of the statement
+	if sql := copyOutStatement("SELECT 1 -- ) TO PROGRAM 'rm -rf /'", true); sql != "COPY (\nSELECT 1 -- ) TO PROGRAM 'rm -rf /'\n) TO STDOUT WITH CSV HEADER" {
+		t.Fatalf("unexpected statement %q", sql)
+	}
+}
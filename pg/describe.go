@@ -0,0 +1,104 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type (
+	DescribeResponse struct {
+		Description *pgconn.StatementDescription `json:",omitempty"`
+		Error       *QueryError                  `json:",omitempty"`
+
+		// If the describe failed in a transaction, the savepoint that the transaction was rolled back to
+		RolledBackToSavepoint *string `json:",omitempty"`
+	}
+
+	rawRowsCtxKey struct{}
+)
+
+// Describe gets the parameter and result types of a statement without running it, in the local transaction if a txID is
+// provided. Like Query, a failed describe in a transaction rolls it back unless it has a savepoint.
+func Describe(ctx context.Context, pool *pgxpool.Pool, txID *string, statement string, paramOIDs []uint32) (*DescribeResponse, *DistributedError) {
+	ctx, cancel := context.WithTimeout(ctx, queryTimeout(nil))
+	defer cancel()
+
+	if txID != nil {
+		tx := Manager.GetTx(*txID)
+		if tx == nil {
+			return nil, &DistributedError{Err: ErrTxNotFound}
+		}
+
+		desc, queryErr, savepoint, err := tx.Describe(ctx, statement, paramOIDs)
+		if err != nil {
+			if err := Manager.RollbackTx(ctx, *txID); err != nil {
+				return nil, err
+			}
+		}
+		return &DescribeResponse{
+			Description:           copyStatementDescription(desc),
+			Error:                 queryErr,
+			RolledBackToSavepoint: savepoint,
+		}, nil
+	}
+
+	conn, err := utils.AcquireConn(ctx, pool)
+	if err != nil {
+		return nil, &DistributedError{Err: fmt.Errorf("error in utils.AcquireConn: %w", err)}
+	}
+	defer conn.Release()
+
+	desc, err := conn.Conn().PgConn().Prepare(ctx, "", statement, paramOIDs)
+	if err != nil {
+		return &DescribeResponse{Error: NewQueryError(err)}, nil
+	}
+	return &DescribeResponse{Description: copyStatementDescription(desc)}, nil
+}
+
+// WithRawRows returns a context that has queries keep the field descriptions and undecoded values of rows instead of
+// decoding them into Rows, so they can be relayed to Postgres clients as-is
+func WithRawRows(ctx context.Context) context.Context {
+	return context.WithValue(ctx, rawRowsCtxKey{}, true)
+}
+
+func rawRows(ctx context.Context) bool {
+	raw, _ := ctx.Value(rawRowsCtxKey{}).(bool)
+	return raw
+}
+
+// FieldDescriptions returns the result columns of the query, only if it was run with a context from WithRawRows
+func (res *QueryRes) FieldDescriptions() []pgproto3.FieldDescription {
+	return res.fields
+}
+
+// RawRows returns the undecoded values of each row, only if the query was run with a context from WithRawRows
+func (res *QueryRes) RawRows() [][][]byte {
+	return res.rawRows
+}
+
+// copyFieldDescriptions copies the field descriptions, since their names point into the connection's read buffer
+func copyFieldDescriptions(fields []pgproto3.FieldDescription) []pgproto3.FieldDescription {
+	copied := make([]pgproto3.FieldDescription, len(fields))
+	for i, field := range fields {
+		copied[i] = field
+		copied[i].Name = append([]byte(nil), field.Name...)
+	}
+	return copied
+}
+
+func copyStatementDescription(desc *pgconn.StatementDescription) *pgconn.StatementDescription {
+	if desc == nil {
+		return nil
+	}
+	return &pgconn.StatementDescription{
+		Name:      desc.Name,
+		SQL:       desc.SQL,
+		ParamOIDs: desc.ParamOIDs,
+		Fields:    copyFieldDescriptions(desc.Fields),
+	}
+}
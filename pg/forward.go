@@ -0,0 +1,169 @@
+package pg
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/danthegoodman1/SQLGateway/coord"
+	"github.com/danthegoodman1/SQLGateway/peer"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/rs/zerolog"
+)
+
+type forwardedToCtxKey struct{}
+
+// WithForwardedTo returns a context that records the URL of the pod that a transaction request is forwarded to
+func WithForwardedTo(ctx context.Context) (context.Context, *string) {
+	forwardedTo := new(string)
+	return context.WithValue(ctx, forwardedToCtxKey{}, forwardedTo), forwardedTo
+}
+
+func setForwardedTo(ctx context.Context, podURL string) {
+	if forwardedTo, ok := ctx.Value(forwardedToCtxKey{}).(*string); ok {
+		*forwardedTo = podURL
+	}
+}
+
+// lookupRemoteTx finds the pod that owns a transaction that is not held locally, from the transaction ID if it
+// was encoded with TX_ID_SECRET, otherwise from the coordinator
+func lookupRemoteTx(ctx context.Context, txID string) (*coord.TransactionMeta, *DistributedError) {
+	if txIDs == nil || !isEncodedTxID(txID) {
+		return lookupCoordTx(ctx, txID)
+	}
+
+	owner, err := txIDs.Decode(txID)
+	if err != nil {
+		return nil, &DistributedError{Err: ErrTxNotFound}
+	}
+	if owner.PodName == utils.POD_NAME {
+		return nil, &DistributedError{Err: ErrTxNotFoundLocal}
+	}
+
+	logger := zerolog.Ctx(ctx)
+	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("remoteURL", owner.PodURL)
+	})
+	return &coord.TransactionMeta{
+		TxID:   txID,
+		PodID:  owner.PodName,
+		PodURL: owner.PodURL,
+	}, nil
+}
+
+// lookupCoordTx finds the pod that owns a transaction in the coordinator
+func lookupCoordTx(ctx context.Context, txID string) (*coord.TransactionMeta, *DistributedError) {
+	if coord.Client == nil {
+		return nil, &DistributedError{Err: ErrTxNotFound}
+	}
+
+	txMeta, err := coord.Client.GetTransaction(ctx, txID)
+	if errors.Is(err, coord.ErrNotFound) {
+		return nil, &DistributedError{Err: ErrTxNotFound}
+	}
+	if err != nil {
+		return nil, &DistributedError{Err: fmt.Errorf("error in coord.Client.GetTransaction: %w", err)}
+	}
+
+	if txMeta.PodID == utils.POD_NAME {
+		// The only case would be if this node restarted but maintained the same name, without removing transactions from the coordinator
+		return nil, &DistributedError{Err: ErrTxNotFoundLocal}
+	}
+
+	logger := zerolog.Ctx(ctx)
+	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("remoteURL", txMeta.PodURL)
+	})
+	return txMeta, nil
+}
+
+// forwardTx sends a request for a transaction that is not held locally to the pod that owns it, returning the URL of
+// the pod. If the pod in an encoded transaction ID cannot be reached, the coordinator is checked in case it moved.
+func forwardTx(ctx context.Context, txID string, req *peer.Request, out any) (string, *DistributedError) {
+	txMeta, dErr := lookupRemoteTx(ctx, txID)
+	if dErr != nil {
+		return "", dErr
+	}
+
+	dErr = forwardToPod(ctx, txMeta.PodURL, req, out)
+	if dErr == nil {
+		setForwardedTo(ctx, txMeta.PodURL)
+		return txMeta.PodURL, nil
+	}
+	if coord.Client == nil || !isEncodedTxID(txID) || !errors.Is(dErr.Err, ErrRemoteUnavailable) {
+		return txMeta.PodURL, dErr
+	}
+
+	logger := zerolog.Ctx(ctx)
+	logger.Debug().Msg("pod in transaction ID unavailable, checking coordinator")
+	coordTxMeta, coordDErr := lookupCoordTx(ctx, txID)
+	if coordDErr != nil {
+		// If the coordinator does not have it either then the transaction died with the pod
+		return "", coordDErr
+	}
+	if coordTxMeta.PodURL == txMeta.PodURL {
+		return txMeta.PodURL, dErr
+	}
+
+	dErr = forwardToPod(ctx, coordTxMeta.PodURL, req, out)
+	if dErr == nil {
+		setForwardedTo(ctx, coordTxMeta.PodURL)
+	}
+	return coordTxMeta.PodURL, dErr
+}
+
+// forwardTxStream streams a request for a transaction that is not held locally to the pod that owns it, returning
+// the response if it succeeded. Unlike forwardTx, the coordinator is not checked if the pod is unavailable, since the
+// body may have been partly sent.
+func forwardTxStream(ctx context.Context, txID string, req *peer.StreamRequest) (*http.Response, *DistributedError) {
+	txMeta, dErr := lookupRemoteTx(ctx, txID)
+	if dErr != nil {
+		return nil, dErr
+	}
+
+	res, err := peer.DefaultClient.Stream(ctx, txMeta.PodURL, req)
+	if err != nil {
+		return nil, remoteErr(err)
+	}
+	if res.StatusCode != 200 {
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		return nil, &DistributedError{Remote: true, StatusCode: res.StatusCode, ErrString: string(body)}
+	}
+
+	setForwardedTo(ctx, txMeta.PodURL)
+	return res, nil
+}
+
+// forwardToPod sends a request to a remote pod, decoding the response body into out if provided
+func forwardToPod(ctx context.Context, podURL string, req *peer.Request, out any) *DistributedError {
+	res, err := peer.DefaultClient.Do(ctx, podURL, req)
+	if err != nil {
+		return remoteErr(err)
+	}
+
+	if res.StatusCode != 200 {
+		return &DistributedError{Remote: true, StatusCode: res.StatusCode, ErrString: string(res.Body)}
+	}
+
+	if out != nil {
+		err = json.Unmarshal(res.Body, out)
+		if err != nil {
+			return &DistributedError{Err: fmt.Errorf("error in json.Unmarhsal for remote response body: %w", err)}
+		}
+	}
+
+	return nil
+}
+
+// remoteErr wraps the error from a request to a remote pod, telling apart requests that timed out from pods that
+// could not be reached
+func remoteErr(err error) *DistributedError {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return &DistributedError{Err: fmt.Errorf("%w: %s", ErrRemoteTimeout, err)}
+	}
+	return &DistributedError{Err: fmt.Errorf("%w: error doing request to remote pod: %s", ErrRemoteUnavailable, err)}
+}
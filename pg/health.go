@@ -0,0 +1,76 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+)
+
+const (
+	// expiryCheckStaleAfter is how long the expiry ticker can go without running before the manager is considered wedged
+	expiryCheckStaleAfter = time.Second * 30
+)
+
+var (
+	ErrPoolSaturated    = errors.New("pool is saturated")
+	ErrExpiryCheckStale = errors.New("expired transactions have not been checked recently")
+	ErrTxStuck          = errors.New("transactions have not been rolled back long after expiring")
+)
+
+// PingPool checks that the database can be reached through the pool
+func PingPool(ctx context.Context) error {
+	stat := PGPool.Stat()
+	if stat.IdleConns() == 0 && stat.TotalConns() >= stat.MaxConns() {
+		// Every connection is busy, which proves connectivity, and pinging would wait for one to be free
+		return nil
+	}
+
+	err := PGPool.Ping(ctx)
+	if err != nil {
+		return fmt.Errorf("error in PGPool.Ping: %w", err)
+	}
+	return nil
+}
+
+// CheckPoolSaturation returns ErrPoolSaturated if at least POOL_SATURATION_PCT of the pool connections are in use
+func CheckPoolSaturation() error {
+	stat := PGPool.Stat()
+	if int64(stat.AcquiredConns())*100 >= int64(stat.MaxConns())*utils.POOL_SATURATION_PCT {
+		return fmt.Errorf("%w: %d of %d connections in use", ErrPoolSaturated, stat.AcquiredConns(), stat.MaxConns())
+	}
+	return nil
+}
+
+// CheckLiveness returns an error if the expiry ticker has stopped running, or if a transaction is stuck because its
+// PoolMu has been held for longer than any query could run
+func (manager *TxManager) CheckLiveness() error {
+	lastCheck := time.Unix(0, atomic.LoadInt64(&manager.lastExpiryCheck))
+	if since := time.Since(lastCheck); since > expiryCheckStaleAfter {
+		return fmt.Errorf("%w: last checked %s ago", ErrExpiryCheckStale, since.Round(time.Second))
+	}
+
+	// Expired transactions are rolled back within a tick unless a query is holding PoolMu, which is bounded by its timeout
+	grace := time.Millisecond * time.Duration(utils.QUERY_MAX_TIMEOUT_MS+utils.REQUEST_TIMEOUT_MS)
+	now := time.Now()
+	stuck := make([]string, 0)
+	manager.txMu.Lock()
+	for txID, tx := range manager.txMap {
+		// Session transactions don't expire, so they are never stuck
+		if !tx.Session && now.Sub(tx.Expires) > grace {
+			stuck = append(stuck, txID)
+		}
+	}
+	manager.txMu.Unlock()
+
+	if len(stuck) > 0 {
+		sort.Strings(stuck)
+		return fmt.Errorf("%w: %s", ErrTxStuck, strings.Join(stuck, ", "))
+	}
+	return nil
+}
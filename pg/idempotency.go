@@ -0,0 +1,278 @@
+package pg
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/coord"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/rs/zerolog"
+)
+
+type (
+	idempotencyRecord struct {
+		// A hash of the request that reserved the key, so the key can't be reused for a different request
+		RequestHash string
+		Pending     bool           `json:",omitempty"`
+		Response    *QueryResponse `json:",omitempty"`
+	}
+
+	// idempotentRequest is the part of a request that has to match for a stored response to be returned
+	idempotentRequest struct {
+		Queries []*QueryReq
+		TxID    *string
+	}
+
+	// localIdempotencyStore is used for idempotency keys when not running clustered
+	localIdempotencyStore struct {
+		mu        *sync.Mutex
+		records   map[string]localIdempotencyRecord
+		lastSweep time.Time
+	}
+
+	localIdempotencyRecord struct {
+		val     []byte
+		expires time.Time
+	}
+)
+
+var (
+	ErrIdempotencyInProgress = errors.New("a request with this idempotency key is still in progress")
+	ErrIdempotencyMismatch   = errors.New("the idempotency key was already used for a different request")
+
+	localIdempotency = &localIdempotencyStore{
+		mu:      &sync.Mutex{},
+		records: map[string]localIdempotencyRecord{},
+	}
+)
+
+// idempotencyMinPendingTTL keeps requests with short timeouts from refreshing their reservation too often
+const idempotencyMinPendingTTL = time.Second
+
+// RunIdempotent runs f at most once per idempotency key of the request within IDEMPOTENCY_TTL_SEC. Repeated requests
+// with the same key get the original response back, or ErrIdempotencyInProgress if the original request has not
+// finished yet. If the queries or transaction of the repeated request differ then ErrIdempotencyMismatch is returned.
+// If f returns an error then the key is released so that the request can be retried.
+//
+// The key is only reserved for about the query timeout, and the reservation is refreshed while f runs, so that if the pod
+// dies mid-request the key is freed soon after rather than staying in progress for IDEMPOTENCY_TTL_SEC.
+func RunIdempotent(ctx context.Context, req *QueryRequest, f func() (*QueryResponse, *DistributedError)) (*QueryResponse, *DistributedError) {
+	key := *req.IdempotencyKey
+	logger := zerolog.Ctx(ctx)
+	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("idempotencyKey", key)
+	})
+	ttl := time.Second * time.Duration(utils.IDEMPOTENCY_TTL_SEC)
+	pendingTTL := queryTimeout(req.TimeoutMS)
+	if pendingTTL < idempotencyMinPendingTTL {
+		pendingTTL = idempotencyMinPendingTTL
+	}
+	if pendingTTL > ttl {
+		pendingTTL = ttl
+	}
+
+	requestHash, err := hashIdempotentRequest(req)
+	if err != nil {
+		return nil, &DistributedError{Err: fmt.Errorf("error in hashIdempotentRequest: %w", err)}
+	}
+
+	pendingBytes, err := json.Marshal(idempotencyRecord{RequestHash: requestHash, Pending: true})
+	if err != nil {
+		return nil, &DistributedError{Err: fmt.Errorf("error in json.Marshal for pending record: %w", err)}
+	}
+
+	reserved, err := reserveIdempotencyKey(ctx, key, pendingBytes, pendingTTL)
+	if err != nil {
+		return nil, &DistributedError{Err: fmt.Errorf("error in reserveIdempotencyKey: %w", err)}
+	}
+
+	if !reserved {
+		recordBytes, err := getIdempotencyKey(ctx, key)
+		if errors.Is(err, coord.ErrNotFound) {
+			// It expired between the reservation and now, let the client try again
+			return nil, &DistributedError{Err: ErrIdempotencyInProgress}
+		}
+		if err != nil {
+			return nil, &DistributedError{Err: fmt.Errorf("error in getIdempotencyKey: %w", err)}
+		}
+
+		var record idempotencyRecord
+		err = json.Unmarshal(recordBytes, &record)
+		if err != nil {
+			return nil, &DistributedError{Err: fmt.Errorf("error in json.Unmarshal for idempotency record: %w", err)}
+		}
+		if record.RequestHash != requestHash {
+			return nil, &DistributedError{Err: ErrIdempotencyMismatch}
+		}
+		if record.Pending || record.Response == nil {
+			return nil, &DistributedError{Err: ErrIdempotencyInProgress}
+		}
+
+		logger.Debug().Msg("returning stored response for idempotency key")
+		record.Response.IdempotentReplay = true
+		return record.Response, nil
+	}
+
+	stopRefreshing := refreshPendingIdempotencyKey(ctx, key, pendingBytes, pendingTTL)
+	res, dErr := f()
+	stopRefreshing()
+
+	// The request context may already be cancelled, but we still want to store the result
+	storeCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if dErr != nil {
+		if err := deleteIdempotencyKey(storeCtx, key); err != nil {
+			logger.Error().Err(err).Msg("error releasing idempotency key")
+		}
+		return nil, dErr
+	}
+
+	recordBytes, err := json.Marshal(idempotencyRecord{RequestHash: requestHash, Response: res})
+	if err != nil {
+		logger.Error().Err(err).Msg("error in json.Marshal for idempotency record")
+		return res, nil
+	}
+	if err := setIdempotencyKey(storeCtx, key, recordBytes, ttl); err != nil {
+		logger.Error().Err(err).Msg("error storing idempotency record")
+	}
+
+	return res, nil
+}
+
+// refreshPendingIdempotencyKey extends the pending reservation every half of pendingTTL until the returned stop function is
+// called, which waits for any refresh in progress so it can't overwrite the stored response
+func refreshPendingIdempotencyKey(ctx context.Context, key string, pendingBytes []byte, pendingTTL time.Duration) (stop func()) {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(pendingTTL / 2)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				refreshCtx, cancel := context.WithTimeout(context.Background(), pendingTTL/2)
+				if err := setIdempotencyKey(refreshCtx, key, pendingBytes, pendingTTL); err != nil {
+					zerolog.Ctx(ctx).Error().Err(err).Msg("error refreshing pending idempotency key")
+				}
+				cancel()
+			case <-done:
+				return
+			}
+		}
+	}()
+	return func() {
+		close(done)
+		<-stopped
+	}
+}
+
+// hashIdempotentRequest returns a hex encoded SHA-256 of the queries, params, and transaction of the request
+func hashIdempotentRequest(req *QueryRequest) (string, error) {
+	b, err := json.Marshal(idempotentRequest{
+		Queries: req.Queries,
+		TxID:    req.TxID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error in json.Marshal: %w", err)
+	}
+	hash := sha256.Sum256(b)
+	return hex.EncodeToString(hash[:]), nil
+}
+
+func reserveIdempotencyKey(ctx context.Context, key string, val []byte, ttl time.Duration) (bool, error) {
+	if coord.Client != nil {
+		return coord.Client.ReserveIdempotencyKey(ctx, key, val, ttl)
+	}
+	return localIdempotency.reserve(key, val, ttl), nil
+}
+
+func setIdempotencyKey(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	if coord.Client != nil {
+		return coord.Client.SetIdempotencyKey(ctx, key, val, ttl)
+	}
+	localIdempotency.set(key, val, ttl)
+	return nil
+}
+
+func getIdempotencyKey(ctx context.Context, key string) ([]byte, error) {
+	if coord.Client != nil {
+		return coord.Client.GetIdempotencyKey(ctx, key)
+	}
+	val, exists := localIdempotency.get(key)
+	if !exists {
+		return nil, coord.ErrNotFound
+	}
+	return val, nil
+}
+
+func deleteIdempotencyKey(ctx context.Context, key string) error {
+	if coord.Client != nil {
+		return coord.Client.DeleteIdempotencyKey(ctx, key)
+	}
+	localIdempotency.delete(key)
+	return nil
+}
+
+func (store *localIdempotencyStore) reserve(key string, val []byte, ttl time.Duration) bool {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.sweep()
+	if record, exists := store.records[key]; exists && record.expires.After(time.Now()) {
+		return false
+	}
+	store.records[key] = localIdempotencyRecord{
+		val:     val,
+		expires: time.Now().Add(ttl),
+	}
+	return true
+}
+
+func (store *localIdempotencyStore) set(key string, val []byte, ttl time.Duration) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	store.records[key] = localIdempotencyRecord{
+		val:     val,
+		expires: time.Now().Add(ttl),
+	}
+}
+
+func (store *localIdempotencyStore) get(key string) ([]byte, bool) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	record, exists := store.records[key]
+	if !exists || record.expires.Before(time.Now()) {
+		return nil, false
+	}
+	return record.val, true
+}
+
+func (store *localIdempotencyStore) delete(key string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+
+	delete(store.records, key)
+}
+
+// sweep removes expired records at most once per second, must be called while holding the lock
+func (store *localIdempotencyStore) sweep() {
+	now := time.Now()
+	if now.Sub(store.lastSweep) < time.Second {
+		return
+	}
+	store.lastSweep = now
+	for key, record := range store.records {
+		if record.expires.Before(now) {
+			delete(store.records, key)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+)
+
+func TestRunIdempotentLocal(t *testing.T) {
+	ctx := context.Background()
+	calls := 0
+	f := func() (*QueryResponse, *DistributedError) {
+		calls++
+		return &QueryResponse{Queries: []*QueryRes{{CommandTag: utils.Ptr("INSERT 0 1")}}}, nil
+	}
+
+	res, err := RunIdempotent(ctx, idempotentReq("test-key"), f)
+	if err != nil {
+		t.Fatal(err.Err)
+	}
+	if res.IdempotentReplay {
+		t.Fatal("first response should not be a replay")
+	}
+
+	res, err = RunIdempotent(ctx, idempotentReq("test-key"), f)
+	if err != nil {
+		t.Fatal(err.Err)
+	}
+	if !res.IdempotentReplay || *res.Queries[0].CommandTag != "INSERT 0 1" {
+		t.Fatalf("expected stored response, got %+v", res)
+	}
+	if calls != 1 {
+		t.Fatalf("expected 1 call, got %d", calls)
+	}
+}
+
+func TestRunIdempotentReleasesOnError(t *testing.T) {
+	ctx := context.Background()
+	_, err := RunIdempotent(ctx, idempotentReq("test-key-error"), func() (*QueryResponse, *DistributedError) {
+		return nil, &DistributedError{Err: ErrTxNotFound}
+	})
+	if err == nil || !errors.Is(err.Err, ErrTxNotFound) {
+		t.Fatalf("expected ErrTxNotFound, got %+v", err)
+	}
+
+	res, err := RunIdempotent(ctx, idempotentReq("test-key-error"), func() (*QueryResponse, *DistributedError) {
+		return &QueryResponse{}, nil
+	})
+	if err != nil {
+		t.Fatal(err.Err)
+	}
+	if res.IdempotentReplay {
+		t.Fatal("key should have been released after the error")
+	}
+}
+
+func TestRunIdempotentInProgress(t *testing.T) {
+	ctx := context.Background()
+	_, err := RunIdempotent(ctx, idempotentReq("test-key-progress"), func() (*QueryResponse, *DistributedError) {
+		_, err := RunIdempotent(ctx, idempotentReq("test-key-progress"), func() (*QueryResponse, *DistributedError) {
+			t.Fatal("should not run while the first request is in progress")
+			return nil, nil
+		})
+		if err == nil || !errors.Is(err.Err, ErrIdempotencyInProgress) {
+			t.Fatalf("expected ErrIdempotencyInProgress, got %+v", err)
+		}
+		return &QueryResponse{}, nil
+	})
+	if err != nil {
+		t.Fatal(err.Err)
+	}
+}
+
+func TestRunIdempotentMismatch(t *testing.T) {
+	ctx := context.Background()
+	f := func() (*QueryResponse, *DistributedError) {
+		return &QueryResponse{}, nil
+	}
+	if _, err := RunIdempotent(ctx, idempotentReq("test-key-mismatch"), f); err != nil {
+		t.Fatal(err.Err)
+	}
+
+	req := idempotentReq("test-key-mismatch")
+	req.Queries[0].Params = []any{2}
+	if _, err := RunIdempotent(ctx, req, f); err == nil || !errors.Is(err.Err, ErrIdempotencyMismatch) {
+		t.Fatalf("expected ErrIdempotencyMismatch for different params, got %+v", err)
+	}
+
+	req = idempotentReq("test-key-mismatch")
+	req.TxID = utils.Ptr("tx")
+	if _, err := RunIdempotent(ctx, req, f); err == nil || !errors.Is(err.Err, ErrIdempotencyMismatch) {
+		t.Fatalf("expected ErrIdempotencyMismatch for a different transaction, got %+v", err)
+	}
+
+	res, err := RunIdempotent(ctx, idempotentReq("test-key-mismatch"), f)
+	if err != nil {
+		t.Fatal(err.Err)
+	}
+	if !res.IdempotentReplay {
+		t.Fatal("expected the stored response for the same request")
+	}
+}
+
+func TestRunIdempotentPendingTTL(t *testing.T) {
+	defer func(timeoutMS int64) {
+		utils.QUERY_TIMEOUT_MS = timeoutMS
+	}(utils.QUERY_TIMEOUT_MS)
+	utils.QUERY_TIMEOUT_MS = 100
+
+	ctx := context.Background()
+	_, err := RunIdempotent(ctx, idempotentReq("test-key-pending"), func() (*QueryResponse, *DistributedError) {
+		localIdempotency.mu.Lock()
+		expires := localIdempotency.records["test-key-pending"].expires
+		localIdempotency.mu.Unlock()
+		if expires.After(time.Now().Add(idempotencyMinPendingTTL)) {
+			t.Fatalf("expected the key to be reserved for %s, got until %s", idempotencyMinPendingTTL, expires)
+		}
+
+		// Still reserved once the first reservation would have expired
+		time.Sleep(idempotencyMinPendingTTL + time.Millisecond*200)
+		if _, exists := localIdempotency.get("test-key-pending"); !exists {
+			t.Fatal("expected the reservation to be refreshed")
+		}
+		return &QueryResponse{}, nil
+	})
+	if err != nil {
+		t.Fatal(err.Err)
+	}
+
+	// The response is kept for the full TTL
+	localIdempotency.mu.Lock()
+	expires := localIdempotency.records["test-key-pending"].expires
+	localIdempotency.mu.Unlock()
+	if expires.Before(time.Now().Add(time.Second * time.Duration(utils.IDEMPOTENCY_TTL_SEC-1))) {
+		t.Fatalf("expected the response to be stored for the full TTL, got until %s", expires)
+	}
+}
+
+func idempotentReq(key string) *QueryRequest {
+	return &QueryRequest{
+		Queries: []*QueryReq{{
+			Statement: "INSERT INTO t VALUES ($1)",
+			Params:    []any{1},
+		}},
+		IdempotencyKey: utils.Ptr(key),
+	}
+}
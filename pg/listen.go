@@ -0,0 +1,371 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+)
+
+type (
+	ListenRequest struct {
+		Channel []string `query:"channel" validate:"required,max=32,dive,min=1,max=63"`
+	}
+
+	NotifyRequest struct {
+		Channel string `validate:"required,max=63"`
+		// Postgres limits payloads to 8000 bytes
+		Payload string `validate:"max=7999"`
+		// If provided, the notification is sent when the transaction commits
+		TxID *string
+	}
+
+	Notification struct {
+		Channel string
+		Payload string
+		// The backend PID of the session that sent the notification
+		PID uint32
+	}
+
+	// NotificationListener multiplexes the subscriptions of this pod onto a single dedicated connection outside the
+	// pool, which LISTENs to every channel with a subscriber
+	NotificationListener struct {
+		connect func(ctx context.Context) (*pgx.Conn, error)
+
+		mu   *sync.Mutex
+		subs map[string]map[*Subscription]struct{}
+		// Whether the subscribed channels changed since the connection last LISTENed
+		dirty bool
+		// Interrupts the connection waiting for a notification so it can LISTEN to new channels
+		cancelWait context.CancelFunc
+		// The channels the connection is LISTENing to, only written by the run goroutine while holding mu
+		listening map[string]bool
+		// Whether the run goroutine is holding a connection, it stops once there are no subscriptions
+		running bool
+		closed  bool
+
+		ctx    context.Context
+		cancel context.CancelFunc
+		// Closed when the latest run goroutine exits
+		done chan struct{}
+	}
+
+	Subscription struct {
+		Channels []string
+		C        chan *Notification
+		// Closed once the connection is LISTENing to all the channels
+		Ready chan struct{}
+		// Receives when the connection was lost and re-established, since notifications sent in between were missed
+		Reconnected chan struct{}
+		// Closed when the subscription ends, Err says why
+		Done chan struct{}
+		Err  error
+
+		l     *NotificationListener
+		ready bool
+		ended bool
+	}
+)
+
+const (
+	// How many notifications can be waiting for a subscriber before it's dropped
+	subscriptionBuffer = 256
+	maxReconnectDelay  = time.Second * 10
+)
+
+var (
+	Listener *NotificationListener
+
+	ErrSubscriberTooSlow = errors.New("subscriber fell behind on notifications")
+	ErrListenerClosed    = errors.New("notification listener closed")
+
+	errListenerIdle = errors.New("no subscriptions left")
+)
+
+// NewNotificationListener creates a listener that connects with the pool's config once there is a subscriber
+func NewNotificationListener(pool *pgxpool.Pool) *NotificationListener {
+	return newNotificationListener(func(ctx context.Context) (*pgx.Conn, error) {
+		return pgx.ConnectConfig(ctx, pool.Config().ConnConfig)
+	})
+}
+
+func newNotificationListener(connect func(ctx context.Context) (*pgx.Conn, error)) *NotificationListener {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &NotificationListener{
+		connect:   connect,
+		mu:        &sync.Mutex{},
+		subs:      map[string]map[*Subscription]struct{}{},
+		listening: map[string]bool{},
+		ctx:       ctx,
+		cancel:    cancel,
+	}
+}
+
+// Subscribe subscribes to notifications on the channels until the subscription is closed
+func (l *NotificationListener) Subscribe(channels []string) (*Subscription, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.closed {
+		return nil, ErrListenerClosed
+	}
+
+	sub := &Subscription{
+		Channels:    channels,
+		C:           make(chan *Notification, subscriptionBuffer),
+		Ready:       make(chan struct{}),
+		Reconnected: make(chan struct{}, 1),
+		Done:        make(chan struct{}),
+		l:           l,
+	}
+	for _, channel := range channels {
+		if l.subs[channel] == nil {
+			l.subs[channel] = map[*Subscription]struct{}{}
+		}
+		l.subs[channel][sub] = struct{}{}
+	}
+	l.markReady()
+	l.wake()
+
+	if !l.running {
+		l.running = true
+		l.done = make(chan struct{})
+		go l.run(l.done)
+	}
+	return sub, nil
+}
+
+// Close ends the subscription
+func (sub *Subscription) Close() {
+	sub.l.mu.Lock()
+	defer sub.l.mu.Unlock()
+	sub.l.end(sub, nil)
+	sub.l.wake()
+}
+
+// Shutdown closes the connection and ends all subscriptions with ErrListenerClosed
+func (l *NotificationListener) Shutdown() {
+	l.mu.Lock()
+	l.closed = true
+	done := l.done
+	for _, subs := range l.subs {
+		for sub := range subs {
+			l.end(sub, ErrListenerClosed)
+		}
+	}
+	l.mu.Unlock()
+
+	l.cancel()
+	if done != nil {
+		<-done
+	}
+}
+
+// end removes the subscription, must hold mu
+func (l *NotificationListener) end(sub *Subscription, err error) {
+	if sub.ended {
+		return
+	}
+	sub.ended = true
+	sub.Err = err
+	close(sub.Done)
+	for _, channel := range sub.Channels {
+		delete(l.subs[channel], sub)
+		if len(l.subs[channel]) == 0 {
+			delete(l.subs, channel)
+		}
+	}
+}
+
+// wake has the connection update the channels it LISTENs to, must hold mu
+func (l *NotificationListener) wake() {
+	l.dirty = true
+	if l.cancelWait != nil {
+		l.cancelWait()
+	}
+}
+
+// markReady readies the subscriptions whose channels are all being LISTENed to, must hold mu
+func (l *NotificationListener) markReady() {
+	for _, subs := range l.subs {
+		for sub := range subs {
+			if sub.ready {
+				continue
+			}
+			ready := true
+			for _, channel := range sub.Channels {
+				if !l.listening[channel] {
+					ready = false
+					break
+				}
+			}
+			if ready {
+				sub.ready = true
+				close(sub.Ready)
+			}
+		}
+	}
+}
+
+// run keeps a connection LISTENing until the listener shuts down or there are no subscriptions left, reconnecting if
+// it's lost
+func (l *NotificationListener) run(done chan struct{}) {
+	defer close(done)
+	delay := time.Millisecond * 100
+	reconnected := false
+	for l.ctx.Err() == nil {
+		if l.stopIfIdle() {
+			return
+		}
+		conn, err := l.connect(l.ctx)
+		if err != nil {
+			logger.Error().Err(err).Msg("error connecting notification listener")
+			select {
+			case <-time.After(delay):
+			case <-l.ctx.Done():
+			}
+			if delay *= 2; delay > maxReconnectDelay {
+				delay = maxReconnectDelay
+			}
+			continue
+		}
+		delay = time.Millisecond * 100
+
+		err = l.listen(conn, reconnected)
+		reconnected = true
+		closeCtx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		conn.Close(closeCtx)
+		cancel()
+		if errors.Is(err, errListenerIdle) {
+			return
+		}
+
+		l.mu.Lock()
+		l.listening = map[string]bool{}
+		l.mu.Unlock()
+		if l.ctx.Err() == nil {
+			logger.Warn().Err(err).Msg("notification listener connection lost, reconnecting")
+		}
+	}
+}
+
+// stopIfIdle marks the run goroutine as stopped if there are no subscriptions, so the next Subscribe starts another
+func (l *NotificationListener) stopIfIdle() bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.subs) > 0 {
+		return false
+	}
+	l.running = false
+	l.listening = map[string]bool{}
+	return true
+}
+
+// listen LISTENs to the subscribed channels and dispatches notifications until the connection fails, or
+// errListenerIdle once there are no subscriptions left
+func (l *NotificationListener) listen(conn *pgx.Conn, reconnected bool) error {
+	for {
+		if l.stopIfIdle() {
+			return errListenerIdle
+		}
+		l.mu.Lock()
+		l.dirty = false
+		channels := make([]string, 0, len(l.subs))
+		for channel := range l.subs {
+			channels = append(channels, channel)
+		}
+		l.mu.Unlock()
+
+		if err := l.syncChannels(conn, channels); err != nil {
+			return err
+		}
+
+		l.mu.Lock()
+		l.markReady()
+		if reconnected {
+			reconnected = false
+			for _, subs := range l.subs {
+				for sub := range subs {
+					select {
+					case sub.Reconnected <- struct{}{}:
+					default:
+					}
+				}
+			}
+		}
+		if l.dirty {
+			l.mu.Unlock()
+			continue
+		}
+		ctx, cancel := context.WithCancel(l.ctx)
+		l.cancelWait = cancel
+		l.mu.Unlock()
+
+		n, err := conn.WaitForNotification(ctx)
+		l.mu.Lock()
+		l.cancelWait = nil
+		if n != nil {
+			l.dispatch(n)
+		}
+		l.mu.Unlock()
+		cancel()
+
+		if err != nil && !(errors.Is(err, context.Canceled) && l.ctx.Err() == nil) {
+			return err
+		}
+	}
+}
+
+// syncChannels LISTENs to the new channels and UNLISTENs from the ones without subscribers
+func (l *NotificationListener) syncChannels(conn *pgx.Conn, channels []string) error {
+	wanted := map[string]bool{}
+	var statements []string
+	sort.Strings(channels)
+	for _, channel := range channels {
+		wanted[channel] = true
+		if !l.listening[channel] {
+			statements = append(statements, "LISTEN "+pgx.Identifier{channel}.Sanitize())
+		}
+	}
+	for channel := range l.listening {
+		if !wanted[channel] {
+			statements = append(statements, "UNLISTEN "+pgx.Identifier{channel}.Sanitize())
+		}
+	}
+	if len(statements) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(l.ctx, time.Second*10)
+	defer cancel()
+	if _, err := conn.Exec(ctx, strings.Join(statements, "; ")); err != nil {
+		return fmt.Errorf("error in LISTEN: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.listening = wanted
+	return nil
+}
+
+// dispatch sends the notification to the channel's subscribers, ending the ones that fell behind, must hold mu
+func (l *NotificationListener) dispatch(n *pgconn.Notification) {
+	notification := &Notification{
+		Channel: n.Channel,
+		Payload: n.Payload,
+		PID:     n.PID,
+	}
+	for sub := range l.subs[n.Channel] {
+		select {
+		case sub.C <- notification:
+		default:
+			l.end(sub, ErrSubscriberTooSlow)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+)
+
+func TestNotificationListenerSubscriptions(t *testing.T) {
+	l := newNotificationListener(func(ctx context.Context) (*pgx.Conn, error) {
+		return nil, errors.New("no database")
+	})
+	defer l.Shutdown()
+
+	sub, err := l.Subscribe([]string{"a", "b"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := l.Subscribe([]string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.mu.Lock()
+	l.dispatch(&pgconn.Notification{Channel: "a", Payload: "1"})
+	l.dispatch(&pgconn.Notification{Channel: "b", Payload: "2"})
+	l.mu.Unlock()
+	if n := <-sub.C; n.Channel != "a" || n.Payload != "1" {
+		t.Fatalf("unexpected notification %+v", n)
+	}
+	if n := <-sub.C; n.Channel != "b" || n.Payload != "2" {
+		t.Fatalf("unexpected notification %+v", n)
+	}
+	if n := <-other.C; n.Channel != "a" || len(other.C) != 0 {
+		t.Fatalf("unexpected notification %+v", n)
+	}
+
+	select {
+	case <-sub.Ready:
+		t.Fatal("subscription ready without listening")
+	default:
+	}
+
+	other.Close()
+	if len(l.subs["a"]) != 1 {
+		t.Fatalf("expected 1 subscriber left on a, got %d", len(l.subs["a"]))
+	}
+
+	// A subscriber that falls behind is dropped
+	l.mu.Lock()
+	for i := 0; i <= subscriptionBuffer; i++ {
+		l.dispatch(&pgconn.Notification{Channel: "b"})
+	}
+	l.mu.Unlock()
+	<-sub.Done
+	if !errors.Is(sub.Err, ErrSubscriberTooSlow) {
+		t.Fatalf("expected ErrSubscriberTooSlow, got %v", sub.Err)
+	}
+	if len(l.subs) != 0 {
+		t.Fatalf("expected no subscribed channels, got %v", l.subs)
+	}
+}
+
+func TestNotificationListenerShutdown(t *testing.T) {
+	l := newNotificationListener(func(ctx context.Context) (*pgx.Conn, error) {
+		return nil, errors.New("no database")
+	})
+	sub, err := l.Subscribe([]string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l.Shutdown()
+	<-sub.Done
+	if !errors.Is(sub.Err, ErrListenerClosed) {
+		t.Fatalf("expected ErrListenerClosed, got %v", sub.Err)
+	}
+	if _, err := l.Subscribe([]string{"a"}); !errors.Is(err, ErrListenerClosed) {
+		t.Fatalf("expected ErrListenerClosed, got %v", err)
+	}
+}
+
+func TestNotificationListenerStopsWhenIdle(t *testing.T) {
+	var connects int32
+	l := newNotificationListener(func(ctx context.Context) (*pgx.Conn, error) {
+		atomic.AddInt32(&connects, 1)
+		return nil, errors.New("no database")
+	})
+	defer l.Shutdown()
+
+	sub, err := l.Subscribe([]string{"a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.mu.Lock()
+	done := l.done
+	l.mu.Unlock()
+	sub.Close()
+
+	// Stops after the reconnect delay, rather than reconnecting forever
+	select {
+	case <-done:
+	case <-time.After(time.Second * 5):
+		t.Fatal("expected the listener to stop without subscriptions")
+	}
+	l.mu.Lock()
+	running := l.running
+	l.mu.Unlock()
+	if running {
+		t.Fatal("expected the listener to not be running")
+	}
+
+	before := atomic.LoadInt32(&connects)
+	if _, err := l.Subscribe([]string{"a"}); err != nil {
+		t.Fatal(err)
+	}
+	// Starts again for the new subscription
+	deadline := time.Now().Add(time.Second * 5)
+	for atomic.LoadInt32(&connects) == before {
+		if time.Now().After(deadline) {
+			t.Fatal("expected the listener to connect again")
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+}
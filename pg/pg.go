@@ -2,10 +2,12 @@ package pg
 
 import (
 	"context"
+	"fmt"
 	"time"
 
 	"github.com/danthegoodman1/SQLGateway/gologger"
 	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
@@ -28,6 +30,14 @@ func ConnectToDB() error {
 	config.HealthCheckPeriod = time.Second * 5
 	config.MaxConnLifetime = time.Minute * 30
 	config.MaxConnIdleTime = time.Minute * 30
+	config.AfterConnect = func(ctx context.Context, conn *pgx.Conn) error {
+		// Have the database enforce the query timeout as well, requests with their own timeout override it until released
+		_, err := conn.Exec(ctx, fmt.Sprintf("SET statement_timeout = %d", utils.QUERY_TIMEOUT_MS))
+		if err != nil {
+			return fmt.Errorf("error setting statement_timeout: %w", err)
+		}
+		return nil
+	}
 
 	PGPool, err = pgxpool.ConnectConfig(context.Background(), config)
 	if err != nil {
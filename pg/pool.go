@@ -1,20 +1,17 @@
 package pg
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/danthegoodman1/SQLGateway/gologger"
-	"github.com/danthegoodman1/SQLGateway/red"
+	"github.com/danthegoodman1/SQLGateway/peer"
 	"github.com/danthegoodman1/SQLGateway/utils"
-	"github.com/go-redis/redis/v9"
 	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 	"github.com/rs/zerolog"
-	"io"
 	"net/http"
 	"time"
 )
@@ -30,12 +27,23 @@ type (
 	}
 
 	QueryRes struct {
-		Columns  []any   `json:",omitempty"`
-		Rows     [][]any `json:",omitempty"`
-		Error    *string `json:",omitempty"`
-		TimeNS   *int64  `json:",omitempty"`
-		CacheHit *bool   `json:",omitempty"`
-		Cached   *bool   `json:",omitempty"`
+		Columns []any   `json:",omitempty"`
+		Rows    [][]any `json:",omitempty"`
+		// Error is the message of PGError, kept as a string for clients that only read the message
+		Error *string `json:",omitempty"`
+		// PGError is the structured form of the error, set whenever Error is
+		PGError      *QueryError `json:",omitempty"`
+		TimeNS       *int64      `json:",omitempty"`
+		CommandTag   *string     `json:",omitempty"`
+		RowsAffected *int64      `json:",omitempty"`
+		CacheHit     *bool       `json:",omitempty"`
+		Cached       *bool       `json:",omitempty"`
+
+		// the original error, used to decide whether the query can be retried
+		err error
+		// only kept instead of Rows if the context is from WithRawRows
+		fields  []pgproto3.FieldDescription
+		rawRows [][][]byte
 	}
 
 	Queryable interface {
@@ -46,6 +54,12 @@ type (
 	QueryRequest struct {
 		Queries []*QueryReq
 		TxID    *string
+		// If provided, repeated requests with the same key get the original response instead of running again
+		IdempotencyKey *string `validate:"omitempty,min=1,max=256"`
+		// If provided, the request can be cancelled with /psql/cancel while it is running
+		QueryID *string `validate:"omitempty,min=1,max=128"`
+		// Defaults to QUERY_TIMEOUT_MS, capped at QUERY_MAX_TIMEOUT_MS
+		TimeoutMS *int64 `validate:"omitempty,min=1"`
 	}
 
 	QueryResponse struct {
@@ -53,14 +67,43 @@ type (
 
 		// Whether this was processed on a remote node
 		Remote bool `json:",omitempty"`
+
+		// Whether this is a stored response for a previously seen idempotency key
+		IdempotentReplay bool `json:",omitempty"`
+
+		// If a query in a transaction failed, the savepoint that the transaction was rolled back to
+		RolledBackToSavepoint *string `json:",omitempty"`
 	}
 
 	TxIDJSON struct {
 		TxID string
 	}
 
+	SavepointRequest struct {
+		TxID string `validate:"required"`
+		Name string `validate:"required,max=63"`
+	}
+
+	ExtendRequest struct {
+		TxID string `validate:"required"`
+		// Defaults to the timeout the transaction was started with
+		TxTimeoutSec *int64 `validate:"omitempty,min=1"`
+	}
+
+	ExtendResponse struct {
+		Expires time.Time
+	}
+
 	BeginRequest struct {
-		TxTimeoutSec *int64
+		// Defaults to TX_TIMEOUT_SEC, capped at TX_MAX_LIFETIME_SEC
+		TxTimeoutSec *int64 `validate:"omitempty,min=1"`
+		// The statement_timeout for queries in the transaction. Defaults to QUERY_TIMEOUT_MS, capped at QUERY_MAX_TIMEOUT_MS
+		TimeoutMS      *int64  `validate:"omitempty,min=1"`
+		IsoLevel       *string `validate:"omitempty,oneof=serializable 'repeatable read' 'read committed' 'read uncommitted'"`
+		AccessMode     *string `validate:"omitempty,oneof='read write' 'read only'"`
+		DeferrableMode *string `validate:"omitempty,oneof=deferrable 'not deferrable'"`
+		// CockroachDB only, e.g. `follower_read_timestamp()` or `-10s`. Implies a read only transaction.
+		AsOfSystemTime *string `validate:"omitempty,max=64"`
 	}
 
 	DistributedError struct {
@@ -74,16 +117,25 @@ type (
 var (
 	ErrEndTx           = utils.PermError("end tx")
 	ErrTxNotFoundLocal = errors.New("transaction not found on local pod, maybe the node restarted with the same name, or the transaction aborted")
+	// ErrRemoteUnavailable is returned when the pod owning a transaction could not be reached
+	ErrRemoteUnavailable = errors.New("remote pod unavailable")
+	// ErrRemoteTimeout is returned when the pod owning a transaction did not respond before the request timed out
+	ErrRemoteTimeout = errors.New("timed out waiting for remote pod")
+	// ErrRowsStreamed is returned when a query would be run again after some of its rows were already streamed
+	ErrRowsStreamed = utils.PermError("can't retry the query, rows were already streamed")
 )
 
-func Query(ctx context.Context, pool *pgxpool.Pool, queries []*QueryReq, txID *string) (*QueryResponse, *DistributedError) {
+func Query(ctx context.Context, pool *pgxpool.Pool, req *QueryRequest) (*QueryResponse, *DistributedError) {
+	queries := req.Queries
+	txID := req.TxID
 
 	qres := &QueryResponse{
 		Queries: make([]*QueryRes, len(queries)),
 	}
 
 	logger := zerolog.Ctx(ctx)
-	ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+	timeout := queryTimeout(req.TimeoutMS)
+	ctx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
 	//if query.IgnoreCache == nil || *query.IgnoreCache == false {
@@ -101,81 +153,54 @@ func Query(ctx context.Context, pool *pgxpool.Pool, queries []*QueryReq, txID *s
 		logger.Debug().Msg("transaction detected, handling queries in transaction")
 
 		tx := Manager.GetTx(*txID)
-		if tx == nil && red.RedisClient != nil {
-			// Check for remote transaction
-			txMeta, err := red.GetTransaction(ctx, *txID)
-			if errors.Is(err, redis.Nil) {
-				return nil, &DistributedError{
-					Err: ErrTxNotFound,
-				}
-			}
-			if err != nil {
-				return nil, &DistributedError{
-					Err: fmt.Errorf("error in red.GetTransaction: %w", err),
-				}
-			}
-
-			if txMeta.PodID == utils.POD_NAME {
-				// The only case would be if this node restarted but maintained the same name, without removing transactions from redis
-				return nil, &DistributedError{Err: ErrTxNotFoundLocal}
-			}
-
-			logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
-				return c.Str("remoteURL", txMeta.PodURL)
-			})
-			logger.Debug().Msg("remote transaction found, forwarding")
-
-			bodyJSON, err := json.Marshal(QueryRequest{
-				Queries: queries,
-				TxID:    txID,
-			})
-			if err != nil {
-				return nil, &DistributedError{Err: fmt.Errorf("error in json.Marhsal for remote request body: %w", err)}
-			}
-
-			ctx, cancel := context.WithTimeout(ctx, time.Second*30)
-			defer cancel()
-
-			req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s://%s/psql/query", utils.GetHTTPPrefix(), txMeta.PodURL), bytes.NewReader(bodyJSON))
-			if err != nil {
-				return nil, &DistributedError{Err: fmt.Errorf("error making http request for remote pod: %w", err)}
-			}
-			req.Header.Set("content-type", "application/json")
-
-			res, err := http.DefaultClient.Do(req)
-			if err != nil {
-				return nil, &DistributedError{Err: fmt.Errorf("error doing request to remote pod: %w", err)}
-			}
-
-			resBodyBytes, err := io.ReadAll(res.Body)
-			if err != nil {
-				return nil, &DistributedError{Err: fmt.Errorf("error reading body bytes from remote pod response: %w", err)}
-			}
-
-			if res.StatusCode != 200 {
-				return nil, &DistributedError{Remote: true, StatusCode: res.StatusCode, ErrString: string(resBodyBytes)}
-			}
-
-			err = json.Unmarshal(resBodyBytes, &qres)
-			if err != nil {
-				return nil, &DistributedError{Err: fmt.Errorf("error in json.Unmarhsal for remote response body: %w", err)}
+		if tx == nil {
+			// Forward to the pod that owns the transaction
+			remoteURL, dErr := forwardTx(ctx, *txID, &peer.Request{
+				Method: http.MethodPost,
+				Path:   "/psql/query",
+				Body: QueryRequest{
+					Queries:   queries,
+					TxID:      txID,
+					QueryID:   req.QueryID,
+					TimeoutMS: req.TimeoutMS,
+				},
+				Timeout: timeout,
+			}, &qres)
+			if dErr != nil {
+				return nil, dErr
 			}
 
 			if utils.TRACES {
 				logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
-					return c.Str("remote_pod", txMeta.PodURL)
+					return c.Str("remote_pod", remoteURL)
 				})
 			}
 
 			qres.Remote = true
 
 			return qres, nil
-		} else if tx == nil {
-			logger.Debug().Msgf("transaction %s not found", *txID)
-			return nil, &DistributedError{Err: ErrTxNotFound}
 		}
 
-		res, err := tx.RunQueries(ctx, queries)
+		if req.QueryID != nil {
+			var done func()
+			var dErr *DistributedError
+			ctx, done, dErr = registerRunningQuery(ctx, *req.QueryID, cancel, timeout)
+			if dErr != nil {
+				return nil, dErr
+			}
+			defer done()
+		}
+		defer setRunningQueryConn(ctx, tx.PoolConn.Conn().PgConn())()
+
+		if utils.TX_SLIDING_EXPIRY {
+			_, dErr := Manager.extendLocalTx(ctx, tx, nil)
+			if dErr != nil {
+				return nil, dErr
+			}
+		}
+
+		res, savepoint, err := tx.RunQueries(ctx, queries)
+		qres.RolledBackToSavepoint = savepoint
 		if err != nil {
 			logger.Debug().Msg("error found when running queries in transaction, rolling back")
 			err := Manager.RollbackTx(ctx, *txID)
@@ -187,37 +212,79 @@ func Query(ctx context.Context, pool *pgxpool.Pool, queries []*QueryReq, txID *s
 		return qres, nil
 	}
 
+	if req.QueryID != nil {
+		var done func()
+		var dErr *DistributedError
+		ctx, done, dErr = registerRunningQuery(ctx, *req.QueryID, cancel, timeout)
+		if dErr != nil {
+			return nil, dErr
+		}
+		defer done()
+	}
+
 	var queryErr error
-	// If single item, don't do in tx
+	attemptTimeout := time.Millisecond * time.Duration(utils.QUERY_ATTEMPT_TIMEOUT_MS)
+	// If single item, don't do in tx, so statements that can't run in a transaction block (e.g. VACUUM) work
 	if len(queries) == 1 {
-		queryErr = utils.ReliableExec(ctx, pool, time.Second*60, func(ctx context.Context, conn *pgxpool.Conn) error {
+		queryErr = utils.ReliableExec(ctx, pool, attemptTimeout, func(ctx context.Context, conn *pgxpool.Conn) error {
+			if rowBatchesSent(ctx) {
+				return ErrRowsStreamed
+			}
+			if req.TimeoutMS != nil {
+				reset, err := setStatementTimeout(ctx, conn, queryTimeoutMS(req.TimeoutMS))
+				if err != nil {
+					return err
+				}
+				defer reset()
+			}
+			defer setRunningQueryConn(ctx, conn.Conn().PgConn())()
 			queryRes := runQuery(ctx, conn, utils.Deref(queries[0].Exec, false), queries[0].Statement, queries[0].Params)
 			qres.Queries[0] = queryRes
 			if queryRes.Error != nil {
-				return ErrEndTx
+				return attemptErr(ctx, queryRes)
 			}
 			return nil
 		})
 	} else {
-		queryErr = utils.ReliableExecInTx(ctx, pool, 60*time.Second, func(ctx context.Context, conn pgx.Tx) (err error) {
-			for i, query := range queries {
-				queryRes := runQuery(ctx, conn, utils.Deref(query.Exec, false), query.Statement, query.Params)
-				qres.Queries[i] = queryRes
-				if queryRes.Error != nil {
-					return ErrEndTx
-				}
-			}
-			return nil
-		})
+		queryErr = utils.ReliableExecInTx(ctx, pool, attemptTimeout, runQueriesInTx(qres, queries, req.TimeoutMS))
 	}
 
-	if queryErr != nil && !errors.Is(queryErr, ErrEndTx) {
+	// If retries were exhausted then the last query error is already in the response
+	if queryErr != nil && !errors.Is(queryErr, ErrEndTx) && !hasQueryError(qres) {
 		return nil, &DistributedError{Err: fmt.Errorf("error in transaction execution: %w", queryErr)}
 	}
 
 	return qres, nil
 }
 
+// runQueriesInTx returns the function that runs an attempt of the queries in a transaction, putting the results in qres.
+// It's run again if the transaction has to be retried, including when the commit fails with a serialization failure.
+func runQueriesInTx(qres *QueryResponse, queries []*QueryReq, timeoutMS *int64) func(ctx context.Context, conn pgx.Tx) error {
+	return func(ctx context.Context, conn pgx.Tx) error {
+		// The previous attempt may have failed to commit after sending rows
+		if rowBatchesSent(ctx) {
+			return ErrRowsStreamed
+		}
+		defer setRunningQueryConn(ctx, conn.Conn().PgConn())()
+		if timeoutMS != nil {
+			_, err := conn.Exec(ctx, statementTimeoutStatement(queryTimeoutMS(timeoutMS)))
+			if err != nil {
+				return fmt.Errorf("error setting statement_timeout: %w", err)
+			}
+		}
+		// Clear out results from any previous attempt
+		qres.Queries = make([]*QueryRes, len(queries))
+		for i, query := range queries {
+			queryRes := runQuery(ctx, conn, utils.Deref(query.Exec, false), query.Statement, query.Params)
+			qres.Queries[i] = queryRes
+			if queryRes.Error != nil {
+				return attemptErr(ctx, queryRes)
+			}
+		}
+		return nil
+	}
+}
+
 func runQuery(ctx context.Context, q Queryable, exec bool, statement string, params []any) (res *QueryRes) {
 	res = &QueryRes{
 		Rows: make([][]any, 0),
@@ -234,16 +301,20 @@ func runQuery(ctx context.Context, q Queryable, exec bool, statement string, par
 	}()
 
 	if exec {
-		_, err := q.Exec(ctx, statement, params...)
+		tag, err := q.Exec(ctx, statement, params...)
 		if err != nil {
-			res.Error = utils.Ptr(err.Error())
+			res.setError(NewQueryError(err))
+			res.err = err
 			logger.Warn().Err(err).Msg("got exec error")
+			return
 		}
+		setCommandTag(res, tag)
 	} else {
 		// Get columns
 		rows, err := q.Query(ctx, statement, params...)
 		if err != nil {
-			res.Error = utils.Ptr(err.Error())
+			res.setError(NewQueryError(err))
+			res.err = err
 			logger.Warn().Err(err).Msg("got query error")
 			return
 		}
@@ -252,15 +323,49 @@ func runQuery(ctx context.Context, q Queryable, exec bool, statement string, par
 			res.Columns = append(res.Columns, string(desc.Name))
 		}
 
+		raw := rawRows(ctx)
+		batches := rowBatchesFromCtx(ctx)
+		if raw {
+			res.fields = copyFieldDescriptions(rows.FieldDescriptions())
+		}
+
 		// Get res values
 		for rows.Next() {
+			if raw {
+				// The raw values are only valid until the next row
+				rowVals := make([][]byte, len(rows.RawValues()))
+				for i, val := range rows.RawValues() {
+					if val != nil {
+						rowVals[i] = append([]byte{}, val...)
+					}
+				}
+				res.rawRows = append(res.rawRows, rowVals)
+				continue
+			}
 			rowVals, err := rows.Values()
 			if err != nil {
-				res.Error = utils.Ptr(err.Error())
+				rows.Close()
+				res.setError(NewQueryError(err))
+				res.err = err
 				return
 			}
 			res.Rows = append(res.Rows, rowVals)
+			if batches != nil && len(res.Rows) == batches.size {
+				batches.f(res.Columns, res.Rows)
+				batches.sent = true
+				res.Rows = make([][]any, 0, batches.size)
+			}
 		}
+
+		// The command tag is only available once the rows are closed
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			res.setError(NewQueryError(err))
+			res.err = err
+			logger.Warn().Err(err).Msg("got rows error")
+			return
+		}
+		setCommandTag(res, rows.CommandTag())
 	}
 
 	//selectOnly, err := CRDBIsSelectOnly(query.Statement)
@@ -274,6 +379,69 @@ func runQuery(ctx context.Context, q Queryable, exec bool, statement string, par
 	return
 }
 
+// queryTimeoutMS returns the timeout in milliseconds for a request, defaulting to QUERY_TIMEOUT_MS and capped at QUERY_MAX_TIMEOUT_MS
+func queryTimeoutMS(timeoutMS *int64) int64 {
+	ms := utils.Deref(timeoutMS, utils.QUERY_TIMEOUT_MS)
+	if ms > utils.QUERY_MAX_TIMEOUT_MS {
+		ms = utils.QUERY_MAX_TIMEOUT_MS
+	}
+	return ms
+}
+
+func queryTimeout(timeoutMS *int64) time.Duration {
+	return time.Millisecond * time.Duration(queryTimeoutMS(timeoutMS))
+}
+
+// setStatementTimeout sets the statement_timeout of a pool connection outside a transaction, returning a function that
+// resets it to QUERY_TIMEOUT_MS that must be called before the connection is released. If it can't be reset then the
+// connection is closed, so that the pool does not hand it out with the wrong timeout.
+func setStatementTimeout(ctx context.Context, conn *pgxpool.Conn, timeoutMS int64) (func(), error) {
+	_, err := conn.Exec(ctx, fmt.Sprintf("SET statement_timeout = %d", timeoutMS))
+	if err != nil {
+		return nil, fmt.Errorf("error setting statement_timeout: %w", err)
+	}
+	return func() {
+		// The request context may be done by now
+		resetCtx, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+		defer cancel()
+		_, err := conn.Exec(resetCtx, fmt.Sprintf("SET statement_timeout = %d", utils.QUERY_TIMEOUT_MS))
+		if err != nil {
+			zerolog.Ctx(ctx).Warn().Err(err).Msg("error resetting statement_timeout, closing connection")
+			conn.Conn().Close(resetCtx)
+		}
+	}, nil
+}
+
+// attemptErr returns the error that ends the current execution attempt of a failed query. Serialization failures
+// return the original error so that they are retried, unless rows were already streamed, everything else ends the
+// attempt permanently.
+func attemptErr(ctx context.Context, res *QueryRes) error {
+	if utils.IsRetryableTxErr(res.err) && !rowBatchesSent(ctx) {
+		return res.err
+	}
+	return ErrEndTx
+}
+
+func hasQueryError(qres *QueryResponse) bool {
+	for _, res := range qres.Queries {
+		if res != nil && res.Error != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// setError sets both the structured error and its message
+func (res *QueryRes) setError(qErr *QueryError) {
+	res.PGError = qErr
+	res.Error = &qErr.Message
+}
+
+func setCommandTag(res *QueryRes, tag pgconn.CommandTag) {
+	res.CommandTag = utils.Ptr(tag.String())
+	res.RowsAffected = utils.Ptr(tag.RowsAffected())
+}
+
 //func ShouldCache(ignoreCache, forceCache *bool) bool {
 //	if ignoreCache != nil {
 //		return *ignoreCache
@@ -311,15 +479,19 @@ func TraceQueries(ctx context.Context, start time.Time, queries []*QueryReq, qre
 					}
 					execd := utils.Deref(queries[i].Exec, false)
 					actionLog := gologger.Action{
-						DurationNS: *queryRes.TimeNS,
-						Statement:  queries[i].Statement,
-						Exec:       execd,
+						DurationNS:   *queryRes.TimeNS,
+						Statement:    queries[i].Statement,
+						Exec:         execd,
+						CommandTag:   utils.Deref(queryRes.CommandTag, ""),
+						RowsAffected: queryRes.RowsAffected,
 					}
-					if !execd {
-						actionLog.NumRows = utils.Ptr(len(queryRes.Rows))
+					if !execd && queryRes.RowsAffected != nil {
+						// Rows aren't kept in Rows for raw rows or row batches, but the command tag always has the count
+						actionLog.NumRows = utils.Ptr(int(*queryRes.RowsAffected))
 					}
 					if queryRes.Error != nil {
-						actionLog.Error = *queryRes.Error
+						actionLog.Error = queryRes.PGError.Message
+						actionLog.ErrorCode = queryRes.PGError.Code
 					}
 
 					actionLogs = append(actionLogs, actionLog)
@@ -332,3 +504,31 @@ func TraceQueries(ctx context.Context, start time.Time, queries []*QueryReq, qre
 		})
 	}
 }
+
+type (
+	rowBatchesCtxKey struct{}
+
+	rowBatches struct {
+		size int
+		f    func(columns []any, rows [][]any)
+		// Whether a batch was passed to f, so the query can't be retried without sending rows twice
+		sent bool
+	}
+)
+
+// WithRowBatches returns a context that has f called with every size rows of a query as they are read, instead of them
+// being collected in QueryRes.Rows, so large results can be streamed. The rows that don't fill a batch are left in
+// QueryRes.Rows. Queries are not retried once a batch was sent.
+func WithRowBatches(ctx context.Context, size int, f func(columns []any, rows [][]any)) context.Context {
+	return context.WithValue(ctx, rowBatchesCtxKey{}, &rowBatches{size: size, f: f})
+}
+
+func rowBatchesFromCtx(ctx context.Context) *rowBatches {
+	batches, _ := ctx.Value(rowBatchesCtxKey{}).(*rowBatches)
+	return batches
+}
+
+func rowBatchesSent(ctx context.Context) bool {
+	batches := rowBatchesFromCtx(ctx)
+	return batches != nil && batches.sent
+}
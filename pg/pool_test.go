@@ -0,0 +1,117 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/cockroachdb/cockroach-go/v2/crdb"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgx/v4"
+)
+
+type (
+	// fakeTx returns rows of a single column for every query, and fails the first release of the retry savepoint with
+	// a serialization failure like a commit that has to be retried
+	fakeTx struct {
+		pgx.Tx
+		rows     int
+		releases int
+	}
+
+	// crdbTx is the savepoint retry interface over a fakeTx
+	crdbTx struct {
+		tx *fakeTx
+	}
+
+	fakeRows struct {
+		pgx.Rows
+		left int
+	}
+)
+
+func (tx *fakeTx) Query(context.Context, string, ...any) (pgx.Rows, error) {
+	return &fakeRows{left: tx.rows}, nil
+}
+
+func (tx *fakeTx) Conn() *pgx.Conn {
+	return &pgx.Conn{}
+}
+
+func (tx *fakeTx) crdbTx() crdb.Tx {
+	return crdbTx{tx}
+}
+
+func (r *fakeRows) Next() bool {
+	r.left--
+	return r.left >= 0
+}
+
+func (r *fakeRows) Values() ([]any, error) {
+	return []any{int64(r.left)}, nil
+}
+
+func (r *fakeRows) FieldDescriptions() []pgproto3.FieldDescription {
+	return []pgproto3.FieldDescription{{Name: []byte("n")}}
+}
+
+func (r *fakeRows) Close() {}
+
+func (r *fakeRows) Err() error {
+	return nil
+}
+
+func (r *fakeRows) CommandTag() pgconn.CommandTag {
+	return pgconn.CommandTag("SELECT 3")
+}
+
+func (c crdbTx) Exec(_ context.Context, sql string, _ ...any) error {
+	if sql == "RELEASE SAVEPOINT cockroach_restart" {
+		c.tx.releases++
+		if c.tx.releases == 1 {
+			return &pgconn.PgError{Code: "40001", Message: "restart transaction"}
+		}
+	}
+	return nil
+}
+
+func (c crdbTx) Commit(context.Context) error {
+	return nil
+}
+
+func (c crdbTx) Rollback(context.Context) error {
+	return nil
+}
+
+func TestRunQueriesInTxCommitRetry(t *testing.T) {
+	queries := []*QueryReq{{Statement: "SELECT 1"}, {Statement: "SELECT n FROM t"}}
+
+	// Without streaming the queries are run again
+	tx := &fakeTx{rows: 3}
+	qres := &QueryResponse{}
+	ctx := context.Background()
+	f := runQueriesInTx(qres, queries, nil)
+	if err := crdb.ExecuteInTx(ctx, tx.crdbTx(), func() error { return f(ctx, tx) }); err != nil {
+		t.Fatal(err)
+	}
+	if tx.releases != 2 || len(qres.Queries[1].Rows) != 3 {
+		t.Fatalf("expected the queries to be retried, got %d releases and %d rows", tx.releases, len(qres.Queries[1].Rows))
+	}
+
+	// Once a batch was sent the retry fails instead of sending the rows again
+	tx = &fakeTx{rows: 3}
+	qres = &QueryResponse{}
+	var batches int
+	ctx = WithRowBatches(context.Background(), 2, func(columns []any, rows [][]any) {
+		batches++
+	})
+	f = runQueriesInTx(qres, queries, nil)
+	err := crdb.ExecuteInTx(ctx, tx.crdbTx(), func() error { return f(ctx, tx) })
+	if !errors.Is(err, ErrRowsStreamed) {
+		t.Fatalf("expected rows streamed error, got %v", err)
+	}
+	if batches != 2 {
+		t.Fatalf("expected a batch from each query, got %d", batches)
+	}
+}
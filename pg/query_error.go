@@ -0,0 +1,125 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/jackc/pgconn"
+)
+
+type (
+	// QueryError is the structured form of an error returned by the database for a single query
+	QueryError struct {
+		Message string
+		// Class is a coarse classification of the error so clients can decide how to react, see the ErrorClass* constants
+		Class string
+
+		// The following are only present if the error came from the database
+		Code       string `json:",omitempty"`
+		Severity   string `json:",omitempty"`
+		Detail     string `json:",omitempty"`
+		Hint       string `json:",omitempty"`
+		Constraint string `json:",omitempty"`
+		Table      string `json:",omitempty"`
+		Column     string `json:",omitempty"`
+		Position   int32  `json:",omitempty"`
+		// Where the error occurred, e.g. the line of a COPY
+		Where string `json:",omitempty"`
+	}
+)
+
+const (
+	// ErrorClassRetryable indicates that the query can be safely retried (serialization failures, deadlocks, connection loss)
+	ErrorClassRetryable = "retryable"
+	// ErrorClassConstraint indicates an integrity constraint violation (unique, foreign key, check, not null)
+	ErrorClassConstraint = "constraint"
+	// ErrorClassSyntax indicates a syntax error or a reference to something that does not exist
+	ErrorClassSyntax = "syntax"
+	// ErrorClassPermission indicates insufficient privileges or failed authorization
+	ErrorClassPermission = "permission"
+	// ErrorClassData indicates invalid data, such as a bad cast or a division by zero
+	ErrorClassData = "data"
+	// ErrorClassCanceled indicates that the query was canceled
+	ErrorClassCanceled = "canceled"
+	// ErrorClassTimeout indicates that the query timed out
+	ErrorClassTimeout = "timeout"
+	// ErrorClassOther is used for everything else
+	ErrorClassOther = "other"
+
+	codeQueryCanceled = "57014"
+)
+
+// NewQueryError builds a QueryError from an error returned while running a query
+func NewQueryError(err error) *QueryError {
+	qErr := &QueryError{
+		Message: err.Error(),
+		Class:   ErrorClassOther,
+	}
+
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		qErr.Code = pgErr.Code
+		qErr.Severity = pgErr.Severity
+		qErr.Detail = pgErr.Detail
+		qErr.Hint = pgErr.Hint
+		qErr.Constraint = pgErr.ConstraintName
+		qErr.Table = pgErr.TableName
+		qErr.Column = pgErr.ColumnName
+		qErr.Position = pgErr.Position
+		qErr.Where = pgErr.Where
+		qErr.Class = ClassifySQLState(pgErr.Code)
+		if pgErr.Code == codeQueryCanceled && strings.Contains(pgErr.Message, "statement timeout") {
+			// statement_timeout cancels with the same code as a cancel request, but not the same message
+			qErr.Class = ErrorClassTimeout
+		}
+		return qErr
+	}
+
+	if errors.Is(err, context.DeadlineExceeded) {
+		qErr.Class = ErrorClassTimeout
+	} else if errors.Is(err, context.Canceled) {
+		qErr.Class = ErrorClassCanceled
+	} else if pgconn.SafeToRetry(err) {
+		qErr.Class = ErrorClassRetryable
+	}
+	return qErr
+}
+
+// ClassifySQLState maps a SQLSTATE code to one of the ErrorClass* constants
+func ClassifySQLState(code string) string {
+	switch code {
+	case "40001", "40P01":
+		// serialization failure, deadlock detected
+		return ErrorClassRetryable
+	case "57P01", "57P02", "57P03":
+		// admin shutdown, crash shutdown, cannot connect now
+		return ErrorClassRetryable
+	case codeQueryCanceled:
+		// query canceled, NewQueryError tells statement timeouts apart by the message
+		return ErrorClassCanceled
+	case "42501":
+		// insufficient privilege
+		return ErrorClassPermission
+	}
+
+	switch {
+	case strings.HasPrefix(code, "08"):
+		// connection exception
+		return ErrorClassRetryable
+	case strings.HasPrefix(code, "23"):
+		// integrity constraint violation
+		return ErrorClassConstraint
+	case strings.HasPrefix(code, "28"):
+		// invalid authorization specification
+		return ErrorClassPermission
+	case strings.HasPrefix(code, "42"):
+		// syntax error or access rule violation
+		return ErrorClassSyntax
+	case strings.HasPrefix(code, "22"):
+		// data exception
+		return ErrorClassData
+	}
+
+	return ErrorClassOther
+}
@@ -0,0 +1,80 @@
+package pg
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/jackc/pgconn"
+)
+
+func TestClassifySQLState(t *testing.T) {
+	cases := map[string]string{
+		"40001": ErrorClassRetryable,
+		"40P01": ErrorClassRetryable,
+		"08006": ErrorClassRetryable,
+		"23505": ErrorClassConstraint,
+		"23503": ErrorClassConstraint,
+		"42601": ErrorClassSyntax,
+		"42P01": ErrorClassSyntax,
+		"42501": ErrorClassPermission,
+		"28P01": ErrorClassPermission,
+		"22012": ErrorClassData,
+		"57014": ErrorClassCanceled,
+		"XX000": ErrorClassOther,
+	}
+	for code, class := range cases {
+		if got := ClassifySQLState(code); got != class {
+			t.Fatalf("expected class %s for code %s, got %s", class, code, got)
+		}
+	}
+}
+
+func TestNewQueryError(t *testing.T) {
+	pgErr := &pgconn.PgError{
+		Severity:       "ERROR",
+		Code:           "23505",
+		Message:        "duplicate key value violates unique constraint \"primary\"",
+		Detail:         "Key (id)=('a') already exists.",
+		ConstraintName: "primary",
+		TableName:      "test_table",
+	}
+	qErr := NewQueryError(fmt.Errorf("wrapped: %w", pgErr))
+	if qErr.Class != ErrorClassConstraint || qErr.Code != "23505" || qErr.Constraint != "primary" || qErr.Table != "test_table" {
+		t.Fatalf("unexpected query error: %+v", qErr)
+	}
+
+	// A statement timeout has the same code as a cancel request
+	qErr = NewQueryError(&pgconn.PgError{Code: "57014", Message: "canceling statement due to statement timeout"})
+	if qErr.Class != ErrorClassTimeout {
+		t.Fatalf("expected a timeout, got %+v", qErr)
+	}
+	qErr = NewQueryError(&pgconn.PgError{Code: "57014", Message: "canceling statement due to user request"})
+	if qErr.Class != ErrorClassCanceled {
+		t.Fatalf("expected a cancellation, got %+v", qErr)
+	}
+
+	qErr = NewQueryError(context.DeadlineExceeded)
+	if qErr.Class != ErrorClassTimeout || qErr.Code != "" {
+		t.Fatalf("unexpected query error: %+v", qErr)
+	}
+
+	// Error stays the message, for clients that read it as a string
+	res := &QueryRes{}
+	res.setError(NewQueryError(pgErr))
+	b, err := json.Marshal(res)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded struct {
+		Error   string
+		PGError QueryError
+	}
+	if err := json.Unmarshal(b, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Error != pgErr.Error() || decoded.PGError.Code != "23505" {
+		t.Fatalf("unexpected query result %s", b)
+	}
+}
@@ -0,0 +1,191 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/coord"
+	"github.com/danthegoodman1/SQLGateway/peer"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgconn"
+	"github.com/rs/zerolog"
+)
+
+type (
+	CancelRequest struct {
+		QueryID string `validate:"required,max=128"`
+	}
+
+	// runningQuery is a query request with a client-supplied ID that is running on this pod
+	runningQuery struct {
+		mu     *sync.Mutex
+		cancel context.CancelFunc
+		// conn is the connection the query is currently running on, nil while waiting for a connection
+		conn *pgconn.PgConn
+	}
+
+	runningQueryRegistry struct {
+		mu      *sync.Mutex
+		queries map[string]*runningQuery
+	}
+
+	runningQueryCtxKey struct{}
+)
+
+var (
+	ErrQueryNotFound = errors.New("query not found, it may have already finished")
+	ErrQueryIDInUse  = errors.New("a query with this id is already running")
+
+	runningQueries = &runningQueryRegistry{
+		mu:      &sync.Mutex{},
+		queries: map[string]*runningQuery{},
+	}
+)
+
+// registerRunningQuery registers the query so that it can be cancelled, returning a context that carries it.
+// The returned function must be called once the query is done.
+func registerRunningQuery(ctx context.Context, queryID string, cancel context.CancelFunc, timeout time.Duration) (context.Context, func(), *DistributedError) {
+	rq := &runningQuery{
+		mu:     &sync.Mutex{},
+		cancel: cancel,
+	}
+
+	runningQueries.mu.Lock()
+	if _, exists := runningQueries.queries[queryID]; exists {
+		runningQueries.mu.Unlock()
+		return ctx, nil, &DistributedError{Err: ErrQueryIDInUse}
+	}
+	runningQueries.queries[queryID] = rq
+	runningQueries.mu.Unlock()
+
+	if coord.Client != nil {
+		err := coord.Client.SetRunningQuery(ctx, &coord.RunningQueryMeta{
+			QueryID: queryID,
+			PodID:   utils.POD_NAME,
+			PodURL:  utils.GetPodURL(),
+		}, timeout)
+		if err != nil {
+			unregisterRunningQuery(context.Background(), queryID)
+			return ctx, nil, &DistributedError{Err: fmt.Errorf("error in coord.Client.SetRunningQuery: %w", err)}
+		}
+	}
+
+	return context.WithValue(ctx, runningQueryCtxKey{}, rq), func() {
+		unregisterRunningQuery(ctx, queryID)
+	}, nil
+}
+
+// WithLocalCancel returns a context for running a query that can be cancelled with the returned function, in the same
+// way as a query with a QueryID, but only from this pod. cancel must cancel the context passed in.
+func WithLocalCancel(ctx context.Context, cancel context.CancelFunc) (context.Context, func(ctx context.Context) *DistributedError) {
+	rq := &runningQuery{
+		mu:     &sync.Mutex{},
+		cancel: cancel,
+	}
+	return context.WithValue(ctx, runningQueryCtxKey{}, rq), rq.cancelQuery
+}
+
+func unregisterRunningQuery(ctx context.Context, queryID string) {
+	runningQueries.mu.Lock()
+	delete(runningQueries.queries, queryID)
+	runningQueries.mu.Unlock()
+
+	if coord.Client != nil {
+		// The request context may be cancelled at this point
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+		defer cancel()
+		err := coord.Client.DeleteRunningQuery(ctx, queryID)
+		if err != nil {
+			logger.Error().Err(err).Str("queryID", queryID).Msg("error in coord.Client.DeleteRunningQuery")
+		}
+	}
+}
+
+// setRunningQueryConn records the connection that the query in the context is running on, if there is one. The
+// returned function clears it, and must be called before the connection is released so that a cancel can't reach
+// whatever runs on it next.
+func setRunningQueryConn(ctx context.Context, conn *pgconn.PgConn) func() {
+	rq, ok := ctx.Value(runningQueryCtxKey{}).(*runningQuery)
+	if !ok {
+		return func() {}
+	}
+	rq.mu.Lock()
+	rq.conn = conn
+	rq.mu.Unlock()
+	return func() {
+		rq.mu.Lock()
+		defer rq.mu.Unlock()
+		if rq.conn == conn {
+			rq.conn = nil
+		}
+	}
+}
+
+// CancelQuery cancels a running query by its client-supplied ID, forwarding to the pod it is running on if required
+func CancelQuery(ctx context.Context, queryID string) *DistributedError {
+	logger := zerolog.Ctx(ctx)
+	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("queryID", queryID)
+	})
+
+	runningQueries.mu.Lock()
+	rq, exists := runningQueries.queries[queryID]
+	runningQueries.mu.Unlock()
+
+	if exists {
+		logger.Debug().Msg("cancelling local query")
+		return rq.cancelQuery(ctx)
+	}
+
+	if coord.Client == nil {
+		return &DistributedError{Err: ErrQueryNotFound}
+	}
+
+	queryMeta, err := coord.Client.GetRunningQuery(ctx, queryID)
+	if errors.Is(err, coord.ErrNotFound) {
+		return &DistributedError{Err: ErrQueryNotFound}
+	}
+	if err != nil {
+		return &DistributedError{Err: fmt.Errorf("error in coord.Client.GetRunningQuery: %w", err)}
+	}
+	if queryMeta.PodID == utils.POD_NAME {
+		// It finished between the local check and now
+		return &DistributedError{Err: ErrQueryNotFound}
+	}
+
+	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("remoteURL", queryMeta.PodURL)
+	})
+	logger.Debug().Msg("cancelling query on remote")
+	return forwardToPod(ctx, queryMeta.PodURL, &peer.Request{
+		Method: http.MethodPost,
+		Path:   "/psql/cancel",
+		Body: CancelRequest{
+			QueryID: queryID,
+		},
+		Idempotent: true,
+	}, nil)
+}
+
+func (rq *runningQuery) cancelQuery(ctx context.Context) *DistributedError {
+	rq.mu.Lock()
+	conn := rq.conn
+	rq.mu.Unlock()
+
+	if conn == nil {
+		// Still waiting for a connection, so we can just cancel the context
+		rq.cancel()
+		return nil
+	}
+
+	// Use a cancel request so the connection can be returned to the pool, rather than closed due to the context
+	err := conn.CancelRequest(ctx)
+	if err != nil {
+		return &DistributedError{Err: fmt.Errorf("error in CancelRequest: %w", err)}
+	}
+	return nil
+}
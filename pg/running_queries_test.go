@@ -0,0 +1,87 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgconn"
+)
+
+func TestRunningQueryCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	_, done, dErr := registerRunningQuery(ctx, "test-query", cancel, time.Second)
+	if dErr != nil {
+		t.Fatal(dErr.Err)
+	}
+
+	_, _, dErr = registerRunningQuery(ctx, "test-query", cancel, time.Second)
+	if dErr == nil || !errors.Is(dErr.Err, ErrQueryIDInUse) {
+		t.Fatalf("expected ErrQueryIDInUse, got %+v", dErr)
+	}
+
+	// No connection yet, so the context is cancelled
+	if dErr = CancelQuery(ctx, "test-query"); dErr != nil {
+		t.Fatal(dErr.Err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("expected the context to be cancelled")
+	}
+
+	done()
+	dErr = CancelQuery(context.Background(), "test-query")
+	if dErr == nil || !errors.Is(dErr.Err, ErrQueryNotFound) {
+		t.Fatalf("expected ErrQueryNotFound, got %+v", dErr)
+	}
+}
+
+func TestRunningQueryConnCleared(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ctx, done, dErr := registerRunningQuery(ctx, "test-query-conn", cancel, time.Second)
+	if dErr != nil {
+		t.Fatal(dErr.Err)
+	}
+	defer done()
+	rq := ctx.Value(runningQueryCtxKey{}).(*runningQuery)
+
+	clearFirst := setRunningQueryConn(ctx, &pgconn.PgConn{})
+	clearFirst()
+	if rq.conn != nil {
+		t.Fatal("expected the connection to be cleared once the attempt finished")
+	}
+
+	// A retry's connection isn't cleared by an earlier attempt
+	second := &pgconn.PgConn{}
+	clearSecond := setRunningQueryConn(ctx, second)
+	clearFirst()
+	if rq.conn != second {
+		t.Fatal("expected the retry's connection to be kept")
+	}
+	clearSecond()
+
+	// Without a connection the cancel falls back to the context
+	if dErr = CancelQuery(ctx, "test-query-conn"); dErr != nil {
+		t.Fatal(dErr.Err)
+	}
+	if ctx.Err() == nil {
+		t.Fatal("expected the context to be cancelled")
+	}
+}
+
+func TestQueryTimeout(t *testing.T) {
+	if d := queryTimeout(nil); d != time.Millisecond*time.Duration(utils.QUERY_TIMEOUT_MS) {
+		t.Fatalf("expected default of QUERY_TIMEOUT_MS, got %s", d)
+	}
+	if d := queryTimeout(utils.Ptr(int64(500))); d != time.Millisecond*500 {
+		t.Fatalf("expected 500ms, got %s", d)
+	}
+	if d := queryTimeout(utils.Ptr(utils.QUERY_MAX_TIMEOUT_MS + 1)); d != time.Millisecond*time.Duration(utils.QUERY_MAX_TIMEOUT_MS) {
+		t.Fatalf("expected timeout to be capped, got %s", d)
+	}
+}
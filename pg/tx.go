@@ -3,9 +3,12 @@ package pg
 import (
 	"context"
 	"errors"
+	"fmt"
 	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/rs/zerolog"
 	"sync"
 	"time"
 )
@@ -19,24 +22,188 @@ type (
 		CancelChan chan bool
 		Exited     bool
 		PoolMu     *sync.Mutex
+		ReadOnly   bool
+		Created    time.Time
+		// TimeoutSec is the timeout the transaction was started with, used when extending it
+		TimeoutSec int64
+		// BackendPID is the PID of the backend process of the pool connection
+		BackendPID uint32
+		// Session is whether the transaction is bound to a session on this pod, rather than registered with the coordinator
+		Session bool
+
+		// statsMu guards the stats below, since PoolMu is held for the duration of queries
+		statsMu        *sync.Mutex
+		statementCount int64
+		lastStatement  string
+
+		// savepoints are the active savepoints, in the order they were created. Guarded by PoolMu
+		savepoints []string
 	}
 )
 
 var (
-	ErrTxError = errors.New("transaction error")
+	ErrTxError           = errors.New("transaction error")
+	ErrSavepointNotFound = errors.New("savepoint not found")
 )
 
-func (tx *Tx) RunQueries(ctx context.Context, queries []*QueryReq) ([]*QueryRes, error) {
+// RunQueries runs the queries in the transaction. If a query fails and the transaction has an active savepoint, then
+// the transaction is rolled back to the most recent savepoint and its name is returned. Otherwise, ErrTxError is returned
+// and the transaction must be rolled back.
+func (tx *Tx) RunQueries(ctx context.Context, queries []*QueryReq) ([]*QueryRes, *string, error) {
 	tx.PoolMu.Lock()
 	defer tx.PoolMu.Unlock()
 
+	onResult := queryResultFunc(ctx)
 	res := make([]*QueryRes, len(queries))
 	for i, query := range queries {
+		tx.recordStatement(query.Statement)
 		queryRes := runQuery(ctx, tx.PoolConn, utils.Deref(query.Exec, false), query.Statement, query.Params)
 		res[i] = queryRes
+		if onResult != nil {
+			onResult(i, queryRes)
+		}
 		if queryRes.Error != nil {
-			return res, ErrTxError
+			savepoint, err := tx.recoverFromError(ctx)
+			return res, savepoint, err
+		}
+	}
+	return res, nil, nil
+}
+
+// Describe prepares the statement in the transaction without running it, to get its parameter and result types. A
+// failed describe is handled like a failed query in RunQueries, since it aborts the transaction in the same way.
+func (tx *Tx) Describe(ctx context.Context, statement string, paramOIDs []uint32) (*pgconn.StatementDescription, *QueryError, *string, error) {
+	tx.PoolMu.Lock()
+	defer tx.PoolMu.Unlock()
+
+	tx.recordStatement(statement)
+	desc, err := tx.PoolConn.Conn().PgConn().Prepare(ctx, "", statement, paramOIDs)
+	if err != nil {
+		savepoint, txErr := tx.recoverFromError(ctx)
+		return nil, NewQueryError(err), savepoint, txErr
+	}
+	return desc, nil, nil, nil
+}
+
+// recoverFromError rolls back to the most recent savepoint after a failed query and returns its name, or returns
+// ErrTxError if there is none. Must be called while holding PoolMu.
+func (tx *Tx) recoverFromError(ctx context.Context) (*string, error) {
+	if len(tx.savepoints) == 0 {
+		return nil, ErrTxError
+	}
+
+	savepoint := tx.savepoints[len(tx.savepoints)-1]
+	zerolog.Ctx(ctx).Debug().Msgf("rolling back to savepoint %s", savepoint)
+	err := tx.rollbackToSavepoint(ctx, savepoint)
+	if err != nil {
+		zerolog.Ctx(ctx).Warn().Err(err).Msg("error rolling back to savepoint")
+		return nil, ErrTxError
+	}
+	return &savepoint, nil
+}
+
+// Savepoint creates a new savepoint in the transaction
+func (tx *Tx) Savepoint(ctx context.Context, name string) error {
+	tx.PoolMu.Lock()
+	defer tx.PoolMu.Unlock()
+
+	_, err := tx.Tx.Exec(ctx, "SAVEPOINT "+pgx.Identifier{name}.Sanitize())
+	if err != nil {
+		return fmt.Errorf("error in SAVEPOINT: %w", err)
+	}
+	tx.savepoints = append(tx.savepoints, name)
+	return nil
+}
+
+// RollbackToSavepoint rolls back the transaction to the savepoint, destroying any savepoints created after it
+func (tx *Tx) RollbackToSavepoint(ctx context.Context, name string) error {
+	tx.PoolMu.Lock()
+	defer tx.PoolMu.Unlock()
+
+	return tx.rollbackToSavepoint(ctx, name)
+}
+
+// ReleaseSavepoint destroys the savepoint and any savepoints created after it, keeping their effects
+func (tx *Tx) ReleaseSavepoint(ctx context.Context, name string) error {
+	tx.PoolMu.Lock()
+	defer tx.PoolMu.Unlock()
+
+	index := tx.savepointIndex(name)
+	if index == -1 {
+		return ErrSavepointNotFound
+	}
+
+	_, err := tx.Tx.Exec(ctx, "RELEASE SAVEPOINT "+pgx.Identifier{name}.Sanitize())
+	if err != nil {
+		return fmt.Errorf("error in RELEASE SAVEPOINT: %w", err)
+	}
+	tx.savepoints = tx.savepoints[:index]
+	return nil
+}
+
+// rollbackToSavepoint must be called while holding PoolMu
+func (tx *Tx) rollbackToSavepoint(ctx context.Context, name string) error {
+	index := tx.savepointIndex(name)
+	if index == -1 {
+		return ErrSavepointNotFound
+	}
+
+	_, err := tx.Tx.Exec(ctx, "ROLLBACK TO SAVEPOINT "+pgx.Identifier{name}.Sanitize())
+	if err != nil {
+		return fmt.Errorf("error in ROLLBACK TO SAVEPOINT: %w", err)
+	}
+	// The savepoint itself remains active
+	tx.savepoints = tx.savepoints[:index+1]
+	return nil
+}
+
+// savepointIndex returns the index of the most recent savepoint with the name, or -1 if it does not exist
+func (tx *Tx) savepointIndex(name string) int {
+	for i := len(tx.savepoints) - 1; i >= 0; i-- {
+		if tx.savepoints[i] == name {
+			return i
 		}
 	}
-	return res, nil
+	return -1
+}
+
+func (tx *Tx) recordStatement(statement string) {
+	tx.statsMu.Lock()
+	defer tx.statsMu.Unlock()
+
+	tx.statementCount++
+	tx.lastStatement = statement
+}
+
+// Info returns a snapshot of the transaction for introspection
+func (tx *Tx) Info(expires time.Time) TxInfo {
+	tx.statsMu.Lock()
+	defer tx.statsMu.Unlock()
+
+	return TxInfo{
+		TxID:           tx.ID,
+		PodID:          utils.POD_NAME,
+		Local:          true,
+		Created:        tx.Created,
+		AgeMS:          time.Since(tx.Created).Milliseconds(),
+		Expires:        expires,
+		StatementCount: utils.Ptr(tx.statementCount),
+		LastStatement:  utils.Ptr(tx.lastStatement),
+		BackendPID:     utils.Ptr(tx.BackendPID),
+		ReadOnly:       utils.Ptr(tx.ReadOnly),
+		Session:        tx.Session,
+	}
+}
+
+type queryResultFuncCtxKey struct{}
+
+// WithQueryResultFunc returns a context that has f called with the result of each query in a transaction as soon as it
+// finishes, so results can be streamed
+func WithQueryResultFunc(ctx context.Context, f func(i int, res *QueryRes)) context.Context {
+	return context.WithValue(ctx, queryResultFuncCtxKey{}, f)
+}
+
+func queryResultFunc(ctx context.Context) func(i int, res *QueryRes) {
+	f, _ := ctx.Value(queryResultFuncCtxKey{}).(func(i int, res *QueryRes))
+	return f
 }
@@ -0,0 +1,170 @@
+package pg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+)
+
+type (
+	// txIDCodec encodes the owning pod into transaction IDs, so any pod can forward to it without the coordinator
+	txIDCodec struct {
+		signKey []byte
+		// aead is set if the pod is encrypted rather than only signed
+		aead cipher.AEAD
+	}
+
+	// txIDOwner is the pod that a transaction ID was created on
+	txIDOwner struct {
+		PodName string
+		PodURL  string
+	}
+)
+
+const (
+	encodedTxIDPrefix = "tx_"
+
+	txIDModeSigned    byte = 's'
+	txIDModeEncrypted byte = 'e'
+
+	// txIDRandomLen is the random bytes in each ID that make it unique
+	txIDRandomLen = 12
+	// txIDMACLen is the length of the truncated HMAC-SHA256 for signed IDs
+	txIDMACLen = 16
+)
+
+var (
+	ErrInvalidTxID = errors.New("invalid transaction ID")
+
+	// txIDs is nil unless TX_ID_SECRET is set
+	txIDs = newTxIDCodec(utils.TX_ID_SECRET, utils.TX_ID_ENCRYPT)
+)
+
+// newTxIDCodec derives the keys from the secret, returning nil if the secret is empty
+func newTxIDCodec(secret string, encrypt bool) *txIDCodec {
+	if secret == "" {
+		return nil
+	}
+
+	codec := &txIDCodec{
+		signKey: deriveTxIDKey(secret, "sign"),
+	}
+	if encrypt {
+		block, err := aes.NewCipher(deriveTxIDKey(secret, "encrypt"))
+		if err != nil {
+			// Not possible with a 32 byte key
+			panic(fmt.Errorf("error in aes.NewCipher: %w", err))
+		}
+		codec.aead, err = cipher.NewGCM(block)
+		if err != nil {
+			panic(fmt.Errorf("error in cipher.NewGCM: %w", err))
+		}
+	}
+	return codec
+}
+
+func deriveTxIDKey(secret, purpose string) []byte {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("sqlgateway tx id " + purpose))
+	return mac.Sum(nil)
+}
+
+// isEncodedTxID returns whether the ID was created by a txIDCodec, rather than being a random ID
+func isEncodedTxID(txID string) bool {
+	return strings.HasPrefix(txID, encodedTxIDPrefix)
+}
+
+// Encode creates a new transaction ID owned by the pod
+func (codec *txIDCodec) Encode(owner txIDOwner) (string, error) {
+	if len(owner.PodName) > 255 {
+		return "", fmt.Errorf("pod name is longer than 255 bytes")
+	}
+
+	payload := make([]byte, txIDRandomLen, txIDRandomLen+1+len(owner.PodName)+len(owner.PodURL))
+	_, err := rand.Read(payload)
+	if err != nil {
+		return "", fmt.Errorf("error in rand.Read: %w", err)
+	}
+	payload = append(payload, byte(len(owner.PodName)))
+	payload = append(payload, owner.PodName...)
+	payload = append(payload, owner.PodURL...)
+
+	var body []byte
+	if codec.aead != nil {
+		nonce := make([]byte, codec.aead.NonceSize())
+		_, err = rand.Read(nonce)
+		if err != nil {
+			return "", fmt.Errorf("error in rand.Read: %w", err)
+		}
+		body = append([]byte{txIDModeEncrypted}, nonce...)
+		body = codec.aead.Seal(body, nonce, payload, []byte{txIDModeEncrypted})
+	} else {
+		body = append([]byte{txIDModeSigned}, payload...)
+		body = append(body, codec.mac(body)...)
+	}
+
+	return encodedTxIDPrefix + base64.RawURLEncoding.EncodeToString(body), nil
+}
+
+// Decode verifies the transaction ID and returns the pod that owns it, returning ErrInvalidTxID if it was not
+// created with the same secret and mode
+func (codec *txIDCodec) Decode(txID string) (*txIDOwner, error) {
+	if !isEncodedTxID(txID) {
+		return nil, ErrInvalidTxID
+	}
+	body, err := base64.RawURLEncoding.Strict().DecodeString(strings.TrimPrefix(txID, encodedTxIDPrefix))
+	if err != nil || len(body) == 0 {
+		return nil, ErrInvalidTxID
+	}
+
+	var payload []byte
+	switch {
+	case codec.aead != nil && body[0] == txIDModeEncrypted:
+		nonceSize := codec.aead.NonceSize()
+		if len(body) < 1+nonceSize {
+			return nil, ErrInvalidTxID
+		}
+		payload, err = codec.aead.Open(nil, body[1:1+nonceSize], body[1+nonceSize:], []byte{txIDModeEncrypted})
+		if err != nil {
+			return nil, ErrInvalidTxID
+		}
+	case codec.aead == nil && body[0] == txIDModeSigned:
+		if len(body) < 1+txIDMACLen {
+			return nil, ErrInvalidTxID
+		}
+		signed, mac := body[:len(body)-txIDMACLen], body[len(body)-txIDMACLen:]
+		if !hmac.Equal(mac, codec.mac(signed)) {
+			return nil, ErrInvalidTxID
+		}
+		payload = signed[1:]
+	default:
+		return nil, ErrInvalidTxID
+	}
+
+	if len(payload) < txIDRandomLen+1 {
+		return nil, ErrInvalidTxID
+	}
+	payload = payload[txIDRandomLen:]
+	podNameLen := int(payload[0])
+	if len(payload) < 1+podNameLen {
+		return nil, ErrInvalidTxID
+	}
+	return &txIDOwner{
+		PodName: string(payload[1 : 1+podNameLen]),
+		PodURL:  string(payload[1+podNameLen:]),
+	}, nil
+}
+
+func (codec *txIDCodec) mac(b []byte) []byte {
+	mac := hmac.New(sha256.New, codec.signKey)
+	mac.Write(b)
+	return mac.Sum(nil)[:txIDMACLen]
+}
@@ -0,0 +1,100 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+)
+
+func TestTxIDCodec(t *testing.T) {
+	owner := txIDOwner{
+		PodName: "sqlgateway-1",
+		PodURL:  "sqlgateway-1.default.svc.cluster.local:8080",
+	}
+
+	for _, encrypt := range []bool{false, true} {
+		codec := newTxIDCodec("secret", encrypt)
+		txID, err := codec.Encode(owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isEncodedTxID(txID) {
+			t.Fatalf("expected an encoded ID, got %s", txID)
+		}
+		if encrypt && strings.Contains(txID, "sqlgateway") {
+			t.Fatalf("expected the pod to be encrypted, got %s", txID)
+		}
+
+		decoded, err := codec.Decode(txID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *decoded != owner {
+			t.Fatalf("expected %+v, got %+v", owner, decoded)
+		}
+
+		otherID, err := codec.Encode(owner)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if otherID == txID {
+			t.Fatal("expected IDs to be unique")
+		}
+
+		// Changing any character should fail verification
+		tampered := txID[:len(txID)-1] + "A"
+		if tampered == txID {
+			tampered = txID[:len(txID)-1] + "B"
+		}
+		if _, err = codec.Decode(tampered); !errors.Is(err, ErrInvalidTxID) {
+			t.Fatalf("expected ErrInvalidTxID for a tampered ID, got %v", err)
+		}
+		if _, err = newTxIDCodec("other", encrypt).Decode(txID); !errors.Is(err, ErrInvalidTxID) {
+			t.Fatalf("expected ErrInvalidTxID for a different secret, got %v", err)
+		}
+		if _, err = newTxIDCodec("secret", !encrypt).Decode(txID); !errors.Is(err, ErrInvalidTxID) {
+			t.Fatalf("expected ErrInvalidTxID for a different mode, got %v", err)
+		}
+	}
+
+	if newTxIDCodec("", false) != nil {
+		t.Fatal("expected no codec without a secret")
+	}
+	if _, err := newTxIDCodec("secret", false).Decode(utils.GenRandomID("tx")); !errors.Is(err, ErrInvalidTxID) {
+		t.Fatalf("expected ErrInvalidTxID for a random ID, got %v", err)
+	}
+}
+
+func TestLookupRemoteTxFromID(t *testing.T) {
+	defer func(codec *txIDCodec) {
+		txIDs = codec
+	}(txIDs)
+	txIDs = newTxIDCodec("secret", false)
+
+	txID, err := txIDs.Encode(txIDOwner{PodName: "otherpod", PodURL: "otherpod:8080"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	txMeta, dErr := lookupRemoteTx(context.Background(), txID)
+	if dErr != nil {
+		t.Fatal(dErr.Err)
+	}
+	if txMeta.PodID != "otherpod" || txMeta.PodURL != "otherpod:8080" {
+		t.Fatalf("unexpected transaction meta: %+v", txMeta)
+	}
+
+	txID, err = txIDs.Encode(txIDOwner{PodName: utils.POD_NAME, PodURL: utils.GetPodURL()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, dErr = lookupRemoteTx(context.Background(), txID); dErr == nil || !errors.Is(dErr.Err, ErrTxNotFoundLocal) {
+		t.Fatalf("expected ErrTxNotFoundLocal for this pod, got %+v", dErr)
+	}
+
+	if _, dErr = lookupRemoteTx(context.Background(), "tx_invalid"); dErr == nil || !errors.Is(dErr.Err, ErrTxNotFound) {
+		t.Fatalf("expected ErrTxNotFound for an invalid ID, got %+v", dErr)
+	}
+}
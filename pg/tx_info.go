@@ -0,0 +1,158 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/coord"
+	"github.com/danthegoodman1/SQLGateway/peer"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgx/v4/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+type (
+	// TxInfo describes a transaction for introspection. Statement and connection details are only available for
+	// transactions held by the pod that lists them.
+	TxInfo struct {
+		TxID    string
+		PodID   string
+		PodURL  string `json:",omitempty"`
+		Local   bool
+		Created time.Time
+		AgeMS   int64
+		Expires time.Time
+
+		StatementCount *int64  `json:",omitempty"`
+		LastStatement  *string `json:",omitempty"`
+		BackendPID     *uint32 `json:",omitempty"`
+		ReadOnly       *bool   `json:",omitempty"`
+		// Whether the transaction is bound to a session on this pod, such as a WebSocket
+		Session bool `json:",omitempty"`
+	}
+
+	ListTxsResponse struct {
+		Transactions []TxInfo
+	}
+)
+
+// ListLocalTxs returns info on the transactions held by this pod
+func (manager *TxManager) ListLocalTxs() []TxInfo {
+	manager.txMu.Lock()
+	txs := make([]*Tx, 0, len(manager.txMap))
+	expires := make([]time.Time, 0, len(manager.txMap))
+	for _, tx := range manager.txMap {
+		txs = append(txs, tx)
+		expires = append(expires, tx.Expires)
+	}
+	manager.txMu.Unlock()
+
+	infos := make([]TxInfo, len(txs))
+	for i, tx := range txs {
+		infos[i] = tx.Info(expires[i])
+	}
+	sortTxInfos(infos)
+	return infos
+}
+
+// ListClusterTxs returns info on the transactions held by every pod in the cluster, using the local info for
+// transactions held by this pod
+func (manager *TxManager) ListClusterTxs(ctx context.Context) ([]TxInfo, error) {
+	localInfos := manager.ListLocalTxs()
+	if coord.Client == nil {
+		return localInfos, nil
+	}
+
+	txMetas, err := coord.Client.ListTransactions(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error in coord.Client.ListTransactions: %w", err)
+	}
+
+	infos := localInfos
+	localIDs := make(map[string]bool, len(localInfos))
+	for _, info := range localInfos {
+		localIDs[info.TxID] = true
+	}
+	for _, txMeta := range txMetas {
+		if localIDs[txMeta.TxID] {
+			continue
+		}
+		infos = append(infos, TxInfo{
+			TxID:    txMeta.TxID,
+			PodID:   txMeta.PodID,
+			PodURL:  txMeta.PodURL,
+			Created: txMeta.Created,
+			AgeMS:   time.Since(txMeta.Created).Milliseconds(),
+			Expires: txMeta.Expiry,
+		})
+	}
+	sortTxInfos(infos)
+	return infos, nil
+}
+
+// CancelTxQuery cancels the query currently running in the transaction with pg_cancel_backend, without rolling it back
+func (manager *TxManager) CancelTxQuery(ctx context.Context, txID string) *DistributedError {
+	tx := manager.GetTx(txID)
+	logger := zerolog.Ctx(ctx)
+	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("txID", txID)
+	})
+	logger.Debug().Msg("cancelling query")
+	if tx == nil {
+		logger.Debug().Msg("checking for remote transaction for cancel")
+
+		_, dErr := forwardTx(ctx, txID, &peer.Request{
+			Method:     http.MethodPost,
+			Path:       "/admin/transactions/" + txID + "/cancel",
+			Idempotent: true,
+		}, nil)
+		return dErr
+	}
+
+	// Use a different connection, since the transaction's connection is busy
+	err := utils.ReliableExec(ctx, PGPool, time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS), func(ctx context.Context, conn *pgxpool.Conn) error {
+		_, err := conn.Exec(ctx, "SELECT pg_cancel_backend($1)", int64(tx.BackendPID))
+		return err
+	})
+	if err != nil {
+		return &DistributedError{Err: fmt.Errorf("error in pg_cancel_backend: %w", err)}
+	}
+
+	return nil
+}
+
+// KillTx force rolls back the transaction, cancelling its running query first if there is one
+func (manager *TxManager) KillTx(ctx context.Context, txID string) *DistributedError {
+	tx := manager.GetTx(txID)
+	if tx == nil {
+		logger := zerolog.Ctx(ctx)
+		logger.Debug().Msg("checking for remote transaction for kill")
+
+		_, dErr := forwardTx(ctx, txID, &peer.Request{
+			Method: http.MethodDelete,
+			Path:   "/admin/transactions/" + txID,
+		}, nil)
+		return dErr
+	}
+
+	if tx.PoolMu.TryLock() {
+		tx.PoolMu.Unlock()
+	} else {
+		// A query is running, cancel it so that we can get the lock
+		dErr := manager.CancelTxQuery(ctx, txID)
+		if dErr != nil {
+			return dErr
+		}
+	}
+
+	return manager.RollbackTx(ctx, txID)
+}
+
+func sortTxInfos(infos []TxInfo) {
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].Created.Before(infos[j].Created)
+	})
+}
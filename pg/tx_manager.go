@@ -1,43 +1,56 @@
 package pg
 
 import (
-	"bytes"
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/danthegoodman1/SQLGateway/red"
+	"github.com/danthegoodman1/SQLGateway/coord"
+	"github.com/danthegoodman1/SQLGateway/peer"
 	"github.com/danthegoodman1/SQLGateway/utils"
-	"github.com/go-redis/redis/v9"
 	"github.com/jackc/pgx/v4"
 	"github.com/rs/zerolog"
-	"io"
 	"net/http"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type (
+	// SavepointOp is the type of savepoint operation, matching the path of the endpoint that handles it
+	SavepointOp string
+
 	TxManager struct {
 		txMu           *sync.Mutex
 		txMap          map[string]*Tx
 		tickerStopChan chan bool
 		ticker         *time.Ticker
+		// draining is set once the pod is shutting down, guarded by txMu
+		draining bool
+		// lastExpiryCheck is the unix nano time that expired transactions were last checked for, accessed atomically
+		lastExpiryCheck int64
 	}
 )
 
+const (
+	SavepointOpCreate     SavepointOp = "savepoint"
+	SavepointOpRollbackTo SavepointOp = "rollback_to"
+	SavepointOpRelease    SavepointOp = "release"
+)
+
 var (
 	ErrTxNotFound = errors.New("transaction not found")
+	ErrDraining   = errors.New("pod is draining, not accepting new transactions")
 
 	Manager *TxManager
 )
 
 func NewTxManager() *TxManager {
 	txManager := &TxManager{
-		txMu:           &sync.Mutex{},
-		txMap:          map[string]*Tx{},
-		ticker:         time.NewTicker(time.Second * 2),
-		tickerStopChan: make(chan bool, 1),
+		txMu:            &sync.Mutex{},
+		txMap:           map[string]*Tx{},
+		ticker:          time.NewTicker(time.Second * 2),
+		tickerStopChan:  make(chan bool, 1),
+		lastExpiryCheck: time.Now().UnixNano(),
 	}
 
 	go func(manager *TxManager) {
@@ -55,21 +68,82 @@ func NewTxManager() *TxManager {
 	return txManager
 }
 
-// NewTx starts a new transaction, returning the ID
-func (manager *TxManager) NewTx(ctx context.Context, timeoutSec *int64) (string, error) {
+// NewTx starts a new transaction with the options of the begin request, returning the ID
+func (manager *TxManager) NewTx(ctx context.Context, opts *BeginRequest) (string, error) {
+	return manager.newTx(ctx, opts, false)
+}
+
+// NewSessionTx starts a new transaction that is bound to a session on this pod, such as a WebSocket. It is not
+// registered with the coordinator, and it doesn't expire, so the session must roll it back when it ends.
+func (manager *TxManager) NewSessionTx(ctx context.Context, opts *BeginRequest) (string, error) {
+	return manager.newTx(ctx, opts, true)
+}
+
+func (manager *TxManager) newTx(ctx context.Context, opts *BeginRequest, session bool) (string, error) {
+	if manager.Draining() {
+		return "", ErrDraining
+	}
+
+	txOpts, err := opts.TxOptions()
+	if err != nil {
+		return "", err
+	}
+
 	txID := utils.GenRandomID("tx")
+	if txIDs != nil {
+		txID, err = txIDs.Encode(txIDOwner{
+			PodName: utils.POD_NAME,
+			PodURL:  utils.GetPodURL(),
+		})
+		if err != nil {
+			return "", fmt.Errorf("error in txIDs.Encode: %w", err)
+		}
+	}
 
-	expireTime := time.Now().Add(time.Second * time.Duration(utils.Deref(timeoutSec, 30)))
-	poolConn, err := PGPool.Acquire(ctx)
+	aostStatement, err := opts.asOfSystemTimeStatement()
+	if err != nil {
+		return "", err
+	}
+
+	timeoutSec := utils.Deref(opts.TxTimeoutSec, utils.TX_TIMEOUT_SEC)
+	if timeoutSec > utils.TX_MAX_LIFETIME_SEC {
+		timeoutSec = utils.TX_MAX_LIFETIME_SEC
+	}
+	created := time.Now()
+	expireTime := created.Add(time.Second * time.Duration(timeoutSec))
+	poolConn, err := utils.AcquireConn(ctx, PGPool)
 	if err != nil {
-		return "", fmt.Errorf("error in PGPool.Acquire: %w", err)
+		return "", fmt.Errorf("error in utils.AcquireConn: %w", err)
 	}
 
-	txCtx, cancel := context.WithTimeout(context.Background(), time.Second*30)
-	pgTx, err := poolConn.BeginTx(ctx, pgx.TxOptions{})
+	// The transaction can't outlive TX_MAX_LIFETIME_SEC, even if it is extended
+	txCtx, cancel := context.WithDeadline(context.Background(), created.Add(time.Second*time.Duration(utils.TX_MAX_LIFETIME_SEC)))
+	pgTx, err := poolConn.BeginTx(ctx, txOpts)
 	if err != nil {
 		cancel()
-		return "", fmt.Errorf("error in : %w", err)
+		poolConn.Release()
+		return "", fmt.Errorf("error in BeginTx: %w", err)
+	}
+
+	if aostStatement != "" {
+		_, err = pgTx.Exec(ctx, aostStatement)
+		if err != nil {
+			cancel()
+			_ = pgTx.Rollback(ctx)
+			poolConn.Release()
+			return "", fmt.Errorf("error setting AS OF SYSTEM TIME: %w", err)
+		}
+	}
+
+	// Pool connections already use QUERY_TIMEOUT_MS
+	if opts.TimeoutMS != nil {
+		_, err = pgTx.Exec(ctx, statementTimeoutStatement(queryTimeoutMS(opts.TimeoutMS)))
+		if err != nil {
+			cancel()
+			_ = pgTx.Rollback(ctx)
+			poolConn.Release()
+			return "", fmt.Errorf("error setting statement_timeout: %w", err)
+		}
 	}
 
 	tx := &Tx{
@@ -80,33 +154,47 @@ func (manager *TxManager) NewTx(ctx context.Context, timeoutSec *int64) (string,
 		CancelChan: make(chan bool, 1),
 		Exited:     false,
 		PoolMu:     &sync.Mutex{},
+		// TODO: Route read only transactions to replicas once replica routing exists
+		ReadOnly:   txOpts.AccessMode == pgx.ReadOnly,
+		Created:    created,
+		TimeoutSec: timeoutSec,
+		BackendPID: poolConn.Conn().PgConn().PID(),
+		Session:    session,
+		statsMu:    &sync.Mutex{},
 	}
 
-	podURL := ""
-	if utils.POD_URL != "" {
-		podURL = utils.POD_URL
-	} else {
-		podURL = utils.POD_NAME + utils.POD_BASE_DOMAIN
-	}
-
-	if red.RedisClient != nil {
-		err = red.SetTransaction(ctx, &red.TransactionMeta{
-			TxID:   txID,
-			PodID:  utils.POD_NAME,
-			Expiry: expireTime,
-			PodURL: podURL,
+	if coord.Client != nil && !session {
+		err = coord.Client.SetTransaction(ctx, &coord.TransactionMeta{
+			TxID:    txID,
+			PodID:   utils.POD_NAME,
+			Expiry:  expireTime,
+			PodURL:  utils.GetPodURL(),
+			Created: created,
 		})
 		if err != nil {
 			cancel()
-			return "", fmt.Errorf("error in red.SetTransaction: %w", err)
+			_ = pgTx.Rollback(ctx)
+			poolConn.Release()
+			return "", fmt.Errorf("error in coord.Client.SetTransaction: %w", err)
 		}
 	}
 
-	go manager.delayCancelTx(txCtx, cancel, tx.CancelChan, tx.ID)
-
 	manager.txMu.Lock()
-	defer manager.txMu.Unlock()
+	if manager.draining {
+		// Started draining while this was being created, so it would not be waited for
+		manager.txMu.Unlock()
+		cancel()
+		_ = pgTx.Rollback(ctx)
+		poolConn.Release()
+		if !session {
+			manager.deleteCoordTx(txID)
+		}
+		return "", ErrDraining
+	}
 	manager.txMap[txID] = tx
+	manager.txMu.Unlock()
+
+	go manager.delayCancelTx(txCtx, cancel, tx.CancelChan, tx.ID)
 
 	return txID, nil
 }
@@ -125,86 +213,110 @@ func (manager *TxManager) GetTx(txID string) *Tx {
 // DeleteTx fetches the transaction and removes it from the manager, also sending a signal to cancel the context
 func (manager *TxManager) DeleteTx(txID string) error {
 	manager.txMu.Lock()
-	defer manager.txMu.Unlock()
-
 	tx, exists := manager.txMap[txID]
 	if !exists {
+		manager.txMu.Unlock()
 		return nil
 	}
 
 	delete(manager.txMap, txID)
+	manager.txMu.Unlock()
 
 	tx.CancelChan <- true
 
-	// TODO: Delete from redis
+	if !tx.Session {
+		manager.deleteCoordTx(txID)
+	}
 
 	return nil
 }
 
-// RollbackTx rolls back the transaction and returns the connection to the pool
-func (manager *TxManager) RollbackTx(ctx context.Context, txID string) *DistributedError {
-	tx := manager.GetTx(txID)
-	logger := zerolog.Ctx(ctx)
-	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
-		return c.Str("txID", txID)
-	})
-	logger.Debug().Msg("rolling back")
-	if tx == nil && red.RedisClient != nil {
-		logger.Debug().Msg("checking for remote transaction for rollback")
+// deleteCoordTx removes the transaction from the coordinator so other pods do not forward to it. Failures are only logged,
+// since the key will expire anyway.
+func (manager *TxManager) deleteCoordTx(txID string) {
+	if coord.Client == nil {
+		return
+	}
 
-		// Check for remote transaction
-		txMeta, err := red.GetTransaction(ctx, txID)
-		if errors.Is(err, redis.Nil) {
-			return &DistributedError{Err: ErrTxNotFound}
-		}
-		if err != nil {
-			return &DistributedError{Err: fmt.Errorf("error in red.GetTransaction: %w", err)}
-		}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	err := coord.Client.DeleteTransaction(ctx, txID)
+	if err != nil {
+		logger.Error().Err(err).Str("txID", txID).Msg("error in coord.Client.DeleteTransaction")
+	}
+}
 
-		if txMeta.PodID == utils.POD_NAME {
-			// The only case would be if this node restarted but maintained the same name, without removing transactions from redis
-			return &DistributedError{Err: ErrTxNotFoundLocal}
-		}
+// Draining returns whether the manager has stopped accepting new transactions
+func (manager *TxManager) Draining() bool {
+	manager.txMu.Lock()
+	defer manager.txMu.Unlock()
+	return manager.draining
+}
 
-		logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
-			return c.Str("remoteURL", txMeta.PodURL)
-		})
-		logger.Debug().Msg("rolling back on remote")
+func (manager *TxManager) localTxIDs() []string {
+	manager.txMu.Lock()
+	defer manager.txMu.Unlock()
 
-		// check on remote node
-		bodyJSON, err := json.Marshal(TxIDJSON{
-			TxID: txID,
-		})
-		if err != nil {
-			return &DistributedError{Err: fmt.Errorf("error in json.Marhsal for remote request body: %w", err)}
-		}
+	txIDs := make([]string, 0, len(manager.txMap))
+	for txID := range manager.txMap {
+		txIDs = append(txIDs, txID)
+	}
+	return txIDs
+}
 
-		ctx, cancel := context.WithTimeout(ctx, time.Second*30)
-		defer cancel()
+// Drain stops new transactions from being started, and waits for the existing ones to finish until the context is
+// done. Any transactions that remain are then rolled back.
+func (manager *TxManager) Drain(ctx context.Context) {
+	manager.txMu.Lock()
+	manager.draining = true
+	manager.txMu.Unlock()
 
-		req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s://%s/psql/rollback", utils.GetHTTPPrefix(), txMeta.PodURL), bytes.NewReader(bodyJSON))
-		if err != nil {
-			return &DistributedError{Err: fmt.Errorf("error making http request for remote pod: %w", err)}
-		}
-		req.Header.Set("content-type", "application/json")
+	ticker := time.NewTicker(time.Millisecond * 100)
+	defer ticker.Stop()
 
-		res, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return &DistributedError{Err: fmt.Errorf("error doing request to remote pod: %w", err)}
+	txIDs := manager.localTxIDs()
+	for len(txIDs) > 0 && ctx.Err() == nil {
+		select {
+		case <-ticker.C:
+			txIDs = manager.localTxIDs()
+		case <-ctx.Done():
 		}
+	}
+	if len(txIDs) == 0 {
+		logger.Info().Msg("all transactions finished")
+		return
+	}
 
-		resBodyBytes, err := io.ReadAll(res.Body)
+	logger.Warn().Msgf("rolling back %d transactions that did not finish while draining", len(txIDs))
+	for _, txID := range txIDs {
+		rollbackCtx, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+		err := manager.RollbackTx(rollbackCtx, txID)
+		cancel()
 		if err != nil {
-			return &DistributedError{Err: fmt.Errorf("error reading body bytes from remote pod response: %w", err)}
+			logger.Error().Err(err.Err).Msgf("error rolling back transaction %s", txID)
 		}
+	}
+}
 
-		if res.StatusCode != 200 {
-			return &DistributedError{Remote: true, StatusCode: res.StatusCode, ErrString: string(resBodyBytes)}
-		}
+// RollbackTx rolls back the transaction and returns the connection to the pool
+func (manager *TxManager) RollbackTx(ctx context.Context, txID string) *DistributedError {
+	tx := manager.GetTx(txID)
+	logger := zerolog.Ctx(ctx)
+	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("txID", txID)
+	})
+	logger.Debug().Msg("rolling back")
+	if tx == nil {
+		logger.Debug().Msg("checking for remote transaction for rollback")
 
-		return nil
-	} else if tx == nil {
-		return &DistributedError{Err: ErrTxNotFound}
+		_, dErr := forwardTx(ctx, txID, &peer.Request{
+			Method: http.MethodPost,
+			Path:   "/psql/rollback",
+			Body: TxIDJSON{
+				TxID: txID,
+			},
+		}, nil)
+		return dErr
 	}
 
 	tx.PoolMu.Lock()
@@ -233,77 +345,130 @@ func (manager *TxManager) CommitTx(ctx context.Context, txID string) *Distribute
 		return c.Str("txID", txID)
 	})
 	logger.Debug().Msg("committing")
-	if tx == nil && red.RedisClient != nil {
+	if tx == nil {
 		logger.Debug().Msg("checking for remote transaction for commit")
 
-		// Check for remote transaction
-		txMeta, err := red.GetTransaction(ctx, txID)
-		if errors.Is(err, redis.Nil) {
-			return &DistributedError{Err: ErrTxNotFound}
-		}
-		if err != nil {
-			return &DistributedError{Err: fmt.Errorf("error in red.GetTransaction: %w", err)}
-		}
+		_, dErr := forwardTx(ctx, txID, &peer.Request{
+			Method: http.MethodPost,
+			Path:   "/psql/commit",
+			Body: TxIDJSON{
+				TxID: txID,
+			},
+		}, nil)
+		return dErr
+	}
 
-		if txMeta.PodID == utils.POD_NAME {
-			// The only case would be if this node restarted but maintained the same name, without removing transactions from redis
-			return &DistributedError{Err: ErrTxNotFoundLocal}
-		}
+	tx.PoolMu.Lock()
+	defer tx.PoolMu.Unlock()
 
-		logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
-			return c.Str("remoteURL", txMeta.PodURL)
-		})
-		logger.Debug().Msg("committing on remote")
+	err := tx.Tx.Commit(ctx)
+	defer tx.PoolConn.Release()
 
-		// check on remote node
-		bodyJSON, err := json.Marshal(TxIDJSON{
-			TxID: txID,
-		})
-		if err != nil {
-			return &DistributedError{Err: fmt.Errorf("error in json.Marhsal for remote request body: %w", err)}
-		}
+	if err != nil {
+		return &DistributedError{Err: fmt.Errorf("error in Tx.Commit: %w", err)}
+	}
 
-		ctx, cancel := context.WithTimeout(ctx, time.Second*30)
-		defer cancel()
+	err = manager.DeleteTx(txID)
+	if err != nil {
+		return &DistributedError{Err: fmt.Errorf("error in manager.DeleteTx: %w", err)}
+	}
 
-		req, err := http.NewRequestWithContext(ctx, "POST", fmt.Sprintf("%s://%s/psql/commit", utils.GetHTTPPrefix(), txMeta.PodURL), bytes.NewReader(bodyJSON))
-		if err != nil {
-			return &DistributedError{Err: fmt.Errorf("error making http request for remote pod: %w", err)}
-		}
-		req.Header.Set("content-type", "application/json")
+	return nil
+}
 
-		res, err := http.DefaultClient.Do(req)
-		if err != nil {
-			return &DistributedError{Err: fmt.Errorf("error doing request to remote pod: %w", err)}
-		}
+// ExtendTx pushes back the expiry of the transaction by timeoutSec from now, or by the timeout it was started with if nil.
+// The expiry is capped at TX_MAX_LIFETIME_SEC after the transaction started.
+func (manager *TxManager) ExtendTx(ctx context.Context, txID string, timeoutSec *int64) (time.Time, *DistributedError) {
+	tx := manager.GetTx(txID)
+	logger := zerolog.Ctx(ctx)
+	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("txID", txID)
+	})
+	logger.Debug().Msg("extending")
+	if tx == nil {
+		logger.Debug().Msg("checking for remote transaction for extend")
+
+		var res ExtendResponse
+		_, dErr := forwardTx(ctx, txID, &peer.Request{
+			Method: http.MethodPost,
+			Path:   "/psql/extend",
+			Body: ExtendRequest{
+				TxID:         txID,
+				TxTimeoutSec: timeoutSec,
+			},
+			Idempotent: true,
+		}, &res)
+		return res.Expires, dErr
+	}
 
-		resBodyBytes, err := io.ReadAll(res.Body)
-		if err != nil {
-			return &DistributedError{Err: fmt.Errorf("error reading body bytes from remote pod response: %w", err)}
-		}
+	return manager.extendLocalTx(ctx, tx, timeoutSec)
+}
 
-		if res.StatusCode != 200 {
-			return &DistributedError{Remote: true, StatusCode: res.StatusCode, ErrString: string(resBodyBytes)}
-		}
+func (manager *TxManager) extendLocalTx(ctx context.Context, tx *Tx, timeoutSec *int64) (time.Time, *DistributedError) {
+	expires := time.Now().Add(time.Second * time.Duration(utils.Deref(timeoutSec, tx.TimeoutSec)))
+	maxExpires := tx.Created.Add(time.Second * time.Duration(utils.TX_MAX_LIFETIME_SEC))
+	if expires.After(maxExpires) {
+		expires = maxExpires
+	}
 
-		return nil
-	} else if tx == nil {
-		return &DistributedError{Err: ErrTxNotFound}
+	manager.txMu.Lock()
+	if _, exists := manager.txMap[tx.ID]; !exists {
+		// It was rolled back in the meantime
+		manager.txMu.Unlock()
+		return time.Time{}, &DistributedError{Err: ErrTxNotFound}
 	}
+	if expires.Before(tx.Expires) {
+		// Never shorten the expiry
+		expires = tx.Expires
+	}
+	tx.Expires = expires
+	manager.txMu.Unlock()
 
-	tx.PoolMu.Lock()
-	defer tx.PoolMu.Unlock()
+	if coord.Client != nil && !tx.Session {
+		err := coord.Client.ExtendTransaction(ctx, tx.ID, expires)
+		if err != nil {
+			return time.Time{}, &DistributedError{Err: fmt.Errorf("error in coord.Client.ExtendTransaction: %w", err)}
+		}
+	}
 
-	err := tx.Tx.Commit(ctx)
-	defer tx.PoolConn.Release()
+	return expires, nil
+}
 
-	if err != nil {
-		return &DistributedError{Err: fmt.Errorf("error in Tx.Commit: %w", err)}
+// SavepointTx creates, rolls back to, or releases a savepoint in the transaction
+func (manager *TxManager) SavepointTx(ctx context.Context, txID, name string, op SavepointOp) *DistributedError {
+	tx := manager.GetTx(txID)
+	logger := zerolog.Ctx(ctx)
+	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("txID", txID).Str("savepoint", name).Str("savepointOp", string(op))
+	})
+	logger.Debug().Msg("handling savepoint")
+	if tx == nil {
+		logger.Debug().Msg("checking for remote transaction for savepoint")
+
+		_, dErr := forwardTx(ctx, txID, &peer.Request{
+			Method: http.MethodPost,
+			Path:   "/psql/" + string(op),
+			Body: SavepointRequest{
+				TxID: txID,
+				Name: name,
+			},
+		}, nil)
+		return dErr
 	}
 
-	err = manager.DeleteTx(txID)
+	var err error
+	switch op {
+	case SavepointOpCreate:
+		err = tx.Savepoint(ctx, name)
+	case SavepointOpRollbackTo:
+		err = tx.RollbackToSavepoint(ctx, name)
+	case SavepointOpRelease:
+		err = tx.ReleaseSavepoint(ctx, name)
+	default:
+		err = fmt.Errorf("unknown savepoint op %s", op)
+	}
 	if err != nil {
-		return &DistributedError{Err: fmt.Errorf("error in manager.DeleteTx: %w", err)}
+		return &DistributedError{Err: fmt.Errorf("error handling savepoint: %w", err)}
 	}
 
 	return nil
@@ -327,11 +492,13 @@ func (manager *TxManager) handleExpiredTransactions() {
 	expiredTXIDs := make([]string, 0)
 	manager.txMu.Lock()
 	for id, tx := range manager.txMap {
-		if tx.Expires.Before(expireTime) {
+		// Session transactions live as long as their session, however long it's idle
+		if !tx.Session && tx.Expires.Before(expireTime) {
 			expiredTXIDs = append(expiredTXIDs, id)
 		}
 	}
 	manager.txMu.Unlock()
+	atomic.StoreInt64(&manager.lastExpiryCheck, expireTime.UnixNano())
 
 	if len(expiredTXIDs) == 0 {
 		logger.Debug().Msg("found no expired transactions")
@@ -354,6 +521,5 @@ func (manager *TxManager) handleExpiredTransactions() {
 
 func (manager *TxManager) Shutdown() {
 	manager.tickerStopChan <- true
-	// We do wait for all HTTP requests to end before doing this
-	// TODO: Remove all transactions from redis in case this gets the same name
+	// Drain has already rolled back the transactions, which removes them from the coordinator
 }
@@ -0,0 +1,67 @@
+package pg
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestDrainRejectsNewTx(t *testing.T) {
+	manager := NewTxManager()
+	defer manager.Shutdown()
+
+	// No transactions, so this returns immediately
+	manager.Drain(context.Background())
+	if !manager.Draining() {
+		t.Fatal("expected manager to be draining")
+	}
+
+	_, err := manager.NewTx(context.Background(), &BeginRequest{})
+	if !errors.Is(err, ErrDraining) {
+		t.Fatalf("expected ErrDraining, got %v", err)
+	}
+}
+
+func TestCheckLiveness(t *testing.T) {
+	manager := NewTxManager()
+	defer manager.Shutdown()
+
+	if err := manager.CheckLiveness(); err != nil {
+		t.Fatal(err)
+	}
+
+	manager.txMap["tx_stuck"] = &Tx{
+		ID:      "tx_stuck",
+		Expires: time.Now().Add(-time.Hour),
+	}
+	if err := manager.CheckLiveness(); !errors.Is(err, ErrTxStuck) {
+		t.Fatalf("expected ErrTxStuck, got %v", err)
+	}
+	delete(manager.txMap, "tx_stuck")
+
+	atomic.StoreInt64(&manager.lastExpiryCheck, time.Now().Add(-time.Minute).UnixNano())
+	if err := manager.CheckLiveness(); !errors.Is(err, ErrExpiryCheckStale) {
+		t.Fatalf("expected ErrExpiryCheckStale, got %v", err)
+	}
+}
+
+func TestSessionTxNeverExpires(t *testing.T) {
+	manager := NewTxManager()
+	defer manager.Shutdown()
+
+	// Like a psql client that ran BEGIN and has been idle ever since
+	manager.txMap["tx_idle"] = &Tx{
+		ID:      "tx_idle",
+		Expires: time.Now().Add(-time.Hour),
+		Session: true,
+	}
+	manager.handleExpiredTransactions()
+	if manager.GetTx("tx_idle") == nil {
+		t.Fatal("expected the session transaction to not be expired")
+	}
+	if err := manager.CheckLiveness(); err != nil {
+		t.Fatalf("expected an idle session transaction to not be stuck, got %v", err)
+	}
+}
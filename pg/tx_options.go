@@ -0,0 +1,58 @@
+package pg
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgx/v4"
+)
+
+var (
+	ErrInvalidTxOptions = errors.New("invalid transaction options")
+
+	// Intervals (-10s), timestamps, and decimal HLC timestamps
+	asOfSystemTimeRegex = regexp.MustCompile(`^[0-9A-Za-z:.+\- ]+$`)
+)
+
+const followerReadTimestamp = "follower_read_timestamp()"
+
+// TxOptions builds the options that the transaction is started with
+func (req *BeginRequest) TxOptions() (pgx.TxOptions, error) {
+	opts := pgx.TxOptions{
+		IsoLevel:       pgx.TxIsoLevel(utils.Deref(req.IsoLevel, "")),
+		AccessMode:     pgx.TxAccessMode(utils.Deref(req.AccessMode, "")),
+		DeferrableMode: pgx.TxDeferrableMode(utils.Deref(req.DeferrableMode, "")),
+	}
+
+	if req.AsOfSystemTime != nil {
+		if opts.AccessMode == pgx.ReadWrite {
+			return opts, fmt.Errorf("%w: AsOfSystemTime requires a read only transaction", ErrInvalidTxOptions)
+		}
+		opts.AccessMode = pgx.ReadOnly
+	}
+
+	return opts, nil
+}
+
+// asOfSystemTimeStatement returns the statement that sets AS OF SYSTEM TIME for the transaction, or an empty string
+func (req *BeginRequest) asOfSystemTimeStatement() (string, error) {
+	if req.AsOfSystemTime == nil {
+		return "", nil
+	}
+
+	aost := *req.AsOfSystemTime
+	if aost == followerReadTimestamp {
+		return "SET TRANSACTION AS OF SYSTEM TIME " + followerReadTimestamp, nil
+	}
+	if !asOfSystemTimeRegex.MatchString(aost) {
+		return "", fmt.Errorf("%w: AsOfSystemTime must be %s, an interval, or a timestamp", ErrInvalidTxOptions, followerReadTimestamp)
+	}
+	return fmt.Sprintf("SET TRANSACTION AS OF SYSTEM TIME '%s'", aost), nil
+}
+
+// statementTimeoutStatement returns the statement that sets the statement_timeout for the rest of the transaction
+func statementTimeoutStatement(timeoutMS int64) string {
+	return fmt.Sprintf("SET LOCAL statement_timeout = %d", timeoutMS)
+}
@@ -0,0 +1,44 @@
+package pg
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgx/v4"
+)
+
+func TestBeginRequestTxOptions(t *testing.T) {
+	req := &BeginRequest{
+		IsoLevel:       utils.Ptr("serializable"),
+		AsOfSystemTime: utils.Ptr(followerReadTimestamp),
+	}
+	opts, err := req.TxOptions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if opts.IsoLevel != pgx.Serializable || opts.AccessMode != pgx.ReadOnly {
+		t.Fatalf("unexpected options: %+v", opts)
+	}
+
+	req.AccessMode = utils.Ptr("read write")
+	_, err = req.TxOptions()
+	if !errors.Is(err, ErrInvalidTxOptions) {
+		t.Fatalf("expected ErrInvalidTxOptions, got %v", err)
+	}
+}
+
+func TestAsOfSystemTimeStatement(t *testing.T) {
+	stmt, err := (&BeginRequest{AsOfSystemTime: utils.Ptr("-10s")}).asOfSystemTimeStatement()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stmt != "SET TRANSACTION AS OF SYSTEM TIME '-10s'" {
+		t.Fatalf("unexpected statement: %s", stmt)
+	}
+
+	_, err = (&BeginRequest{AsOfSystemTime: utils.Ptr("'; DROP TABLE users; --")}).asOfSystemTimeStatement()
+	if !errors.Is(err, ErrInvalidTxOptions) {
+		t.Fatalf("expected ErrInvalidTxOptions, got %v", err)
+	}
+}
@@ -2,25 +2,25 @@ package pg
 
 import (
 	"context"
-	"github.com/danthegoodman1/SQLGateway/red"
+	"github.com/danthegoodman1/SQLGateway/coord"
 	"testing"
 	"time"
 )
 
 func TestTransactionStorage(t *testing.T) {
-	txMeta := &red.TransactionMeta{
+	txMeta := &coord.TransactionMeta{
 		TxID:   "test",
 		PodID:  "testpod",
 		Expiry: time.Now().Add(time.Second * 10),
 		PodURL: "localhost:8080",
 	}
 
-	err := red.SetTransaction(context.Background(), txMeta)
+	err := coord.Client.SetTransaction(context.Background(), txMeta)
 	if err != nil {
 		t.Fatal(err)
 	}
 
-	txBack, err := red.GetTransaction(context.Background(), txMeta.TxID)
+	txBack, err := coord.Client.GetTransaction(context.Background(), txMeta.TxID)
 	if err != nil {
 		t.Fatal(err)
 	}
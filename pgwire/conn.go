@@ -0,0 +1,372 @@
+package pgwire
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/gologger"
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/google/uuid"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/rs/zerolog"
+)
+
+type (
+	// conn is a client connection. Messages are handled one at a time, like a Postgres backend.
+	conn struct {
+		server  *Server
+		netConn net.Conn
+		reader  *readAheadConn
+		backend *pgproto3.Backend
+		w       *bufio.Writer
+		// Cancelled when the client disconnects
+		ctx       context.Context
+		cancelCtx context.CancelFunc
+		tls       bool
+
+		processID uint32
+		secretKey uint32
+
+		// The session transaction, if one is open
+		txID string
+		// Whether the transaction was rolled back by a failed query, and is waiting for the client to end it
+		txFailed bool
+
+		statements map[string]*preparedStatement
+		portals    map[string]*portal
+		// Whether an extended query message failed, so messages are skipped until the next sync
+		extendedErr bool
+
+		cancelMu    *sync.Mutex
+		cancelQuery func(ctx context.Context) *pg.DistributedError
+	}
+)
+
+const (
+	// The transaction status indicators sent with ReadyForQuery
+	txStatusIdle   = 'I'
+	txStatusInTx   = 'T'
+	txStatusFailed = 'E'
+
+	// readAheadLimit is the most that is buffered from a client while a query runs
+	readAheadLimit = 4 << 20
+)
+
+func (s *Server) serve(netConn net.Conn) {
+	defer netConn.Close()
+
+	reqID := uuid.NewString()
+	l := logger.With().Str(string(gologger.ReqIDKey), reqID).Str("remote_addr", netConn.RemoteAddr().String()).Logger()
+	ctx, cancel := context.WithCancel(context.WithValue(l.WithContext(context.Background()), gologger.ReqIDKey, reqID))
+	defer cancel()
+
+	c := &conn{
+		server:     s,
+		ctx:        ctx,
+		cancelCtx:  cancel,
+		statements: map[string]*preparedStatement{},
+		portals:    map[string]*portal{},
+		cancelMu:   &sync.Mutex{},
+	}
+	c.setNetConn(netConn)
+
+	// Clients have to finish starting up in time
+	netConn.SetDeadline(time.Now().Add(time.Millisecond * time.Duration(utils.REQUEST_TIMEOUT_MS)))
+	if !c.startup() {
+		return
+	}
+	netConn.SetDeadline(time.Time{})
+	defer s.unregister(c)
+	if s.isClosing() {
+		c.sendFatal(codeAdminShutdown, "terminating connection due to administrator command")
+		return
+	}
+
+	c.run()
+	c.close()
+}
+
+// startup handles the startup messages and authenticates the client, returning whether it is ready for queries
+func (c *conn) startup() bool {
+	logger := zerolog.Ctx(c.ctx)
+	for {
+		msg, err := c.backend.ReceiveStartupMessage()
+		if err != nil {
+			logger.Debug().Err(err).Msg("error receiving pgwire startup message")
+			return false
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.SSLRequest:
+			if c.server.tlsConfig == nil || c.tls {
+				if _, err := c.netConn.Write([]byte{'N'}); err != nil {
+					return false
+				}
+				break
+			}
+			if _, err := c.netConn.Write([]byte{'S'}); err != nil {
+				return false
+			}
+			tlsConn := tls.Server(c.netConn, c.server.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				logger.Debug().Err(err).Msg("error in pgwire TLS handshake")
+				return false
+			}
+			c.setNetConn(tlsConn)
+			c.tls = true
+		case *pgproto3.GSSEncRequest:
+			// GSSAPI encryption is not supported, clients can continue without it
+			if _, err := c.netConn.Write([]byte{'N'}); err != nil {
+				return false
+			}
+		case *pgproto3.CancelRequest:
+			c.server.cancel(msg.ProcessID, msg.SecretKey)
+			return false
+		case *pgproto3.StartupMessage:
+			return c.authenticate(msg)
+		}
+	}
+}
+
+func (c *conn) authenticate(msg *pgproto3.StartupMessage) bool {
+	user := msg.Parameters["user"]
+	logger := zerolog.Ctx(c.ctx)
+	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+		return c.Str("user", user)
+	})
+
+	if utils.AUTH_USER != "" && utils.AUTH_PASS != "" {
+		// The password is never sent, so it's safe without TLS
+		ok, err := c.authenticateSCRAM(utils.AUTH_PASS)
+		if errors.Is(err, errInvalidSCRAM) {
+			c.sendFatal(codeProtocolViolation, err.Error())
+			return false
+		}
+		if err != nil {
+			logger.Debug().Err(err).Msg("error in pgwire SCRAM authentication")
+			return false
+		}
+		if !ok || subtle.ConstantTimeCompare([]byte(user), []byte(utils.AUTH_USER)) != 1 {
+			logger.Warn().Msg("pgwire password authentication failed")
+			c.sendFatal(codeInvalidPassword, fmt.Sprintf("password authentication failed for user %q", user))
+			return false
+		}
+	}
+
+	if err := c.server.register(c); err != nil {
+		logger.Error().Err(err).Msg("error registering pgwire connection")
+		c.sendFatal(codeInternal, "internal error")
+		return false
+	}
+
+	c.send(&pgproto3.AuthenticationOk{})
+	for name, value := range c.server.params {
+		c.send(&pgproto3.ParameterStatus{Name: name, Value: value})
+	}
+	if appName := msg.Parameters["application_name"]; appName != "" {
+		c.send(&pgproto3.ParameterStatus{Name: "application_name", Value: appName})
+	}
+	c.send(&pgproto3.BackendKeyData{ProcessID: c.processID, SecretKey: c.secretKey})
+	logger.Debug().Msg("pgwire connection started")
+	return c.readyForQuery() == nil
+}
+
+// run handles messages until the client terminates or the connection breaks
+func (c *conn) run() {
+	logger := zerolog.Ctx(c.ctx)
+	for {
+		msg, err := c.backend.Receive()
+		if err != nil {
+			if c.server.isClosing() {
+				c.sendFatal(codeAdminShutdown, "terminating connection due to administrator command")
+			} else if !errors.Is(err, io.ErrUnexpectedEOF) {
+				logger.Debug().Err(err).Msg("error receiving pgwire message")
+			}
+			return
+		}
+
+		if c.extendedErr {
+			if _, ok := msg.(*pgproto3.Sync); !ok {
+				continue
+			}
+		}
+
+		switch msg := msg.(type) {
+		case *pgproto3.Query:
+			c.simpleQuery(msg.String)
+			err = c.readyForQuery()
+		case *pgproto3.Parse:
+			c.parse(msg)
+		case *pgproto3.Bind:
+			c.bind(msg)
+		case *pgproto3.Describe:
+			c.describe(msg)
+		case *pgproto3.Execute:
+			c.execute(msg)
+		case *pgproto3.Close:
+			c.closeObject(msg)
+		case *pgproto3.Sync:
+			c.extendedErr = false
+			err = c.readyForQuery()
+		case *pgproto3.Flush:
+			err = c.flush()
+		case *pgproto3.Terminate:
+			return
+		default:
+			c.extendedError(codeFeatureNotSupported, fmt.Sprintf("unsupported message type %T", msg))
+		}
+		if err != nil {
+			logger.Debug().Err(err).Msg("error sending pgwire messages")
+			return
+		}
+	}
+}
+
+// close rolls back the transaction if one is still open
+func (c *conn) close() {
+	if c.txID == "" {
+		return
+	}
+	logger := zerolog.Ctx(c.ctx)
+	logger.Debug().Str("txID", c.txID).Msg("pgwire connection closed, rolling back session transaction")
+	// c.ctx is cancelled if the client disconnected
+	ctx, cancel := context.WithTimeout(logger.WithContext(context.Background()), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+	if err := pg.Manager.RollbackTx(ctx, c.txID); err != nil && !errors.Is(err.Err, pg.ErrTxNotFound) {
+		logger.Error().Err(err.Err).Str("txID", c.txID).Msg("error rolling back session transaction")
+	}
+}
+
+// cancel cancels the running query, if there is one
+func (c *conn) cancel() {
+	c.cancelMu.Lock()
+	cancelQuery := c.cancelQuery
+	c.cancelMu.Unlock()
+	if cancelQuery == nil {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(c.ctx, time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+	if err := cancelQuery(ctx); err != nil {
+		zerolog.Ctx(c.ctx).Error().Err(err.Err).Msg("error cancelling pgwire query")
+	}
+}
+
+func (c *conn) setCancel(cancelQuery func(ctx context.Context) *pg.DistributedError) {
+	c.cancelMu.Lock()
+	defer c.cancelMu.Unlock()
+	c.cancelQuery = cancelQuery
+}
+
+// setNetConn sets the connection messages are read from and written to
+func (c *conn) setNetConn(netConn net.Conn) {
+	c.netConn = netConn
+	c.reader = &readAheadConn{Conn: netConn}
+	c.w = bufio.NewWriter(netConn)
+	c.backend = pgproto3.NewBackend(pgproto3.NewChunkReader(c.reader), c.w)
+}
+
+// watchDisconnect cancels c.ctx if the client disconnects before the returned stop function is called. Messages are
+// not read while a query runs, so a closed connection wouldn't be noticed until it finished.
+func (c *conn) watchDisconnect() (stop func()) {
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := c.reader.readAhead(); err != nil && !errors.Is(err, os.ErrDeadlineExceeded) {
+			zerolog.Ctx(c.ctx).Debug().Err(err).Msg("pgwire client disconnected while running a query")
+			c.cancelCtx()
+		}
+	}()
+	return func() {
+		c.netConn.SetReadDeadline(time.Now())
+		<-done
+		c.netConn.SetReadDeadline(time.Time{})
+		if c.server.isClosing() {
+			// Shutdown may have woken up the connection while it was watched
+			c.netConn.SetReadDeadline(time.Now())
+		}
+	}
+}
+
+func (c *conn) txStatus() byte {
+	switch {
+	case c.txFailed:
+		return txStatusFailed
+	case c.txID != "":
+		return txStatusInTx
+	default:
+		return txStatusIdle
+	}
+}
+
+// checkTx marks the transaction as failed if it was rolled back by the TxManager, because a query failed or it expired
+func (c *conn) checkTx() {
+	if c.txID != "" && pg.Manager.GetTx(c.txID) == nil {
+		c.txID = ""
+		c.txFailed = true
+	}
+}
+
+func (c *conn) readyForQuery() error {
+	c.send(&pgproto3.ReadyForQuery{TxStatus: c.txStatus()})
+	return c.flush()
+}
+
+// send buffers the message, write errors are returned by the next flush
+func (c *conn) send(msg pgproto3.BackendMessage) {
+	c.backend.Send(msg)
+}
+
+func (c *conn) flush() error {
+	return c.w.Flush()
+}
+
+func (c *conn) sendFatal(code, msg string) {
+	c.send(&pgproto3.ErrorResponse{Severity: "FATAL", Code: code, Message: msg})
+	c.flush()
+}
+
+// readAheadConn keeps what was read from the connection while watching for a disconnect, so the next messages are not
+// lost
+type readAheadConn struct {
+	net.Conn
+	buf []byte
+}
+
+func (r *readAheadConn) Read(p []byte) (int, error) {
+	if len(r.buf) > 0 {
+		n := copy(p, r.buf)
+		r.buf = r.buf[n:]
+		return n, nil
+	}
+	return r.Conn.Read(p)
+}
+
+// readAhead buffers what the client sends until the connection errors, or the read deadline is exceeded. It stops
+// once readAheadLimit is buffered, leaving the rest to TCP backpressure, so a disconnect is no longer noticed.
+func (r *readAheadConn) readAhead() error {
+	chunk := make([]byte, 4096)
+	for len(r.buf) < readAheadLimit {
+		size := len(chunk)
+		if left := readAheadLimit - len(r.buf); left < size {
+			size = left
+		}
+		n, err := r.Conn.Read(chunk[:size])
+		r.buf = append(r.buf, chunk[:n]...)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
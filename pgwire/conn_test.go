@@ -0,0 +1,189 @@
+package pgwire
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgconn"
+)
+
+func startTestServer(t *testing.T, tlsConfig *tls.Config) (*Server, string) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := NewServer(listener, map[string]string{"server_version": "13.0", "client_encoding": "UTF8"}, tlsConfig)
+	go s.accept()
+	return s, listener.Addr().String()
+}
+
+func TestConnStartupAndTxStatements(t *testing.T) {
+	defer func(user, pass string) {
+		utils.AUTH_USER, utils.AUTH_PASS = user, pass
+	}(utils.AUTH_USER, utils.AUTH_PASS)
+	utils.AUTH_USER, utils.AUTH_PASS = "gateway", "secret"
+
+	s, addr := startTestServer(t, nil)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+
+	_, err := pgconn.Connect(ctx, fmt.Sprintf("postgres://gateway:wrong@%s/db?sslmode=prefer", addr))
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != codeInvalidPassword {
+		t.Fatalf("expected invalid password error, got %v", err)
+	}
+
+	var notices []*pgconn.Notice
+	config, err := pgconn.ParseConfig(fmt.Sprintf("postgres://gateway:secret@%s/db?sslmode=prefer", addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	config.OnNotice = func(_ *pgconn.PgConn, notice *pgconn.Notice) {
+		notices = append(notices, notice)
+	}
+	conn, err := pgconn.ConnectConfig(ctx, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if conn.ParameterStatus("server_version") != "13.0" || conn.PID() == 0 {
+		t.Fatalf("expected server params and backend key data, got %q %d", conn.ParameterStatus("server_version"), conn.PID())
+	}
+
+	// These don't need the database
+	results, err := conn.Exec(ctx, "; -- nothing").ReadAll()
+	if err != nil || len(results) != 0 {
+		t.Fatalf("expected an empty query, got %+v %v", results, err)
+	}
+
+	results, err = conn.Exec(ctx, "COMMIT").ReadAll()
+	if err != nil || len(results) != 1 || results[0].CommandTag.String() != "COMMIT" {
+		t.Fatalf("expected COMMIT, got %+v %v", results, err)
+	}
+	if len(notices) != 1 || notices[0].Code != codeNoActiveTx {
+		t.Fatalf("expected a no transaction notice, got %+v", notices)
+	}
+	if conn.TxStatus() != txStatusIdle {
+		t.Fatalf("expected idle, got %c", conn.TxStatus())
+	}
+
+	_, err = conn.Exec(ctx, "SAVEPOINT sp1").ReadAll()
+	if !errors.As(err, &pgErr) || pgErr.Code != codeNoActiveTx {
+		t.Fatalf("expected no transaction error, got %v", err)
+	}
+
+	// The extended protocol skips to the sync after an error
+	result := conn.ExecParams(ctx, "RELEASE sp1", nil, nil, nil, nil).Read()
+	if !errors.As(result.Err, &pgErr) || pgErr.Code != codeNoActiveTx {
+		t.Fatalf("expected no transaction error, got %v", result.Err)
+	}
+	if _, err := conn.Exec(ctx, "ROLLBACK").ReadAll(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Shutting down terminates idle connections
+	shutdownCtx, shutdownCancel := context.WithTimeout(ctx, time.Second*5)
+	defer shutdownCancel()
+	if err := s.Shutdown(shutdownCtx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conn.Exec(ctx, "COMMIT").ReadAll(); err == nil {
+		t.Fatal("expected the connection to be closed")
+	}
+}
+
+func TestConnTLS(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{SerialNumber: big.NewInt(1), NotAfter: time.Now().Add(time.Hour)}
+	cert, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, addr := startTestServer(t, &tls.Config{Certificates: []tls.Certificate{{Certificate: [][]byte{cert}, PrivateKey: key}}})
+	defer s.Shutdown(context.Background())
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	conn, err := pgconn.Connect(ctx, fmt.Sprintf("postgres://gateway@%s/db?sslmode=require", addr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close(ctx)
+	if _, ok := conn.Conn().(*tls.Conn); !ok {
+		t.Fatalf("expected a TLS connection, got %T", conn.Conn())
+	}
+	if _, err := conn.Exec(ctx, "COMMIT").ReadAll(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestWatchDisconnect(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	c := &conn{server: &Server{closing: make(chan struct{})}, ctx: ctx, cancelCtx: cancel}
+	c.setNetConn(server)
+
+	// Messages sent while watching are kept
+	stop := c.watchDisconnect()
+	if _, err := client.Write([]byte("sync")); err != nil {
+		t.Fatal(err)
+	}
+	stop()
+	if ctx.Err() != nil {
+		t.Fatal("expected the context to not be cancelled")
+	}
+	buf := make([]byte, 4)
+	if _, err := c.reader.Read(buf); err != nil || string(buf) != "sync" {
+		t.Fatalf("expected the buffered message, got %q %v", buf, err)
+	}
+
+	stop = c.watchDisconnect()
+	client.Close()
+	<-ctx.Done()
+	stop()
+}
+
+func TestReadAheadLimit(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	defer client.Close()
+	r := &readAheadConn{Conn: server}
+
+	// A client that keeps sending isn't buffered past the limit
+	sent := make(chan error, 1)
+	go func() {
+		_, err := client.Write(make([]byte, readAheadLimit+4096))
+		sent <- err
+	}()
+	if err := r.readAhead(); err != nil || len(r.buf) != readAheadLimit {
+		t.Fatalf("expected %d bytes buffered, got %d %v", readAheadLimit, len(r.buf), err)
+	}
+	select {
+	case <-sent:
+		t.Fatal("expected the rest to not be read")
+	default:
+	}
+
+	n, err := io.ReadFull(r, make([]byte, readAheadLimit+4096))
+	if err != nil || n != readAheadLimit+4096 {
+		t.Fatalf("expected everything to be read, got %d %v", n, err)
+	}
+	if err := <-sent; err != nil {
+		t.Fatal(err)
+	}
+}
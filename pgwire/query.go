@@ -0,0 +1,501 @@
+package pgwire
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/jackc/pgproto3/v2"
+	"github.com/jackc/pgtype"
+	"github.com/jackc/pgx/v4"
+	"github.com/rs/zerolog"
+)
+
+type (
+	preparedStatement struct {
+		stmt      *statement
+		paramOIDs []uint32
+		fields    []pgproto3.FieldDescription
+	}
+
+	portal struct {
+		prepared *preparedStatement
+		params   []any
+		// The format of each result column
+		resultFormats []int16
+	}
+)
+
+// SQLSTATE codes for errors that don't come from the database
+const (
+	codeInternal            = "XX000"
+	codeProtocolViolation   = "08P01"
+	codeFeatureNotSupported = "0A000"
+	codeSyntaxError         = "42601"
+	codeInvalidPassword     = "28P01"
+	codeAdminShutdown       = "57P01"
+	codeQueryCanceled       = "57014"
+	codeTooManyConnections  = "53300"
+	codeNoActiveTx          = "25P01"
+	codeActiveTx            = "25001"
+	codeInFailedTx          = "25P02"
+	codeInvalidSavepoint    = "3B001"
+	codeInvalidParamValue   = "22023"
+	codeInvalidBinaryParam  = "22P03"
+	codeDuplicateStatement  = "42P05"
+	codeUnknownStatement    = "26000"
+	codeUnknownPortal       = "34000"
+)
+
+// connInfo is used to decode binary parameters
+var connInfo = pgtype.NewConnInfo()
+
+// simpleQuery runs the statements in a simple query. Consecutive statements that are not transaction control statements
+// are run together, so outside a transaction they run in an implicit transaction like they would with Postgres.
+func (c *conn) simpleQuery(sql string) {
+	sqls := splitStatements(sql)
+	if len(sqls) == 0 {
+		c.send(&pgproto3.EmptyQueryResponse{})
+		return
+	}
+
+	var batch []*pg.QueryReq
+	for _, sql := range sqls {
+		stmt, err := parseStatement(sql)
+		if err != nil {
+			c.sendError(codeSyntaxError, fmt.Sprintf("%s: %s", err.Error(), sql))
+			return
+		}
+		if stmt.Kind == statementQuery {
+			// Simple query results are always text
+			batch = append(batch, &pg.QueryReq{Statement: stmt.SQL, Params: []any{pgx.QueryResultFormatsByOID{}}})
+			continue
+		}
+		if !c.runQueries(batch, true) {
+			return
+		}
+		batch = nil
+		if !c.runTxStatement(stmt) {
+			return
+		}
+	}
+	c.runQueries(batch, true)
+}
+
+// runQueries runs the queries and sends their results, returning false if there was an error
+func (c *conn) runQueries(queries []*pg.QueryReq, describeRows bool) bool {
+	if len(queries) == 0 {
+		return true
+	}
+	if c.txFailed {
+		c.sendTxFailed()
+		return false
+	}
+
+	ctx, cancel := context.WithCancel(c.ctx)
+	defer cancel()
+	ctx, cancelQuery := pg.WithLocalCancel(ctx, cancel)
+	c.setCancel(cancelQuery)
+	defer c.setCancel(nil)
+
+	req := &pg.QueryRequest{Queries: queries}
+	if c.txID != "" {
+		req.TxID = utils.Ptr(c.txID)
+	}
+	stopWatching := c.watchDisconnect()
+	res, dErr := pg.Query(pg.WithRawRows(ctx), pg.PGPool, req)
+	stopWatching()
+	c.checkTx()
+	if dErr != nil {
+		c.sendDistributedError(dErr)
+		return false
+	}
+
+	for _, queryRes := range res.Queries {
+		if queryRes == nil {
+			break
+		}
+		if queryRes.Error != nil {
+			c.sendQueryError(queryRes.PGError)
+			return false
+		}
+		if describeRows && len(queryRes.FieldDescriptions()) > 0 {
+			c.send(rowDescription(queryRes.FieldDescriptions(), nil))
+		}
+		for _, row := range queryRes.RawRows() {
+			c.send(&pgproto3.DataRow{Values: row})
+		}
+		c.send(&pgproto3.CommandComplete{CommandTag: []byte(utils.Deref(queryRes.CommandTag, ""))})
+	}
+	return true
+}
+
+// runTxStatement runs a transaction control statement with the TxManager, returning false if there was an error
+func (c *conn) runTxStatement(stmt *statement) bool {
+	ctx, cancel := context.WithTimeout(c.ctx, time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+
+	switch stmt.Kind {
+	case statementEmpty:
+		c.send(&pgproto3.EmptyQueryResponse{})
+
+	case statementBegin:
+		if c.txFailed {
+			c.sendTxFailed()
+			return false
+		}
+		if c.txID != "" {
+			c.sendNotice(codeActiveTx, "there is already a transaction in progress")
+			break
+		}
+		txID, err := pg.Manager.NewSessionTx(ctx, stmt.Begin)
+		if err != nil {
+			c.sendDistributedError(&pg.DistributedError{Err: err})
+			return false
+		}
+		c.txID = txID
+		c.complete("BEGIN")
+
+	case statementCommit, statementRollback:
+		tag := "COMMIT"
+		if stmt.Kind == statementRollback {
+			tag = "ROLLBACK"
+		}
+		if c.txFailed {
+			// The transaction was already rolled back
+			c.txFailed = false
+			c.complete("ROLLBACK")
+			break
+		}
+		if c.txID == "" {
+			c.sendNotice(codeNoActiveTx, "there is no transaction in progress")
+			c.complete(tag)
+			break
+		}
+
+		var dErr *pg.DistributedError
+		if stmt.Kind == statementCommit {
+			dErr = pg.Manager.CommitTx(ctx, c.txID)
+		} else {
+			dErr = pg.Manager.RollbackTx(ctx, c.txID)
+		}
+		// The transaction is over either way
+		c.txID = ""
+		if dErr != nil {
+			c.sendDistributedError(dErr)
+			return false
+		}
+		c.complete(tag)
+
+	case statementSavepoint, statementRollbackTo, statementRelease:
+		if c.txFailed {
+			c.sendTxFailed()
+			return false
+		}
+		op, tag := pg.SavepointOpCreate, "SAVEPOINT"
+		switch stmt.Kind {
+		case statementRollbackTo:
+			op, tag = pg.SavepointOpRollbackTo, "ROLLBACK"
+		case statementRelease:
+			op, tag = pg.SavepointOpRelease, "RELEASE"
+		}
+		if c.txID == "" {
+			c.sendError(codeNoActiveTx, fmt.Sprintf("%s can only be used in transaction blocks", strings.ToUpper(strings.Fields(stmt.SQL)[0])))
+			return false
+		}
+
+		dErr := pg.Manager.SavepointTx(ctx, c.txID, stmt.Savepoint, op)
+		if dErr != nil && errors.Is(dErr.Err, pg.ErrSavepointNotFound) {
+			c.sendError(codeInvalidSavepoint, fmt.Sprintf("savepoint %q does not exist", stmt.Savepoint))
+			return false
+		}
+		c.checkTx()
+		if dErr != nil {
+			c.sendDistributedError(dErr)
+			return false
+		}
+		c.complete(tag)
+	}
+	return true
+}
+
+func (c *conn) parse(msg *pgproto3.Parse) {
+	if len(splitStatements(msg.Query)) > 1 {
+		c.extendedError(codeSyntaxError, "cannot insert multiple commands into a prepared statement")
+		return
+	}
+	stmt, err := parseStatement(msg.Query)
+	if err != nil {
+		c.extendedError(codeSyntaxError, fmt.Sprintf("%s: %s", err.Error(), msg.Query))
+		return
+	}
+	if _, exists := c.statements[msg.Name]; exists && msg.Name != "" {
+		c.extendedError(codeDuplicateStatement, fmt.Sprintf("prepared statement %q already exists", msg.Name))
+		return
+	}
+
+	prepared := &preparedStatement{
+		stmt:      stmt,
+		paramOIDs: append([]uint32{}, msg.ParameterOIDs...),
+	}
+	if stmt.Kind == statementQuery {
+		if c.txFailed {
+			c.sendTxFailed()
+			c.extendedErr = true
+			return
+		}
+
+		var txID *string
+		if c.txID != "" {
+			txID = utils.Ptr(c.txID)
+		}
+		res, dErr := pg.Describe(c.ctx, pg.PGPool, txID, stmt.SQL, prepared.paramOIDs)
+		c.checkTx()
+		if dErr != nil {
+			c.sendDistributedError(dErr)
+			c.extendedErr = true
+			return
+		}
+		if res.Error != nil {
+			c.sendQueryError(res.Error)
+			c.extendedErr = true
+			return
+		}
+		prepared.paramOIDs = res.Description.ParamOIDs
+		prepared.fields = res.Description.Fields
+	}
+
+	c.statements[msg.Name] = prepared
+	c.send(&pgproto3.ParseComplete{})
+}
+
+func (c *conn) bind(msg *pgproto3.Bind) {
+	prepared, exists := c.statements[msg.PreparedStatement]
+	if !exists {
+		c.extendedError(codeUnknownStatement, fmt.Sprintf("prepared statement %q does not exist", msg.PreparedStatement))
+		return
+	}
+	if len(msg.Parameters) != len(prepared.paramOIDs) {
+		c.extendedError(codeProtocolViolation, fmt.Sprintf("bind message supplies %d parameters, but prepared statement %q requires %d", len(msg.Parameters), msg.PreparedStatement, len(prepared.paramOIDs)))
+		return
+	}
+
+	params, err := decodeParams(prepared.paramOIDs, msg.ParameterFormatCodes, msg.Parameters)
+	if err != nil {
+		c.extendedError(codeInvalidBinaryParam, err.Error())
+		return
+	}
+
+	resultFormats := make([]int16, len(prepared.fields))
+	for i := range resultFormats {
+		resultFormats[i] = formatCode(msg.ResultFormatCodes, i)
+	}
+
+	c.portals[msg.DestinationPortal] = &portal{
+		prepared:      prepared,
+		params:        params,
+		resultFormats: resultFormats,
+	}
+	c.send(&pgproto3.BindComplete{})
+}
+
+func (c *conn) describe(msg *pgproto3.Describe) {
+	var fields []pgproto3.FieldDescription
+	var resultFormats []int16
+	if msg.ObjectType == 'S' {
+		prepared, exists := c.statements[msg.Name]
+		if !exists {
+			c.extendedError(codeUnknownStatement, fmt.Sprintf("prepared statement %q does not exist", msg.Name))
+			return
+		}
+		c.send(&pgproto3.ParameterDescription{ParameterOIDs: prepared.paramOIDs})
+		fields = prepared.fields
+	} else {
+		portal, exists := c.portals[msg.Name]
+		if !exists {
+			c.extendedError(codeUnknownPortal, fmt.Sprintf("portal %q does not exist", msg.Name))
+			return
+		}
+		fields = portal.prepared.fields
+		resultFormats = portal.resultFormats
+	}
+
+	if len(fields) == 0 {
+		c.send(&pgproto3.NoData{})
+		return
+	}
+	c.send(rowDescription(fields, resultFormats))
+}
+
+// execute runs the portal. The row limit is not supported, so all rows are always returned.
+func (c *conn) execute(msg *pgproto3.Execute) {
+	portal, exists := c.portals[msg.Portal]
+	if !exists {
+		c.extendedError(codeUnknownPortal, fmt.Sprintf("portal %q does not exist", msg.Portal))
+		return
+	}
+
+	stmt := portal.prepared.stmt
+	var ok bool
+	if stmt.Kind == statementQuery {
+		var option any = pgx.QueryResultFormatsByOID{}
+		for _, format := range portal.resultFormats {
+			if format == pgtype.BinaryFormatCode {
+				option = pgx.QueryResultFormats(portal.resultFormats)
+				break
+			}
+		}
+		ok = c.runQueries([]*pg.QueryReq{{
+			Statement: stmt.SQL,
+			Params:    append([]any{option}, portal.params...),
+		}}, false)
+	} else {
+		ok = c.runTxStatement(stmt)
+	}
+	if !ok {
+		c.extendedErr = true
+	}
+}
+
+func (c *conn) closeObject(msg *pgproto3.Close) {
+	if msg.ObjectType == 'S' {
+		delete(c.statements, msg.Name)
+	} else {
+		delete(c.portals, msg.Name)
+	}
+	c.send(&pgproto3.CloseComplete{})
+}
+
+// decodeParams converts the parameters into values for pgx. Text parameters are passed as strings, which pgx sends as
+// text, and binary parameters are decoded by their type so pgx can encode them again.
+func decodeParams(oids []uint32, formats []int16, values [][]byte) ([]any, error) {
+	params := make([]any, len(values))
+	for i, value := range values {
+		if value == nil {
+			continue
+		}
+		if formatCode(formats, i) == pgtype.TextFormatCode {
+			params[i] = string(value)
+			continue
+		}
+
+		dt, ok := connInfo.DataTypeForOID(oids[i])
+		if !ok {
+			return nil, fmt.Errorf("binary parameters of type %d are not supported, use the text format", oids[i])
+		}
+		decoder, ok := pgtype.NewValue(dt.Value).(pgtype.BinaryDecoder)
+		if !ok {
+			return nil, fmt.Errorf("binary parameters of type %s are not supported, use the text format", dt.Name)
+		}
+		// The message buffer is reused
+		if err := decoder.DecodeBinary(connInfo, append([]byte{}, value...)); err != nil {
+			return nil, fmt.Errorf("invalid binary parameter $%d: %w", i+1, err)
+		}
+		params[i] = decoder
+	}
+	return params, nil
+}
+
+// formatCode gets the format at the index, where no formats means text and a single format applies to all
+func formatCode(formats []int16, i int) int16 {
+	switch len(formats) {
+	case 0:
+		return pgtype.TextFormatCode
+	case 1:
+		return formats[0]
+	default:
+		if i >= len(formats) {
+			return pgtype.TextFormatCode
+		}
+		return formats[i]
+	}
+}
+
+func rowDescription(fields []pgproto3.FieldDescription, formats []int16) *pgproto3.RowDescription {
+	rd := &pgproto3.RowDescription{Fields: make([]pgproto3.FieldDescription, len(fields))}
+	for i, field := range fields {
+		rd.Fields[i] = field
+		rd.Fields[i].Format = formatCode(formats, i)
+	}
+	return rd
+}
+
+func (c *conn) complete(tag string) {
+	c.send(&pgproto3.CommandComplete{CommandTag: []byte(tag)})
+}
+
+func (c *conn) sendNotice(code, msg string) {
+	c.send(&pgproto3.NoticeResponse{Severity: "WARNING", Code: code, Message: msg})
+}
+
+func (c *conn) sendError(code, msg string) {
+	c.send(&pgproto3.ErrorResponse{Severity: "ERROR", Code: code, Message: msg})
+}
+
+// extendedError sends the error and skips the rest of the extended query messages until the next sync
+func (c *conn) extendedError(code, msg string) {
+	c.sendError(code, msg)
+	c.extendedErr = true
+}
+
+func (c *conn) sendTxFailed() {
+	c.sendError(codeInFailedTx, "current transaction is aborted, commands ignored until end of transaction block")
+}
+
+func (c *conn) sendQueryError(qErr *pg.QueryError) {
+	severity, code, msg := qErr.Severity, qErr.Code, qErr.Message
+	if severity == "" {
+		severity = "ERROR"
+	}
+	if code == "" {
+		code = codeInternal
+		if qErr.Class == pg.ErrorClassTimeout || qErr.Class == pg.ErrorClassCanceled {
+			code = codeQueryCanceled
+		}
+	} else {
+		// The message has the severity and code around it
+		msg = strings.TrimSuffix(strings.TrimPrefix(msg, qErr.Severity+": "), fmt.Sprintf(" (SQLSTATE %s)", code))
+	}
+	c.send(&pgproto3.ErrorResponse{
+		Severity:       severity,
+		Code:           code,
+		Message:        msg,
+		Detail:         qErr.Detail,
+		Hint:           qErr.Hint,
+		Position:       qErr.Position,
+		ConstraintName: qErr.Constraint,
+		TableName:      qErr.Table,
+		ColumnName:     qErr.Column,
+		Where:          qErr.Where,
+	})
+}
+
+// sendDistributedError sends the error for a known gateway error, otherwise it logs the error and sends an internal error
+func (c *conn) sendDistributedError(err *pg.DistributedError) {
+	if err.Remote {
+		c.sendError(codeInternal, err.ErrString)
+		return
+	}
+
+	switch {
+	case errors.Is(err.Err, utils.ErrPoolTimeout):
+		c.sendError(codeTooManyConnections, "timed out waiting for free pool connection")
+	case errors.Is(err.Err, pg.ErrRemoteTimeout), errors.Is(err.Err, context.DeadlineExceeded):
+		c.sendError(codeQueryCanceled, "canceling statement due to statement timeout")
+	case errors.Is(err.Err, context.Canceled):
+		c.sendError(codeQueryCanceled, "canceling statement due to user request")
+	case errors.Is(err.Err, pg.ErrTxNotFound), errors.Is(err.Err, pg.ErrTxNotFoundLocal):
+		c.sendError(codeInFailedTx, "transaction not found, did it timeout?")
+	case errors.Is(err.Err, pg.ErrInvalidTxOptions):
+		c.sendError(codeInvalidParamValue, err.Err.Error())
+	case errors.Is(err.Err, pg.ErrDraining):
+		c.sendError(codeAdminShutdown, err.Err.Error())
+	default:
+		zerolog.Ctx(c.ctx).Error().Err(err.Err).Msg("error handling pgwire query")
+		c.sendError(codeInternal, "internal error")
+	}
+}
@@ -0,0 +1,122 @@
+package pgwire
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgproto3/v2"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+const (
+	scramMechanism = "SCRAM-SHA-256"
+	// The Postgres default
+	scramIterations = 4096
+)
+
+var errInvalidSCRAM = errors.New("malformed SCRAM message")
+
+// authenticateSCRAM runs a SCRAM-SHA-256 exchange (RFC 5802, RFC 7677), returning whether the client proved that it
+// knows the password. Channel binding is not offered.
+func (c *conn) authenticateSCRAM(password string) (bool, error) {
+	msg, err := c.sendAuth(&pgproto3.AuthenticationSASL{AuthMechanisms: []string{scramMechanism}}, pgproto3.AuthTypeSASL)
+	if err != nil {
+		return false, err
+	}
+	initial, ok := msg.(*pgproto3.SASLInitialResponse)
+	if !ok || initial.AuthMechanism != scramMechanism {
+		return false, errInvalidSCRAM
+	}
+
+	// The client-first-message is the GS2 header and the bare message
+	clientFirst := string(initial.Data)
+	if !strings.HasPrefix(clientFirst, "n,,") && !strings.HasPrefix(clientFirst, "y,,") {
+		return false, errInvalidSCRAM
+	}
+	gs2Header, clientFirstBare := clientFirst[:3], clientFirst[3:]
+	clientNonce := scramAttr(clientFirstBare, 'r')
+	if clientNonce == "" {
+		return false, errInvalidSCRAM
+	}
+
+	random := make([]byte, 34)
+	if _, err := rand.Read(random); err != nil {
+		return false, fmt.Errorf("error in rand.Read: %w", err)
+	}
+	salt := random[:16]
+	nonce := clientNonce + base64.StdEncoding.EncodeToString(random[16:])
+	serverFirst := fmt.Sprintf("r=%s,s=%s,i=%d", nonce, base64.StdEncoding.EncodeToString(salt), scramIterations)
+	msg, err = c.sendAuth(&pgproto3.AuthenticationSASLContinue{Data: []byte(serverFirst)}, pgproto3.AuthTypeSASLContinue)
+	if err != nil {
+		return false, err
+	}
+	response, ok := msg.(*pgproto3.SASLResponse)
+	if !ok {
+		return false, errInvalidSCRAM
+	}
+
+	clientFinal := string(response.Data)
+	proofIndex := strings.LastIndex(clientFinal, ",p=")
+	if proofIndex < 0 {
+		return false, errInvalidSCRAM
+	}
+	clientFinalWithoutProof := clientFinal[:proofIndex]
+	proof, err := base64.StdEncoding.DecodeString(clientFinal[proofIndex+len(",p="):])
+	if err != nil || len(proof) != sha256.Size {
+		return false, errInvalidSCRAM
+	}
+	if scramAttr(clientFinalWithoutProof, 'c') != base64.StdEncoding.EncodeToString([]byte(gs2Header)) || scramAttr(clientFinalWithoutProof, 'r') != nonce {
+		return false, errInvalidSCRAM
+	}
+
+	saltedPassword := pbkdf2.Key([]byte(password), salt, scramIterations, sha256.Size, sha256.New)
+	storedKey := sha256.Sum256(scramHMAC(saltedPassword, "Client Key"))
+	authMessage := clientFirstBare + "," + serverFirst + "," + clientFinalWithoutProof
+	// The proof is the client key XORed with the client signature
+	clientSignature := scramHMAC(storedKey[:], authMessage)
+	for i := range proof {
+		proof[i] ^= clientSignature[i]
+	}
+	clientStoredKey := sha256.Sum256(proof)
+	if subtle.ConstantTimeCompare(clientStoredKey[:], storedKey[:]) != 1 {
+		return false, nil
+	}
+
+	serverSignature := scramHMAC(scramHMAC(saltedPassword, "Server Key"), authMessage)
+	c.send(&pgproto3.AuthenticationSASLFinal{Data: []byte("v=" + base64.StdEncoding.EncodeToString(serverSignature))})
+	return true, nil
+}
+
+// sendAuth sends the authentication request and receives the client's response to it
+func (c *conn) sendAuth(msg pgproto3.BackendMessage, authType uint32) (pgproto3.FrontendMessage, error) {
+	c.send(msg)
+	if err := c.flush(); err != nil {
+		return nil, err
+	}
+	if err := c.backend.SetAuthType(authType); err != nil {
+		return nil, fmt.Errorf("error in SetAuthType: %w", err)
+	}
+	return c.backend.Receive()
+}
+
+// scramAttr returns the value of the attribute in a SCRAM message, or an empty string if it's missing
+func scramAttr(msg string, name byte) string {
+	for _, attr := range strings.Split(msg, ",") {
+		if len(attr) >= 2 && attr[0] == name && attr[1] == '=' {
+			return attr[2:]
+		}
+	}
+	return ""
+}
+
+func scramHMAC(key []byte, msg string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(msg))
+	return mac.Sum(nil)
+}
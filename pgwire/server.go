@@ -0,0 +1,201 @@
+package pgwire
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/danthegoodman1/SQLGateway/gologger"
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+)
+
+var logger = gologger.NewLogger()
+
+// serverParams are the parameters reported to clients on startup, taken from the pool connections so that clients parse
+// the text values they return correctly
+var serverParams = []string{
+	"server_version",
+	"server_encoding",
+	"client_encoding",
+	"DateStyle",
+	"IntervalStyle",
+	"TimeZone",
+	"integer_datetimes",
+	"standard_conforming_strings",
+}
+
+type Server struct {
+	listener net.Listener
+	params   map[string]string
+	// nil if clients can't connect with TLS
+	tlsConfig *tls.Config
+
+	connsMu *sync.Mutex
+	// keyed by process ID, so cancel requests can find the connection
+	conns   map[uint32]*conn
+	wg      *sync.WaitGroup
+	closing chan struct{}
+}
+
+// StartServer listens for Postgres clients on PGWIRE_PORT
+func StartServer() (*Server, error) {
+	var tlsConfig *tls.Config
+	if utils.PGWIRE_TLS_CERT != "" && utils.PGWIRE_TLS_KEY != "" {
+		cert, err := tls.LoadX509KeyPair(utils.PGWIRE_TLS_CERT, utils.PGWIRE_TLS_KEY)
+		if err != nil {
+			return nil, fmt.Errorf("error in tls.LoadX509KeyPair: %w", err)
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}, MinVersion: tls.VersionTLS12}
+	}
+
+	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", utils.PGWIRE_PORT))
+	if err != nil {
+		return nil, fmt.Errorf("error creating tcp listener: %w", err)
+	}
+	s := NewServer(listener, loadServerParams(), tlsConfig)
+
+	logger.Info().Msg("starting pgwire server on " + listener.Addr().String())
+	go s.accept()
+	return s, nil
+}
+
+// NewServer creates a server on the listener without accepting connections. Clients can upgrade to TLS if tlsConfig
+// is not nil.
+func NewServer(listener net.Listener, params map[string]string, tlsConfig *tls.Config) *Server {
+	return &Server{
+		listener:  listener,
+		params:    params,
+		tlsConfig: tlsConfig,
+		connsMu:   &sync.Mutex{},
+		conns:     map[uint32]*conn{},
+		wg:        &sync.WaitGroup{},
+		closing:   make(chan struct{}),
+	}
+}
+
+func loadServerParams() map[string]string {
+	params := map[string]string{
+		"server_version":              "13.0",
+		"server_encoding":             "UTF8",
+		"client_encoding":             "UTF8",
+		"DateStyle":                   "ISO, MDY",
+		"integer_datetimes":           "on",
+		"standard_conforming_strings": "on",
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*time.Duration(utils.REQUEST_TIMEOUT_MS))
+	defer cancel()
+	conn, err := pg.PGPool.Acquire(ctx)
+	if err != nil {
+		logger.Warn().Err(err).Msg("error acquiring connection for pgwire server params, using defaults")
+		return params
+	}
+	defer conn.Release()
+
+	for _, name := range serverParams {
+		if value := conn.Conn().PgConn().ParameterStatus(name); value != "" {
+			params[name] = value
+		}
+	}
+	return params
+}
+
+func (s *Server) accept() {
+	for {
+		netConn, err := s.listener.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return
+		}
+		if err != nil {
+			logger.Error().Err(err).Msg("error accepting pgwire connection")
+			time.Sleep(time.Millisecond * 100)
+			continue
+		}
+
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.serve(netConn)
+		}()
+	}
+}
+
+// Shutdown stops accepting connections and terminates the open ones once they finish their current message, waiting
+// for them to roll back their transactions
+func (s *Server) Shutdown(ctx context.Context) error {
+	close(s.closing)
+	err := s.listener.Close()
+
+	s.connsMu.Lock()
+	for _, c := range s.conns {
+		// Wake up connections waiting for a message
+		c.netConn.SetReadDeadline(time.Now())
+	}
+	s.connsMu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (s *Server) isClosing() bool {
+	select {
+	case <-s.closing:
+		return true
+	default:
+		return false
+	}
+}
+
+// register gives the connection a unique process ID and secret key for cancel requests
+func (s *Server) register(c *conn) error {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+
+	for {
+		var key [8]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return fmt.Errorf("error in rand.Read: %w", err)
+		}
+		c.processID = binary.BigEndian.Uint32(key[:4])
+		c.secretKey = binary.BigEndian.Uint32(key[4:])
+		if _, exists := s.conns[c.processID]; !exists && c.processID != 0 {
+			s.conns[c.processID] = c
+			return nil
+		}
+	}
+}
+
+func (s *Server) unregister(c *conn) {
+	s.connsMu.Lock()
+	defer s.connsMu.Unlock()
+	delete(s.conns, c.processID)
+}
+
+// cancel cancels the running query of the connection if the secret key matches
+func (s *Server) cancel(processID, secretKey uint32) {
+	s.connsMu.Lock()
+	c, exists := s.conns[processID]
+	s.connsMu.Unlock()
+
+	if !exists || c.secretKey != secretKey {
+		logger.Debug().Uint32("processID", processID).Msg("ignoring pgwire cancel request for unknown connection")
+		return
+	}
+	c.cancel()
+}
@@ -0,0 +1,320 @@
+package pgwire
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/danthegoodman1/SQLGateway/pg"
+	"github.com/danthegoodman1/SQLGateway/utils"
+)
+
+type (
+	statementKind int
+
+	// statement is a single statement, with transaction control statements parsed so they can be run with the TxManager
+	statement struct {
+		SQL  string
+		Kind statementKind
+		// For begin
+		Begin *pg.BeginRequest
+		// For savepoint, rollback to, and release
+		Savepoint string
+	}
+)
+
+const (
+	statementQuery statementKind = iota
+	statementEmpty
+	statementBegin
+	statementCommit
+	statementRollback
+	statementSavepoint
+	statementRollbackTo
+	statementRelease
+)
+
+var ErrUnsupportedTxStatement = errors.New("unsupported transaction statement")
+
+// splitStatements splits a simple query into its statements on semicolons that are not in quotes, dollar quotes, or
+// comments. Empty statements are dropped.
+func splitStatements(sql string) []string {
+	var statements []string
+	start := 0
+	for i := 0; i < len(sql); i++ {
+		switch {
+		case sql[i] == ';':
+			statements = appendStatement(statements, sql[start:i])
+			start = i + 1
+		case sql[i] == '\'' || sql[i] == '"':
+			// Backslash escapes are only allowed in E'' strings
+			escapes := sql[i] == '\'' && i > 0 && (sql[i-1] == 'e' || sql[i-1] == 'E')
+			i = skipQuoted(sql, i, sql[i], escapes)
+		case sql[i] == '$':
+			i = skipDollarQuoted(sql, i)
+		case strings.HasPrefix(sql[i:], "--"):
+			end := strings.IndexByte(sql[i:], '\n')
+			if end == -1 {
+				i = len(sql)
+			} else {
+				i += end
+			}
+		case strings.HasPrefix(sql[i:], "/*"):
+			i = skipBlockComment(sql, i)
+		}
+	}
+	return appendStatement(statements, sql[start:])
+}
+
+func appendStatement(statements []string, sql string) []string {
+	if stripComments(sql) == "" {
+		return statements
+	}
+	return append(statements, strings.TrimSpace(sql))
+}
+
+// skipQuoted returns the index of the closing quote of the quoted string starting at i, where doubled quotes are escapes
+func skipQuoted(sql string, i int, quote byte, backslashEscapes bool) int {
+	for i++; i < len(sql); i++ {
+		switch {
+		case backslashEscapes && sql[i] == '\\':
+			i++
+		case sql[i] == quote && i+1 < len(sql) && sql[i+1] == quote:
+			i++
+		case sql[i] == quote:
+			return i
+		}
+	}
+	return len(sql)
+}
+
+// skipDollarQuoted returns the index of the end of the dollar quoted string starting at i, or i if it is not one
+// (e.g. a $1 parameter)
+func skipDollarQuoted(sql string, i int) int {
+	end := strings.IndexByte(sql[i+1:], '$')
+	if end == -1 {
+		return i
+	}
+	tag := sql[i : i+end+2]
+	for _, r := range tag[1 : len(tag)-1] {
+		if !(r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r >= 0x80) {
+			return i
+		}
+	}
+	if len(tag) > 2 && tag[1] >= '0' && tag[1] <= '9' {
+		return i
+	}
+	closing := strings.Index(sql[i+len(tag):], tag)
+	if closing == -1 {
+		return len(sql)
+	}
+	return i + len(tag) + closing + len(tag) - 1
+}
+
+// skipBlockComment returns the index of the end of the block comment starting at i, which can be nested
+func skipBlockComment(sql string, i int) int {
+	depth := 0
+	for ; i < len(sql); i++ {
+		switch {
+		case strings.HasPrefix(sql[i:], "/*"):
+			depth++
+			i++
+		case strings.HasPrefix(sql[i:], "*/"):
+			depth--
+			i++
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return len(sql)
+}
+
+// stripComments removes leading comments and whitespace
+func stripComments(sql string) string {
+	for {
+		sql = strings.TrimSpace(sql)
+		switch {
+		case strings.HasPrefix(sql, "--"):
+			end := strings.IndexByte(sql, '\n')
+			if end == -1 {
+				return ""
+			}
+			sql = sql[end:]
+		case strings.HasPrefix(sql, "/*"):
+			end := skipBlockComment(sql, 0)
+			if end >= len(sql) {
+				return ""
+			}
+			sql = sql[end+1:]
+		default:
+			return sql
+		}
+	}
+}
+
+// parseStatement finds the transaction control statements that have to go through the TxManager, everything else is a
+// query
+func parseStatement(sql string) (*statement, error) {
+	stmt := &statement{SQL: sql, Kind: statementQuery}
+	words := statementWords(sql)
+	if len(words) == 0 {
+		stmt.Kind = statementEmpty
+		return stmt, nil
+	}
+
+	switch strings.ToUpper(words[0]) {
+	case "BEGIN":
+		stmt.Kind = statementBegin
+		begin, err := parseBeginOptions(skipWords(words[1:], "WORK", "TRANSACTION"))
+		stmt.Begin = begin
+		return stmt, err
+	case "START":
+		if len(words) < 2 || !strings.EqualFold(words[1], "TRANSACTION") {
+			return stmt, nil
+		}
+		stmt.Kind = statementBegin
+		begin, err := parseBeginOptions(words[2:])
+		stmt.Begin = begin
+		return stmt, err
+	case "COMMIT", "END":
+		stmt.Kind = statementCommit
+		return stmt, expectEnd(skipWords(words[1:], "WORK", "TRANSACTION"))
+	case "ROLLBACK", "ABORT":
+		stmt.Kind = statementRollback
+		rest := skipWords(words[1:], "WORK", "TRANSACTION")
+		if strings.ToUpper(words[0]) == "ROLLBACK" && len(rest) > 0 && strings.EqualFold(rest[0], "TO") {
+			stmt.Kind = statementRollbackTo
+			name, err := parseSavepointName(skipWords(rest[1:], "SAVEPOINT"))
+			stmt.Savepoint = name
+			return stmt, err
+		}
+		return stmt, expectEnd(rest)
+	case "SAVEPOINT":
+		stmt.Kind = statementSavepoint
+		name, err := parseSavepointName(words[1:])
+		stmt.Savepoint = name
+		return stmt, err
+	case "RELEASE":
+		stmt.Kind = statementRelease
+		name, err := parseSavepointName(skipWords(words[1:], "SAVEPOINT"))
+		stmt.Savepoint = name
+		return stmt, err
+	}
+	return stmt, nil
+}
+
+func parseBeginOptions(words []string) (*pg.BeginRequest, error) {
+	begin := &pg.BeginRequest{}
+	for len(words) > 0 {
+		switch {
+		case matchWords(words, "ISOLATION", "LEVEL", "SERIALIZABLE"):
+			begin.IsoLevel = utils.Ptr("serializable")
+			words = words[3:]
+		case matchWords(words, "ISOLATION", "LEVEL", "REPEATABLE", "READ"):
+			begin.IsoLevel = utils.Ptr("repeatable read")
+			words = words[4:]
+		case matchWords(words, "ISOLATION", "LEVEL", "READ", "COMMITTED"):
+			begin.IsoLevel = utils.Ptr("read committed")
+			words = words[4:]
+		case matchWords(words, "ISOLATION", "LEVEL", "READ", "UNCOMMITTED"):
+			begin.IsoLevel = utils.Ptr("read uncommitted")
+			words = words[4:]
+		case matchWords(words, "READ", "ONLY"):
+			begin.AccessMode = utils.Ptr("read only")
+			words = words[2:]
+		case matchWords(words, "READ", "WRITE"):
+			begin.AccessMode = utils.Ptr("read write")
+			words = words[2:]
+		case matchWords(words, "NOT", "DEFERRABLE"):
+			begin.DeferrableMode = utils.Ptr("not deferrable")
+			words = words[2:]
+		case matchWords(words, "DEFERRABLE"):
+			begin.DeferrableMode = utils.Ptr("deferrable")
+			words = words[1:]
+		default:
+			return nil, ErrUnsupportedTxStatement
+		}
+	}
+	return begin, nil
+}
+
+func parseSavepointName(words []string) (string, error) {
+	if len(words) != 1 {
+		return "", ErrUnsupportedTxStatement
+	}
+	name := words[0]
+	if strings.HasPrefix(name, `"`) {
+		if len(name) < 2 || !strings.HasSuffix(name, `"`) {
+			return "", ErrUnsupportedTxStatement
+		}
+		return strings.ReplaceAll(name[1:len(name)-1], `""`, `"`), nil
+	}
+	// Unquoted identifiers are folded to lower case
+	return strings.ToLower(name), nil
+}
+
+func expectEnd(words []string) error {
+	if len(words) > 0 {
+		return ErrUnsupportedTxStatement
+	}
+	return nil
+}
+
+// skipWords skips any of the optional words at the start
+func skipWords(words []string, optional ...string) []string {
+	for len(words) > 0 {
+		skipped := false
+		for _, word := range optional {
+			if strings.EqualFold(words[0], word) {
+				words = words[1:]
+				skipped = true
+				break
+			}
+		}
+		if !skipped {
+			return words
+		}
+	}
+	return words
+}
+
+func matchWords(words []string, match ...string) bool {
+	if len(words) < len(match) {
+		return false
+	}
+	for i, word := range match {
+		if !strings.EqualFold(words[i], word) {
+			return false
+		}
+	}
+	return true
+}
+
+// statementWords splits the statement into words on whitespace and commas, keeping quoted identifiers together
+func statementWords(sql string) []string {
+	sql = strings.TrimSuffix(strings.TrimSpace(stripComments(sql)), ";")
+	var words []string
+	start := -1
+	for i := 0; i < len(sql); i++ {
+		switch c := sql[i]; {
+		case c == '"':
+			if start == -1 {
+				start = i
+			}
+			i = skipQuoted(sql, i, '"', false)
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			if start != -1 {
+				words = append(words, sql[start:i])
+				start = -1
+			}
+		default:
+			if start == -1 {
+				start = i
+			}
+		}
+	}
+	if start != -1 {
+		words = append(words, sql[start:])
+	}
+	return words
+}
@@ -0,0 +1,74 @@
+package pgwire
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+)
+
+func TestSplitStatements(t *testing.T) {
+	cases := map[string][]string{
+		"":                              nil,
+		" ; ;":                          nil,
+		"SELECT 1":                      {"SELECT 1"},
+		"SELECT 1; SELECT 2;":           {"SELECT 1", "SELECT 2"},
+		"SELECT ';'; SELECT 'it''s;'":   {"SELECT ';'", "SELECT 'it''s;'"},
+		`SELECT E'\';'; SELECT 2`:       {`SELECT E'\';'`, "SELECT 2"},
+		`SELECT 1 AS ";"; SELECT 2`:     {`SELECT 1 AS ";"`, "SELECT 2"},
+		"SELECT $$a;b$$; SELECT 2":      {"SELECT $$a;b$$", "SELECT 2"},
+		"SELECT $x$a;$$;b$x$; SELECT 2": {"SELECT $x$a;$$;b$x$", "SELECT 2"},
+		"SELECT $1; SELECT $2":          {"SELECT $1", "SELECT $2"},
+		"SELECT 1 -- a;b\n; SELECT 2":   {"SELECT 1 -- a;b", "SELECT 2"},
+		"/* a; /* b; */ c; */ SELECT 1; -- only a comment": {"/* a; /* b; */ c; */ SELECT 1"},
+	}
+	for sql, expected := range cases {
+		if statements := splitStatements(sql); !reflect.DeepEqual(statements, expected) {
+			t.Fatalf("splitting %q: expected %q, got %q", sql, expected, statements)
+		}
+	}
+}
+
+func TestParseStatement(t *testing.T) {
+	cases := map[string]statement{
+		"select 1":                    {Kind: statementQuery},
+		"-- comment\n":                {Kind: statementEmpty},
+		"BEGIN":                       {Kind: statementBegin},
+		"/* c */ begin work;":         {Kind: statementBegin},
+		"START TRANSACTION READ ONLY": {Kind: statementBegin},
+		"start transaction isolation level repeatable read, not deferrable": {Kind: statementBegin},
+		"COMMIT":                    {Kind: statementCommit},
+		"end transaction":           {Kind: statementCommit},
+		"ROLLBACK":                  {Kind: statementRollback},
+		"abort":                     {Kind: statementRollback},
+		"SAVEPOINT Sp1":             {Kind: statementSavepoint, Savepoint: "sp1"},
+		`savepoint "Sp ""1"""`:      {Kind: statementSavepoint, Savepoint: `Sp "1"`},
+		"ROLLBACK TO SAVEPOINT sp1": {Kind: statementRollbackTo, Savepoint: "sp1"},
+		"rollback work to sp1":      {Kind: statementRollbackTo, Savepoint: "sp1"},
+		"RELEASE sp1":               {Kind: statementRelease, Savepoint: "sp1"},
+		"start_time()":              {Kind: statementQuery},
+	}
+	for sql, expected := range cases {
+		stmt, err := parseStatement(sql)
+		if err != nil {
+			t.Fatalf("parsing %q: %s", sql, err)
+		}
+		if stmt.Kind != expected.Kind || stmt.Savepoint != expected.Savepoint {
+			t.Fatalf("parsing %q: expected %+v, got %+v", sql, expected, stmt)
+		}
+	}
+
+	stmt, err := parseStatement("START TRANSACTION ISOLATION LEVEL REPEATABLE READ, READ ONLY, DEFERRABLE")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if utils.Deref(stmt.Begin.IsoLevel, "") != "repeatable read" || utils.Deref(stmt.Begin.AccessMode, "") != "read only" || utils.Deref(stmt.Begin.DeferrableMode, "") != "deferrable" {
+		t.Fatalf("unexpected begin options %+v", stmt.Begin)
+	}
+
+	for _, sql := range []string{"BEGIN ISOLATION LEVEL SNAPSHOT", "COMMIT AND CHAIN", "SAVEPOINT", "RELEASE a b"} {
+		if _, err := parseStatement(sql); err != ErrUnsupportedTxStatement {
+			t.Fatalf("expected %q to be unsupported, got %v", sql, err)
+		}
+	}
+}
@@ -2,87 +2,129 @@ package red
 
 import (
 	"context"
+	"crypto/tls"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/danthegoodman1/SQLGateway/coord"
 	"github.com/danthegoodman1/SQLGateway/gologger"
 	"github.com/danthegoodman1/SQLGateway/utils"
 	"github.com/go-redis/redis/v9"
 	"github.com/rs/zerolog"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
 var (
-	RedisClient *redis.Client
+	RedisClient redis.UniversalClient
 	BGStopChan  = make(chan bool, 1)
-	Ticker      = time.NewTicker(time.Second * 5)
+	Ticker      = time.NewTicker(time.Second * time.Duration(utils.PEER_HEARTBEAT_SEC))
 	logger      = gologger.NewLogger()
 
-	ErrTxAlreadyExists = errors.New("transaction already exists")
+	// peerCache is the peer list from the last heartbeat, so that other features do not need to go to redis
+	peerCache = struct {
+		mu      *sync.Mutex
+		peers   map[string]*coord.Peer
+		updated time.Time
+	}{mu: &sync.Mutex{}}
+
+	ErrUnknownRedisMode = errors.New("unknown redis mode")
 )
 
-type (
-	Peer struct {
-		PodName    string
-		LastUpdate time.Time
-	}
+const (
+	RedisModeSingle   = "single"
+	RedisModeCluster  = "cluster"
+	RedisModeSentinel = "sentinel"
+)
 
-	TransactionMeta struct {
-		TxID   string
-		PodID  string
-		PodURL string
-		Expiry time.Time
-	}
+type (
+	// Coordinator implements coord.Coordinator with RedisClient
+	Coordinator struct{}
 )
 
-func ConnectRedis() error {
+var _ coord.Coordinator = &Coordinator{}
+
+func ConnectRedis() (*Coordinator, error) {
 	logger.Debug().Msg("connecting to redis")
+	c := &Coordinator{}
 	if utils.REDIS_ADDR != "" {
-		redisOpts := &redis.Options{
-			//Addrs:       []string{utils.REDIS_ADDR},
-			Addr:        utils.REDIS_ADDR,
-			DialTimeout: time.Second * 10,
-			PoolSize:    int(utils.REDIS_POOL_CONNS),
-
-			// For a single cluster mode endpoint
-			//RouteRandomly:  false,
-			//ReadOnly:       false,
-			//RouteByLatency: false,
-		}
-		if utils.REDIS_PASSWORD != "" {
-			redisOpts.Password = utils.REDIS_PASSWORD
+		var err error
+		RedisClient, err = newRedisClient()
+		if err != nil {
+			return nil, fmt.Errorf("error in newRedisClient: %w", err)
 		}
 
-		RedisClient = redis.NewClient(redisOpts)
-
 		// Test connection
 		ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
 		defer cancel()
 
-		_, err := RedisClient.Ping(ctx).Result()
+		_, err = RedisClient.Ping(ctx).Result()
 		if err != nil {
-			return fmt.Errorf("error in RedisClient.Ping: %w", err)
+			return nil, fmt.Errorf("error in RedisClient.Ping: %w", err)
 		}
 		logger.Debug().Msg("connected to redis")
+
+		// Join the cluster before serving requests, so the peer list is populated
+		c.updateRedisSD()
+		go func() {
+			logger.Debug().Msg("starting redis background worker")
+			for {
+				select {
+				case <-Ticker.C:
+					go c.updateRedisSD()
+				case <-BGStopChan:
+					return
+				}
+			}
+		}()
+	}
+	return c, nil
+}
+
+func (*Coordinator) Name() string {
+	return "redis"
+}
+
+// newRedisClient creates the client for REDIS_MODE. The mode is explicit rather than inferred from the addresses, so a
+// single cluster endpoint can be used.
+func newRedisClient() (redis.UniversalClient, error) {
+	opts := &redis.UniversalOptions{
+		Addrs:            strings.Split(utils.REDIS_ADDR, ","),
+		Username:         utils.REDIS_USERNAME,
+		Password:         utils.REDIS_PASSWORD,
+		MasterName:       utils.REDIS_SENTINEL_MASTER,
+		SentinelPassword: utils.REDIS_SENTINEL_PASSWORD,
+		DialTimeout:      time.Second * 10,
+		PoolSize:         int(utils.REDIS_POOL_CONNS),
+	}
+	if utils.REDIS_TLS {
+		opts.TLSConfig = &tls.Config{
+			MinVersion: tls.VersionTLS12,
+		}
+	}
+
+	switch utils.REDIS_MODE {
+	case RedisModeSingle:
+		return redis.NewClient(opts.Simple()), nil
+	case RedisModeCluster:
+		return redis.NewClusterClient(opts.Cluster()), nil
+	case RedisModeSentinel:
+		if opts.MasterName == "" {
+			return nil, fmt.Errorf("REDIS_SENTINEL_MASTER is required for %s mode", RedisModeSentinel)
+		}
+		return redis.NewFailoverClient(opts.Failover()), nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownRedisMode, utils.REDIS_MODE)
 	}
-	//go func() {
-	//	logger.Debug().Msg("starting redis background worker")
-	//	for {
-	//		select {
-	//		case <-Ticker.C:
-	//			go updateRedisSD()
-	//		case <-BGStopChan:
-	//			return
-	//		}
-	//	}
-	//}()
-	return nil
 }
 
 // getSelfPeerJSONBytes Gets the *Peer of this pod as JSON bytes
 func getSelfPeerJSONBytes() ([]byte, error) {
-	peer := &Peer{
+	peer := &coord.Peer{
 		PodName:    utils.POD_NAME,
+		PodURL:     utils.GetPodURL(),
 		LastUpdate: time.Now(),
 	}
 
@@ -93,8 +135,8 @@ func getSelfPeerJSONBytes() ([]byte, error) {
 	return jsonBytes, nil
 }
 
-func peerFromBytes(jsonBytes []byte) (*Peer, error) {
-	var peer Peer
+func peerFromBytes(jsonBytes []byte) (*coord.Peer, error) {
+	var peer coord.Peer
 	err := json.Unmarshal(jsonBytes, &peer)
 	if err != nil {
 		return nil, fmt.Errorf("error in json.Unmarshal: %w", err)
@@ -102,29 +144,84 @@ func peerFromBytes(jsonBytes []byte) (*Peer, error) {
 	return &peer, nil
 }
 
-// updateRedisSD should be launched in a go routine
-//func updateRedisSD() {
-//	logger.Debug().Msg("updating Redis SD")
-//	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
-//	defer cancel()
-//
-//	self, err := getSelfPeerJSONBytes()
-//	if err != nil {
-//		logger.Error().Err(err).Msg("error getting self peer json bytes")
-//		return
-//	}
-//
-//	s := time.Now()
-//	_, err = RedisClient.HSet(ctx, utils.V_NAMESPACE, utils.POD_NAME, string(self)).Result()
-//	if err != nil {
-//		logger.Error().Err(err).Msg("error in RedisClient.HSET")
-//		return
-//	}
-//	since := time.Since(s)
-//	logger.Debug().Int64("updateTimeNS", since.Nanoseconds()).Msgf("updated Redis SD in %s", since)
-//}
-
-func GetPeers(ctx context.Context) (map[string]*Peer, error) {
+// updateRedisSD heartbeats this pod into the peer hash, evicts stale peers, and refreshes the local peer list.
+// Should be launched in a go routine.
+func (c *Coordinator) updateRedisSD() {
+	logger.Debug().Msg("updating Redis SD")
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	self, err := getSelfPeerJSONBytes()
+	if err != nil {
+		logger.Error().Err(err).Msg("error getting self peer json bytes")
+		return
+	}
+
+	s := time.Now()
+	_, err = RedisClient.HSet(ctx, utils.V_NAMESPACE, utils.POD_NAME, string(self)).Result()
+	if err != nil {
+		logger.Error().Err(err).Msg("error in RedisClient.HSET")
+		return
+	}
+
+	peers, err := c.GetPeers(ctx)
+	if err != nil {
+		logger.Error().Err(err).Msg("error in GetPeers")
+		return
+	}
+
+	// Any pod can evict a stale peer, if it is still alive it will add itself back on its next heartbeat
+	stale := make([]string, 0)
+	for podName, peer := range peers {
+		if !peer.Healthy() {
+			stale = append(stale, podName)
+			delete(peers, podName)
+		}
+	}
+	if len(stale) > 0 {
+		logger.Warn().Strs("peers", stale).Msg("evicting stale peers")
+		_, err = RedisClient.HDel(ctx, utils.V_NAMESPACE, stale...).Result()
+		if err != nil {
+			logger.Error().Err(err).Msg("error in RedisClient.HDel")
+		}
+	}
+
+	peerCache.mu.Lock()
+	peerCache.peers = peers
+	peerCache.updated = time.Now()
+	peerCache.mu.Unlock()
+
+	since := time.Since(s)
+	logger.Debug().Int64("updateTimeNS", since.Nanoseconds()).Msgf("updated Redis SD in %s", since)
+}
+
+// CachedPeers returns the healthy peers from the last heartbeat, including this pod, sorted by name
+func (*Coordinator) CachedPeers() []*coord.Peer {
+	peerCache.mu.Lock()
+	defer peerCache.mu.Unlock()
+
+	if peerCache.peers == nil {
+		return nil
+	}
+
+	peers := make([]*coord.Peer, 0, len(peerCache.peers))
+	for _, peer := range peerCache.peers {
+		peers = append(peers, peer)
+	}
+	sort.Slice(peers, func(i, j int) bool {
+		return peers[i].PodName < peers[j].PodName
+	})
+	return peers
+}
+
+// CachedPeersUpdated returns when the cached peers were last refreshed
+func (*Coordinator) CachedPeersUpdated() time.Time {
+	peerCache.mu.Lock()
+	defer peerCache.mu.Unlock()
+	return peerCache.updated
+}
+
+func (*Coordinator) GetPeers(ctx context.Context) (map[string]*coord.Peer, error) {
 	logger := zerolog.Ctx(ctx)
 
 	ctx, cancel := context.WithTimeout(ctx, time.Second*5)
@@ -139,7 +236,7 @@ func GetPeers(ctx context.Context) (map[string]*Peer, error) {
 	since := time.Since(s)
 	logger.Debug().Int64("updateTimeNS", since.Nanoseconds()).Msgf("got peers from redis in %s", since)
 
-	peers := make(map[string]*Peer, 0)
+	peers := make(map[string]*coord.Peer, 0)
 	for podName, peerJSON := range rHash {
 		peer, err := peerFromBytes([]byte(peerJSON))
 		if err != nil {
@@ -150,7 +247,20 @@ func GetPeers(ctx context.Context) (map[string]*Peer, error) {
 	return peers, nil
 }
 
-func SetTransaction(ctx context.Context, txMeta *TransactionMeta) error {
+// namespacedKey prefixes the key with V_NAMESPACE if it is set, so several deployments can share a redis. Without a
+// namespace the key is used as-is, which is the format from before namespacing, so pods can be upgraded one at a time.
+func namespacedKey(key string) string {
+	if utils.V_NAMESPACE == "" {
+		return key
+	}
+	return utils.V_NAMESPACE + ":" + key
+}
+
+func txKey(txID string) string {
+	return namespacedKey(txID)
+}
+
+func (*Coordinator) SetTransaction(ctx context.Context, txMeta *coord.TransactionMeta) error {
 	logger := zerolog.Ctx(ctx)
 	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
 		return c.Str("txID", txMeta.TxID)
@@ -163,12 +273,12 @@ func SetTransaction(ctx context.Context, txMeta *TransactionMeta) error {
 		return fmt.Errorf("error in json.Marshal: %w", err)
 	}
 
-	set, err := RedisClient.SetNX(ctx, txMeta.TxID, string(txMetaBytes), txMeta.Expiry.Sub(time.Now())).Result()
+	set, err := RedisClient.SetNX(ctx, txKey(txMeta.TxID), string(txMetaBytes), txMeta.Expiry.Sub(time.Now())).Result()
 	if err != nil {
 		return fmt.Errorf("error in RedisClient.SetNX: %w", err)
 	}
 	if !set {
-		return ErrTxAlreadyExists
+		return coord.ErrTxAlreadyExists
 	}
 	if utils.TRACES {
 		logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
@@ -180,14 +290,17 @@ func SetTransaction(ctx context.Context, txMeta *TransactionMeta) error {
 	return nil
 }
 
-func GetTransaction(ctx context.Context, txID string) (txMeta *TransactionMeta, err error) {
+func (*Coordinator) GetTransaction(ctx context.Context, txID string) (txMeta *coord.TransactionMeta, err error) {
 	logger := zerolog.Ctx(ctx)
 	logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
 		return c.Str("txID", txID)
 	})
 	logger.Debug().Msg("getting transaction from redis")
 	s := time.Now()
-	txString, err := RedisClient.Get(ctx, txID).Result()
+	txString, err := RedisClient.Get(ctx, txKey(txID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, coord.ErrNotFound
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error in RedisClient.Get: %w", err)
 	}
@@ -206,11 +319,254 @@ func GetTransaction(ctx context.Context, txID string) (txMeta *TransactionMeta,
 	return
 }
 
-func Shutdown(ctx context.Context) error {
+// ListTransactions returns the metadata of all transactions in the cluster
+func (*Coordinator) ListTransactions(ctx context.Context) ([]*coord.TransactionMeta, error) {
+	logger := zerolog.Ctx(ctx)
+	logger.Debug().Msg("listing transactions in redis")
+
+	keys, err := scanKeys(ctx, txKey("tx*"))
+	if err != nil {
+		return nil, fmt.Errorf("error in scanKeys: %w", err)
+	}
+
+	txMetas := make([]*coord.TransactionMeta, 0, len(keys))
+	if len(keys) == 0 {
+		return txMetas, nil
+	}
+
+	// Pipelined GETs rather than MGET, since the keys can be in different cluster slots
+	cmds := make([]*redis.StringCmd, len(keys))
+	_, err = RedisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for i, key := range keys {
+			cmds[i] = pipe.Get(ctx, key)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.Nil) {
+		return nil, fmt.Errorf("error in RedisClient.Pipelined: %w", err)
+	}
+	for _, cmd := range cmds {
+		txString, err := cmd.Result()
+		if errors.Is(err, redis.Nil) {
+			// Expired between the scan and the get
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("error in Get: %w", err)
+		}
+		var txMeta coord.TransactionMeta
+		err = json.Unmarshal([]byte(txString), &txMeta)
+		if err != nil {
+			return nil, fmt.Errorf("error in json.Unmarshal: %w", err)
+		}
+		txMetas = append(txMetas, &txMeta)
+	}
+	return txMetas, nil
+}
+
+// scanKeys returns all keys matching the pattern, scanning every master in cluster mode
+func scanKeys(ctx context.Context, pattern string) ([]string, error) {
+	keysMu := &sync.Mutex{}
+	keys := make([]string, 0)
+	scan := func(ctx context.Context, client redis.Cmdable) error {
+		iter := client.Scan(ctx, 0, pattern, 1000).Iterator()
+		for iter.Next(ctx) {
+			keysMu.Lock()
+			keys = append(keys, iter.Val())
+			keysMu.Unlock()
+		}
+		if err := iter.Err(); err != nil {
+			return fmt.Errorf("error in Scan: %w", err)
+		}
+		return nil
+	}
+
+	if clusterClient, ok := RedisClient.(*redis.ClusterClient); ok {
+		err := clusterClient.ForEachMaster(ctx, func(ctx context.Context, client *redis.Client) error {
+			return scan(ctx, client)
+		})
+		return keys, err
+	}
+	return keys, scan(ctx, RedisClient)
+}
+
+// ExtendTransaction updates the expiry of the transaction, and the TTL of its key to match
+func (c *Coordinator) ExtendTransaction(ctx context.Context, txID string, expiry time.Time) error {
+	logger := zerolog.Ctx(ctx)
+	logger.Debug().Msg("extending transaction in redis")
+	s := time.Now()
+
+	txMeta, err := c.GetTransaction(ctx, txID)
+	if err != nil {
+		return fmt.Errorf("error in GetTransaction: %w", err)
+	}
+	txMeta.Expiry = expiry
+
+	txMetaBytes, err := json.Marshal(txMeta)
+	if err != nil {
+		return fmt.Errorf("error in json.Marshal: %w", err)
+	}
+
+	set, err := RedisClient.SetXX(ctx, txKey(txID), string(txMetaBytes), time.Until(expiry)).Result()
+	if err != nil {
+		return fmt.Errorf("error in RedisClient.SetXX: %w", err)
+	}
+	if !set {
+		return fmt.Errorf("transaction expired while extending: %w", coord.ErrNotFound)
+	}
+	if utils.TRACES {
+		logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
+			return c.Interface("extend_transaction", gologger.Action{
+				DurationNS: time.Since(s).Nanoseconds(),
+			})
+		})
+	}
+	return nil
+}
+
+func (*Coordinator) DeleteTransaction(ctx context.Context, txID string) error {
+	_, err := RedisClient.Del(ctx, txKey(txID)).Result()
+	if err != nil {
+		return fmt.Errorf("error in RedisClient.Del: %w", err)
+	}
+	return nil
+}
+
+// DeleteTransactionsForPod removes the transactions owned by a pod, returning how many were removed
+func (c *Coordinator) DeleteTransactionsForPod(ctx context.Context, podName string) (int, error) {
+	txMetas, err := c.ListTransactions(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error in ListTransactions: %w", err)
+	}
+
+	txIDs := make([]string, 0)
+	for _, txMeta := range txMetas {
+		if txMeta.PodID == podName {
+			txIDs = append(txIDs, txMeta.TxID)
+		}
+	}
+	if len(txIDs) == 0 {
+		return 0, nil
+	}
+
+	// One DEL per key, since the keys can be in different cluster slots
+	_, err = RedisClient.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, txID := range txIDs {
+			pipe.Del(ctx, txKey(txID))
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error in RedisClient.Pipelined: %w", err)
+	}
+	return len(txIDs), nil
+}
+
+// RemovePeer removes a pod from the peer hash
+func (*Coordinator) RemovePeer(ctx context.Context, podName string) error {
+	_, err := RedisClient.HDel(ctx, utils.V_NAMESPACE, podName).Result()
+	if err != nil {
+		return fmt.Errorf("error in RedisClient.HDel: %w", err)
+	}
+	return nil
+}
+
+func runningQueryKey(queryID string) string {
+	return namespacedKey("query:" + queryID)
+}
+
+// SetRunningQuery registers the pod that a query is running on, so it can be cancelled from other pods
+func (*Coordinator) SetRunningQuery(ctx context.Context, queryMeta *coord.RunningQueryMeta, ttl time.Duration) error {
+	queryMetaBytes, err := json.Marshal(queryMeta)
+	if err != nil {
+		return fmt.Errorf("error in json.Marshal: %w", err)
+	}
+
+	_, err = RedisClient.Set(ctx, runningQueryKey(queryMeta.QueryID), string(queryMetaBytes), ttl).Result()
+	if err != nil {
+		return fmt.Errorf("error in RedisClient.Set: %w", err)
+	}
+	return nil
+}
+
+func (*Coordinator) GetRunningQuery(ctx context.Context, queryID string) (queryMeta *coord.RunningQueryMeta, err error) {
+	queryString, err := RedisClient.Get(ctx, runningQueryKey(queryID)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, coord.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error in RedisClient.Get: %w", err)
+	}
+
+	err = json.Unmarshal([]byte(queryString), &queryMeta)
+	if err != nil {
+		return nil, fmt.Errorf("error in json.Unmarshal: %w", err)
+	}
+	return
+}
+
+func (*Coordinator) DeleteRunningQuery(ctx context.Context, queryID string) error {
+	_, err := RedisClient.Del(ctx, runningQueryKey(queryID)).Result()
+	if err != nil {
+		return fmt.Errorf("error in RedisClient.Del: %w", err)
+	}
+	return nil
+}
+
+func idempotencyKey(key string) string {
+	return namespacedKey("idempotency:" + key)
+}
+
+// ReserveIdempotencyKey sets the value for an idempotency key if it does not exist, returning whether it was set
+func (*Coordinator) ReserveIdempotencyKey(ctx context.Context, key string, val []byte, ttl time.Duration) (bool, error) {
+	set, err := RedisClient.SetNX(ctx, idempotencyKey(key), string(val), ttl).Result()
+	if err != nil {
+		return false, fmt.Errorf("error in RedisClient.SetNX: %w", err)
+	}
+	return set, nil
+}
+
+func (*Coordinator) SetIdempotencyKey(ctx context.Context, key string, val []byte, ttl time.Duration) error {
+	_, err := RedisClient.Set(ctx, idempotencyKey(key), string(val), ttl).Result()
+	if err != nil {
+		return fmt.Errorf("error in RedisClient.Set: %w", err)
+	}
+	return nil
+}
+
+func (*Coordinator) GetIdempotencyKey(ctx context.Context, key string) ([]byte, error) {
+	val, err := RedisClient.Get(ctx, idempotencyKey(key)).Result()
+	if errors.Is(err, redis.Nil) {
+		return nil, coord.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error in RedisClient.Get: %w", err)
+	}
+	return []byte(val), nil
+}
+
+func (*Coordinator) DeleteIdempotencyKey(ctx context.Context, key string) error {
+	_, err := RedisClient.Del(ctx, idempotencyKey(key)).Result()
+	if err != nil {
+		return fmt.Errorf("error in RedisClient.Del: %w", err)
+	}
+	return nil
+}
+
+func (*Coordinator) Ping(ctx context.Context) error {
+	_, err := RedisClient.Ping(ctx).Result()
+	if err != nil {
+		return fmt.Errorf("error in RedisClient.Ping: %w", err)
+	}
+	return nil
+}
+
+func (*Coordinator) Shutdown(ctx context.Context) error {
 	logger.Debug().Msg("shutting down redis client")
 
 	// Stop the background poller
-	//BGStopChan <- true
+	Ticker.Stop()
+	BGStopChan <- true
 
 	// Remove the pod from the cluster
 	_, err := RedisClient.HDel(ctx, utils.V_NAMESPACE, utils.POD_NAME).Result()
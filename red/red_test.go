@@ -0,0 +1,75 @@
+package red
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/danthegoodman1/SQLGateway/utils"
+	"github.com/go-redis/redis/v9"
+)
+
+func TestNewRedisClientModes(t *testing.T) {
+	defer func(mode, addr, master string) {
+		utils.REDIS_MODE, utils.REDIS_ADDR, utils.REDIS_SENTINEL_MASTER = mode, addr, master
+	}(utils.REDIS_MODE, utils.REDIS_ADDR, utils.REDIS_SENTINEL_MASTER)
+	utils.REDIS_ADDR = "localhost:6379,localhost:6380"
+
+	utils.REDIS_MODE = RedisModeSingle
+	client, err := newRedisClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.(*redis.Client); !ok {
+		t.Fatalf("expected *redis.Client, got %T", client)
+	}
+
+	utils.REDIS_MODE = RedisModeCluster
+	client, err = newRedisClient()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := client.(*redis.ClusterClient); !ok {
+		t.Fatalf("expected *redis.ClusterClient, got %T", client)
+	}
+
+	utils.REDIS_MODE = RedisModeSentinel
+	utils.REDIS_SENTINEL_MASTER = ""
+	if _, err = newRedisClient(); err == nil {
+		t.Fatal("expected an error without REDIS_SENTINEL_MASTER")
+	}
+	utils.REDIS_SENTINEL_MASTER = "mymaster"
+	if _, err = newRedisClient(); err != nil {
+		t.Fatal(err)
+	}
+
+	utils.REDIS_MODE = "bogus"
+	if _, err = newRedisClient(); !errors.Is(err, ErrUnknownRedisMode) {
+		t.Fatalf("expected ErrUnknownRedisMode, got %v", err)
+	}
+}
+
+func TestKeysAreNamespaced(t *testing.T) {
+	defer func(namespace string) {
+		utils.V_NAMESPACE = namespace
+	}(utils.V_NAMESPACE)
+
+	utils.V_NAMESPACE = "ns"
+	for _, key := range []string{txKey("tx123"), runningQueryKey("q"), idempotencyKey("k")} {
+		if !strings.HasPrefix(key, "ns:") {
+			t.Fatalf("expected %s to be prefixed with the namespace", key)
+		}
+	}
+
+	// Without a namespace the keys from before namespacing are used
+	utils.V_NAMESPACE = ""
+	if key := txKey("tx123"); key != "tx123" {
+		t.Fatalf("expected the unprefixed transaction key, got %s", key)
+	}
+	if key := runningQueryKey("q"); key != "query:q" {
+		t.Fatalf("expected the unprefixed running query key, got %s", key)
+	}
+	if key := idempotencyKey("k"); key != "idempotency:k" {
+		t.Fatalf("expected the unprefixed idempotency key, got %s", key)
+	}
+}
@@ -5,13 +5,43 @@ import "os"
 var (
 	PG_DSN        = os.Getenv("PG_DSN")
 	PG_POOL_CONNS = GetEnvOrDefaultInt("PG_POOL_CONNS", 2)
+	// The percentage of pool connections in use at which the pod reports that it is not ready
+	POOL_SATURATION_PCT = GetEnvOrDefaultInt("POOL_SATURATION_PCT", 90)
 
-	REDIS_ADDR       = os.Getenv("REDIS_ADDR")
-	REDIS_PASSWORD   = os.Getenv("REDIS_PASSWORD")
+	// Comma separated for cluster and sentinel modes
+	REDIS_ADDR     = os.Getenv("REDIS_ADDR")
+	REDIS_USERNAME = os.Getenv("REDIS_USERNAME")
+	REDIS_PASSWORD = os.Getenv("REDIS_PASSWORD")
+	// One of single, cluster, or sentinel
+	REDIS_MODE              = GetEnvOrDefault("REDIS_MODE", "single")
+	REDIS_SENTINEL_MASTER   = os.Getenv("REDIS_SENTINEL_MASTER")
+	REDIS_SENTINEL_PASSWORD = os.Getenv("REDIS_SENTINEL_PASSWORD")
+	// Whether to connect to redis with TLS
+	REDIS_TLS        = os.Getenv("REDIS_TLS") == "1"
 	REDIS_POOL_CONNS = GetEnvOrDefaultInt("REDIS_POOL_CONNS", 2)
 
-	// V_NAMESPACE Virtual namespace for redis hash map name
+	// Comma separated, used for coordination instead of redis if set
+	ETCD_ENDPOINTS = os.Getenv("ETCD_ENDPOINTS")
+	ETCD_USERNAME  = os.Getenv("ETCD_USERNAME")
+	ETCD_PASSWORD  = os.Getenv("ETCD_PASSWORD")
+	// Whether to connect to etcd with TLS
+	ETCD_TLS = os.Getenv("ETCD_TLS") == "1"
+
+	// V_NAMESPACE Virtual namespace for redis hash map name. Empty by default, which keeps the original unprefixed keys.
 	V_NAMESPACE = os.Getenv("V_NAMESPACE")
+	// How often this pod heartbeats into the peer hash
+	PEER_HEARTBEAT_SEC = GetEnvOrDefaultInt("PEER_HEARTBEAT_SEC", 5)
+	// How long since a peer's last heartbeat until it is evicted
+	PEER_TTL_SEC = GetEnvOrDefaultInt("PEER_TTL_SEC", 15)
+
+	// The timeout for each request forwarded to another pod, unless the request needs longer
+	PEER_TIMEOUT_MS = GetEnvOrDefaultInt("PEER_TIMEOUT_MS", 30000)
+	// How many times requests to other pods are retried, only if it is safe to
+	PEER_RETRIES = GetEnvOrDefaultInt("PEER_RETRIES", 2)
+	// How many consecutive failed requests to another pod open its circuit breaker
+	PEER_BREAKER_FAILURES = GetEnvOrDefaultInt("PEER_BREAKER_FAILURES", 5)
+	// How long a circuit breaker stays open before letting a request through to check the pod
+	PEER_BREAKER_COOLDOWN_MS = GetEnvOrDefaultInt("PEER_BREAKER_COOLDOWN_MS", 5000)
 
 	// this pod can be reached at url: {POD_NAME}{POD_BASE_DOMAIN}
 	POD_NAME = os.Getenv("POD_NAME")
@@ -21,6 +51,19 @@ var (
 	POD_URL = os.Getenv("POD_URL")
 
 	HTTP_PORT = GetEnvOrDefault("HTTP_PORT", "8080")
+	// If set, Postgres clients can connect on this port
+	PGWIRE_PORT = os.Getenv("PGWIRE_PORT")
+	// If both are set, Postgres clients can connect with TLS using this certificate and key
+	PGWIRE_TLS_CERT = os.Getenv("PGWIRE_TLS_CERT")
+	PGWIRE_TLS_KEY  = os.Getenv("PGWIRE_TLS_KEY")
+	// If set, the gRPC API is served on this port
+	GRPC_PORT = os.Getenv("GRPC_PORT")
+
+	// Whether to discover peers from the kubernetes API
+	K8S_SD                = os.Getenv("K8S_SD") == "1"
+	K8S_SD_NAMESPACE      = GetEnvOrDefault("K8S_SD_NAMESPACE", "default")
+	K8S_SD_LABEL_SELECTOR = GetEnvOrDefault("K8S_SD_LABEL_SELECTOR", "app=SQLGateway")
+	K8S_SD_RESYNC_SEC     = GetEnvOrDefaultInt("K8S_SD_RESYNC_SEC", 30)
 
 	// Whether to use https for inter-pod communication, defaults to false
 	POD_HTTPS = os.Getenv("POD_HTTPS") == "1"
@@ -28,6 +71,54 @@ var (
 	// Whether to emit traces in the HTTP logs
 	TRACES = os.Getenv("TRACES") == "1"
 
+	// The timeout for query requests that do not provide a TimeoutMS, also set as the statement_timeout of pool connections
+	QUERY_TIMEOUT_MS = GetEnvOrDefaultInt("QUERY_TIMEOUT_MS", 30_000)
+	// The maximum TimeoutMS that a query request can use
+	QUERY_MAX_TIMEOUT_MS = GetEnvOrDefaultInt("QUERY_MAX_TIMEOUT_MS", 300_000)
+	// The timeout for each attempt of a retried query
+	QUERY_ATTEMPT_TIMEOUT_MS = GetEnvOrDefaultInt("QUERY_ATTEMPT_TIMEOUT_MS", 60_000)
+	// The timeout for requests that are not queries, such as begin, commit, and rollback
+	REQUEST_TIMEOUT_MS = GetEnvOrDefaultInt("REQUEST_TIMEOUT_MS", 10_000)
+	// How long to wait for in-flight requests to finish when shutting down
+	SHUTDOWN_TIMEOUT_SEC = GetEnvOrDefaultInt("SHUTDOWN_TIMEOUT_SEC", 10)
+	// How often /psql/listen streams send a comment to keep idle connections open
+	LISTEN_HEARTBEAT_SEC = GetEnvOrDefaultInt("LISTEN_HEARTBEAT_SEC", 15)
+	// Comma separated origins like https://app.example.com that can open /psql/ws from a browser, besides the same host
+	WS_ALLOWED_ORIGINS = os.Getenv("WS_ALLOWED_ORIGINS")
+
+	// The Postgres publication that /psql/changes streams from
+	CDC_PUBLICATION = GetEnvOrDefault("CDC_PUBLICATION", "sqlgateway")
+	// The prefix of the replication slots of /psql/changes consumers
+	CDC_SLOT_PREFIX = GetEnvOrDefault("CDC_SLOT_PREFIX", "sqlgateway_")
+	// Comma separated /psql/changes consumers that can have a replication slot
+	CDC_CONSUMERS = os.Getenv("CDC_CONSUMERS")
+	// How often /psql/changes streams send a checkpoint
+	CDC_CHECKPOINT_SEC = GetEnvOrDefaultInt("CDC_CHECKPOINT_SEC", 10)
+
+	// The timeout for transactions that do not provide a TxTimeoutSec
+	TX_TIMEOUT_SEC = GetEnvOrDefaultInt("TX_TIMEOUT_SEC", 30)
+
+	// Whether each query in a transaction pushes back its expiry by its timeout
+	TX_SLIDING_EXPIRY = os.Getenv("TX_SLIDING_EXPIRY") == "1"
+	// The maximum time a transaction can be extended to after it started
+	TX_MAX_LIFETIME_SEC = GetEnvOrDefaultInt("TX_MAX_LIFETIME_SEC", 3600)
+
+	// If set, transaction IDs carry the owning pod, signed with this secret, so they can be forwarded without the coordinator
+	TX_ID_SECRET = os.Getenv("TX_ID_SECRET")
+	// Whether the owning pod in transaction IDs is encrypted rather than only signed
+	TX_ID_ENCRYPT = os.Getenv("TX_ID_ENCRYPT") == "1"
+
+	// Whether /psql/begin returns the pod that owns the transaction in a header and cookie, so it can be routed to directly
+	ROUTING_HINT        = os.Getenv("ROUTING_HINT") == "1"
+	ROUTING_HINT_COOKIE = GetEnvOrDefault("ROUTING_HINT_COOKIE", "sqlgateway_pod")
+
+	// How long the response to a request with an idempotency key is kept
+	IDEMPOTENCY_TTL_SEC = GetEnvOrDefaultInt("IDEMPOTENCY_TTL_SEC", 300)
+
 	AUTH_USER = os.Getenv("AUTH_USER")
 	AUTH_PASS = os.Getenv("AUTH_PASS")
+
+	// The credentials for the admin API, which is disabled unless both are set
+	ADMIN_USER = os.Getenv("ADMIN_USER")
+	ADMIN_PASS = os.Getenv("ADMIN_PASS")
 )
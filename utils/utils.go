@@ -43,7 +43,7 @@ func GetEnvOrDefaultInt(env string, defaultVal int64) int64 {
 	if e == "" {
 		return defaultVal
 	} else {
-		intVal, err := strconv.ParseInt(e, 10, 16)
+		intVal, err := strconv.ParseInt(e, 10, 64)
 		if err != nil {
 			logger.Error().Msg(fmt.Sprintf("Failed to parse string to int '%s'", env))
 			os.Exit(1)
@@ -112,6 +112,18 @@ func DaysUntil(t time.Time, d time.Weekday) int {
 	return int(delta)
 }
 
+// ErrPoolTimeout is returned when the context deadline passes while waiting for a free pool connection
+var ErrPoolTimeout = errors.New("timed out waiting for free pool connection")
+
+// AcquireConn acquires a pool connection, returning ErrPoolTimeout if the context deadline passes while waiting
+func AcquireConn(ctx context.Context, pool *pgxpool.Pool) (*pgxpool.Conn, error) {
+	conn, err := pool.Acquire(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		return nil, fmt.Errorf("%w: %s", ErrPoolTimeout, err)
+	}
+	return conn, err
+}
+
 // this wrapper exists so caller stack skipping works
 func ReliableExec(ctx context.Context, pool *pgxpool.Pool, tryTimeout time.Duration, f func(ctx context.Context, conn *pgxpool.Conn) error) error {
 	return reliableExec(ctx, pool, tryTimeout, func(ctx context.Context, tx *pgxpool.Conn) error {
@@ -131,9 +143,9 @@ func reliableExec(ctx context.Context, pool *pgxpool.Pool, tryTimeout time.Durat
 	cfg := backoff.WithMaxRetries(backoff.NewExponentialBackOff(), 3)
 
 	return backoff.RetryNotify(func() error {
-		conn, err := pool.Acquire(ctx)
+		conn, err := AcquireConn(ctx, pool)
 		if err != nil {
-			if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, context.Canceled) {
+			if errors.Is(err, ErrPoolTimeout) || errors.Is(err, context.Canceled) {
 				return backoff.Permanent(err)
 			}
 			return err
@@ -231,6 +243,21 @@ func IsSyntaxError(err error) bool {
 	return false
 }
 
+// IsRetryableTxErr returns whether the error is a serialization failure or deadlock, in which case the
+// transaction was aborted and can be safely retried
+func IsRetryableTxErr(err error) bool {
+	if err == nil {
+		return false
+	}
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		if pgErr.Code == "40001" || pgErr.Code == "40P01" {
+			return true
+		}
+	}
+	return false
+}
+
 func Ptr[T any](s T) *T {
 	return &s
 }
@@ -331,3 +358,11 @@ func GetHTTPPrefix() string {
 	}
 	return "http"
 }
+
+// GetPodURL returns the URL that this pod can be reached at by other pods
+func GetPodURL() string {
+	if POD_URL != "" {
+		return POD_URL
+	}
+	return POD_NAME + POD_BASE_DOMAIN
+}